@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// actionInput reads a GitHub Actions input (INPUT_<NAME>), falling back to the
+// given environment variable so the same step can use repository secrets directly
+func actionInput(name, fallbackEnv string) string {
+	if value := os.Getenv("INPUT_" + strings.ToUpper(name)); value != "" {
+		return value
+	}
+	if fallbackEnv != "" {
+		return os.Getenv(fallbackEnv)
+	}
+	return ""
+}
+
+// actionSeparator returns what separates the entries of a list input: lines
+// when it has several, and otherwise commas
+func actionSeparator(value string) string {
+	if strings.Contains(strings.TrimSpace(value), "\n") {
+		return "\n"
+	}
+	return ","
+}
+
+// actionList splits a list input into its entries. Entries keep their
+// position, so an empty one stays in the list.
+func actionList(value, separator string) []string {
+	if strings.TrimSpace(value) == "" {
+		return nil
+	}
+	// Block scalars in workflow files end with a newline of their own
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "\n"), "\r")
+	items := strings.Split(value, separator)
+	for i := range items {
+		items[i] = strings.TrimSpace(items[i])
+	}
+	return items
+}
+
+// escapeWorkflowCommand escapes a message for use in a ::command:: line
+func escapeWorkflowCommand(message string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(message)
+}
+
+// setActionOutput appends a step output to the file named by GITHUB_OUTPUT
+func setActionOutput(name, value string) error {
+	outputFile := os.Getenv("GITHUB_OUTPUT")
+	if outputFile == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(outputFile, os.O_APPEND|os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open GITHUB_OUTPUT: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := fmt.Fprintf(f, "%s=%s\n", name, value); err != nil {
+		return fmt.Errorf("failed to write GITHUB_OUTPUT: %w", err)
+	}
+	return nil
+}
+
+// runGitHubAction posts using inputs from a GitHub Actions step. The text comes
+// from the "text" input, images from "images" (paths, one per line or
+// comma-separated) with matching "alt" texts, and credentials from "identifier" and "app_password"
+// or the BLUESKY_IDENTIFIER and BLUESKY_APP_PASSWORD variables.
+func runGitHubAction() error {
+	text := actionInput("text", "")
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("the 'text' input is required")
+	}
+
+	post, err := applyConfigDefaults("bluesky", Post{Text: text})
+	if err != nil {
+		return err
+	}
+
+	if err := checkLength(post.Text); err != nil {
+		return err
+	}
+
+	images := actionInput("images", "")
+	separator := actionSeparator(images)
+	imagePaths := actionList(images, separator)
+	if err := checkImageCount("bluesky", len(imagePaths)); err != nil {
+		return err
+	}
+
+	// Alt texts are split like the images, except that a single image's
+	// alt text is kept whole, commas and all
+	alt := actionInput("alt", "")
+	altTexts := actionList(alt, separator)
+	if len(imagePaths) == 1 && strings.TrimSpace(alt) != "" {
+		altTexts = []string{strings.TrimSpace(alt)}
+	}
+	if len(altTexts) > 0 && len(altTexts) != len(imagePaths) {
+		return withExitCode(exitValidation, fmt.Errorf("got %d alt texts for %d images; give one per image, separated the same way as the images", len(altTexts), len(imagePaths)))
+	}
+
+	for i, path := range imagePaths {
+		if path == "" {
+			return withExitCode(exitValidation, fmt.Errorf("image %d in the 'images' input is empty", i+1))
+		}
+		data, err := readImage(path)
+		if err != nil {
+			return err
+		}
+
+		image := Image{Data: data}
+		if i < len(altTexts) {
+			image.Alt = altTexts[i]
+		}
+		post.Images = append(post.Images, image)
+	}
+
+	identifier := actionInput("identifier", "BLUESKY_IDENTIFIER")
+	appPassword := actionInput("app_password", "BLUESKY_APP_PASSWORD")
+	if identifier != "" && appPassword != "" {
+		if !appPasswordPattern.MatchString(appPassword) {
+			fmt.Printf("::warning::%s\n", escapeWorkflowCommand(strings.TrimPrefix(mainPasswordWarning, "Warning: ")))
+		}
+
+		config, err := loadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+
+		authResult, err := authenticateWithCredentials(identifier, appPassword)
+		if err != nil {
+			return err
+		}
+
+		if err := saveBlueskySession(config, identifier, authResult); err != nil {
+			return err
+		}
+	}
+
+	result, err := publish("bluesky", post)
+	if err != nil {
+		return err
+	}
+
+	if err := setActionOutput("uri", result.URI); err != nil {
+		return err
+	}
+	return setActionOutput("url", result.URL)
+}
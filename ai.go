@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Defaults used when the config's ai section leaves them empty
+const (
+	defaultAIEndpoint = "https://api.openai.com/v1"
+	defaultAIModel    = "gpt-4o-mini"
+)
+
+// Images sent for alt text are shrunk to this, which vision models scale down to anyway
+var aiImageLimit = imageLimit{MaxBytes: 4 << 20, MaxPixels: 2048 * 2048}
+
+// AIConfig configures the optional OpenAI-compatible endpoint used for suggestions
+type AIConfig struct {
+	Endpoint string `json:"endpoint,omitempty" toml:"endpoint"`
+	APIKey   string `json:"api_key,omitempty" toml:"api_key"`
+	Model    string `json:"model,omitempty" toml:"model"`
+}
+
+// withDefaults fills in the endpoint, model, and API key (from OPENAI_API_KEY) when unset
+func (c AIConfig) withDefaults() AIConfig {
+	if c.Endpoint == "" {
+		c.Endpoint = defaultAIEndpoint
+	}
+	if c.Model == "" {
+		c.Model = defaultAIModel
+	}
+	if c.APIKey == "" {
+		c.APIKey = os.Getenv("OPENAI_API_KEY")
+	}
+	c.Endpoint = strings.TrimSuffix(c.Endpoint, "/")
+	return c
+}
+
+// chatCompletion sends a single user message to the chat completions endpoint and returns the reply
+func chatCompletion(cfg AIConfig, content interface{}) (string, error) {
+	cfg = cfg.withDefaults()
+
+	reqBody, err := json.Marshal(map[string]interface{}{
+		"model": cfg.Model,
+		"messages": []map[string]interface{}{
+			{"role": "user", "content": content},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode completion request: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", cfg.Endpoint+"/chat/completions", bytes.NewReader(reqBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create completion request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if cfg.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+cfg.APIKey)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("completion request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", &statusError{Action: "completion", Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode completion response: %w", err)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("completion response contained no choices")
+	}
+
+	return strings.TrimSpace(result.Choices[0].Message.Content), nil
+}
+
+// suggestAltText asks the model to describe an image for screen reader users
+func suggestAltText(cfg AIConfig, image Image) (string, error) {
+	// The AI endpoint is a third party, so it never gets the location and
+	// camera details, even with --keep-exif, or more pixels than it needs
+	image, err := stripMetadata(image)
+	if err != nil {
+		return "", err
+	}
+	if image, err = fitImageWithin(aiImageLimit, "the AI endpoint", image); err != nil {
+		return "", err
+	}
+	dataURL := "data:" + http.DetectContentType(image.Data) + ";base64," + base64.StdEncoding.EncodeToString(image.Data)
+	return chatCompletion(cfg, []map[string]interface{}{
+		{"type": "text", "text": "Write alt text for this image for screen reader users of a social network. Describe what matters in one or two plain sentences, under 300 characters. Reply with the alt text only."},
+		{"type": "image_url", "image_url": map[string]string{"url": dataURL}},
+	})
+}
+
+// confirmSuggestion shows a suggested text and asks whether to use it, returning
+// the accepted (possibly replaced) text, or false if it was rejected
+func confirmSuggestion(label, suggestion string) (string, bool, error) {
+	fmt.Printf("Suggested %s:\n  %s\n", label, suggestion)
+	answer, err := promptLine("Use it? [y]es, [n]o, or type a replacement: ")
+	if err != nil {
+		return "", false, err
+	}
+
+	switch strings.ToLower(answer) {
+	case "", "y", "yes":
+		return suggestion, true, nil
+	case "n", "no":
+		return "", false, nil
+	default:
+		return answer, true, nil
+	}
+}
+
+// generateMissingAltText fills in alt text for images that have none, after the user confirms each suggestion
+func generateMissingAltText(cfg AIConfig, images []Image) error {
+	for i := range images {
+		if images[i].Alt != "" {
+			continue
+		}
+
+		infof("Generating alt text for image %d...\n", i+1)
+		suggestion, err := suggestAltText(cfg, images[i])
+		if err != nil {
+			return fmt.Errorf("failed to generate alt text for image %d: %w", i+1, err)
+		}
+
+		alt, ok, err := confirmSuggestion(fmt.Sprintf("alt text for image %d", i+1), suggestion)
+		if err != nil {
+			return err
+		}
+		if ok {
+			images[i].Alt = alt
+		}
+	}
+	return nil
+}
+
+// Number of times to ask the model again when its shortened message is still too long
+const maxShortenAttempts = 3
+
+// shortenMessage asks the model to rewrite a message to fit within limit characters
+func shortenMessage(cfg AIConfig, message string, limit int) (string, error) {
+	prompt := fmt.Sprintf("Shorten this social media post to at most %d characters. Keep its meaning, tone, links, mentions, and hashtags. Reply with the shortened post only.\n\n%s", limit, message)
+	return chatCompletion(cfg, prompt)
+}
+
+// offerShorterMessage suggests a shortened version of a message that doesn't
+// fit, and returns the message the user accepts. over reports how many
+// characters a text is over the tightest limit once it's posted, with the
+// signature and the services' link lengths counted.
+func offerShorterMessage(cfg AIConfig, message string, over func(string) int, fromStdin bool) (string, error) {
+	excess := over(message)
+	if excess <= 0 {
+		return message, nil
+	}
+
+	if fromStdin {
+		return "", fmt.Errorf("--ai-shorten needs to ask for confirmation, so it can't be combined with --stdin")
+	}
+
+	limit := utf8.RuneCountInString(message) - excess
+	if limit <= 0 {
+		return "", withExitCode(exitValidation, fmt.Errorf("the signature and defaults leave no room for the message"))
+	}
+
+	infof("Your message is %d characters over the limit. Asking for one of at most %d characters...\n", excess, limit)
+	for attempt := 0; attempt < maxShortenAttempts; attempt++ {
+		suggestion, err := shortenMessage(cfg, message, limit)
+		if err != nil {
+			return "", fmt.Errorf("failed to shorten message: %w", err)
+		}
+		if over(suggestion) > 0 {
+			continue
+		}
+
+		shortened, ok, err := confirmSuggestion(fmt.Sprintf("message (%d characters)", utf8.RuneCountInString(suggestion)), suggestion)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return shortened, nil
+		}
+		return message, nil
+	}
+
+	infof("Couldn't get a short enough suggestion.\n")
+	return message, nil
+}
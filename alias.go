@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// builtinCommands are shout's own commands, which aliases can't replace
+var builtinCommands = []string{
+	"auth", "post", "lint", "thread", "batch", "import", "list", "mute", "unmute", "block", "unblock", "dm",
+	"posts", "oops", "draft", "queue", "schedule", "serve", "api", "stream", "announce-release", "action", "stats", "edit",
+	"resolve", "feeds", "daemon", "plugins", "config", "version", "self-update", "limits", "init",
+}
+
+// Aliases can refer to other aliases, up to this many deep
+const maxAliasDepth = 10
+
+func isBuiltinCommand(name string) bool {
+	for _, command := range builtinCommands {
+		if command == name {
+			return true
+		}
+	}
+	return false
+}
+
+// splitWords splits an alias definition into arguments the way a shell
+// would: at spaces, except inside single or double quotes, with backslash
+// escaping the next character outside single quotes
+func splitWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped, inWord = true, true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote, inWord = r, true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("ends with a backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// expandAlias replaces a command that isn't one of shout's own with its
+// definition from the config's aliases, keeping the arguments after it
+func expandAlias(args []string) ([]string, error) {
+	if len(args) == 0 || isBuiltinCommand(args[0]) {
+		return args, nil
+	}
+
+	// Commands report a config that can't be loaded themselves
+	config, err := loadConfig()
+	if err != nil {
+		return args, nil
+	}
+
+	var expanded []string
+	for depth := 0; len(args) > 0 && !isBuiltinCommand(args[0]); depth++ {
+		definition, ok := config.Aliases[args[0]]
+		if !ok {
+			break
+		}
+		if depth == maxAliasDepth {
+			return nil, fmt.Errorf("alias %s refers back to itself", args[0])
+		}
+		words, err := splitWords(definition)
+		if err != nil {
+			return nil, fmt.Errorf("alias %s: %w", args[0], err)
+		}
+		if len(words) == 0 {
+			return nil, fmt.Errorf("alias %s is empty", args[0])
+		}
+		expanded = append(words, args[1:]...)
+		args = expanded
+	}
+	if expanded != nil {
+		logf(logDebug, "Expanded alias to: %s", strings.Join(expanded, " "))
+	}
+	return args, nil
+}
+
+// aliasNames returns the config's aliases in alphabetical order, for the usage text
+func aliasNames(config *Config) []string {
+	var names []string
+	for name := range config.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
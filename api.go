@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// apiPostRequest is the JSON body of POST /v1/posts
+type apiPostRequest struct {
+	Text           string   `json:"text"`
+	To             string   `json:"to"` // comma-separated services, like --to
+	Images         []Image  `json:"images"`
+	ContentWarning string   `json:"cw"`
+	Labels         []string `json:"labels"`
+	At             string   `json:"at"` // schedule the post, like --at
+	TZ             string   `json:"tz"`
+	Force          bool     `json:"force"`
+}
+
+// apiDelivery is what happened to a post on one service
+type apiDelivery struct {
+	Service string `json:"service"`
+	Status  string `json:"status"` // posted, queued, scheduled, or failed
+	URL     string `json:"url,omitempty"`
+	URI     string `json:"uri,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+// apiScheduled is a scheduled post as GET /v1/scheduled lists it, without its images
+type apiScheduled struct {
+	ID        uint64    `json:"id"`
+	Service   string    `json:"service"`
+	Text      string    `json:"text"`
+	Posts     int       `json:"posts"`
+	At        time.Time `json:"at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// apiServer serves the local REST API for GUIs and editor plugins
+type apiServer struct {
+	token string
+
+	// Posting refreshes and saves tokens, so only publish one post at a time
+	mu sync.Mutex
+}
+
+func (s *apiServer) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/posts", s.authorize(s.createPost))
+	mux.HandleFunc("GET /v1/history", s.authorize(s.listHistory))
+	mux.HandleFunc("GET /v1/scheduled", s.authorize(s.listScheduled))
+	mux.HandleFunc("GET /healthz", healthHandler)
+	return mux
+}
+
+// authorize checks the bearer token, if the API has one
+func (s *apiServer) authorize(next http.HandlerFunc) http.HandlerFunc {
+	webhook := &webhookHandler{token: s.token}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if s.token != "" && !webhook.authorized(r) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing token"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+// createPost posts to, or schedules a post for, each service it names
+func (s *apiServer) createPost(w http.ResponseWriter, r *http.Request) {
+	// Web pages can't send JSON to another origin without asking first, which
+	// keeps sites open in a browser from posting through the API
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		writeJSON(w, http.StatusUnsupportedMediaType, map[string]string{"error": "the body must be sent as application/json"})
+		return
+	}
+	var req apiPostRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	s.mu.Lock()
+	deliveries, err := apiPost(req)
+	s.mu.Unlock()
+	if err != nil {
+		status := http.StatusInternalServerError
+		if exitCode(err) == exitValidation {
+			status = http.StatusBadRequest
+		}
+		writeJSON(w, status, map[string]string{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	for _, d := range deliveries {
+		if d.Status == "failed" {
+			status = http.StatusBadGateway
+		}
+	}
+	writeJSON(w, status, map[string][]apiDelivery{"deliveries": deliveries})
+}
+
+// apiPost checks a post for every service before posting or scheduling it
+// anywhere, the same way shout post does
+func apiPost(req apiPostRequest) ([]apiDelivery, error) {
+	if strings.TrimSpace(req.Text) == "" {
+		return nil, withExitCode(exitValidation, fmt.Errorf("text is required"))
+	}
+	if err := checkLabels(req.Labels); err != nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("labels: %w", err))
+	}
+	when := atFlags{at: req.At, tz: req.TZ}
+	at, err := when.time()
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	services, err := servicesFor(config, req.To)
+	if err != nil {
+		return nil, withExitCode(exitValidation, err)
+	}
+
+	base := Post{Text: req.Text, Images: req.Images, Labels: req.Labels, ContentWarning: req.ContentWarning}
+	threads := make(map[string][]*Post)
+	for _, service := range services {
+		settings := config.Defaults[service]
+		if err := settings.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s defaults in config: %w", service, err)
+		}
+		thread := []*Post{postForService(base, settings)}
+		if postLength(service, thread[0].Text) > characterLimits[service] {
+			var err error
+			if thread, err = overflowPost(service, base, settings, false); err != nil {
+				return nil, fmt.Errorf("%s: %w", serviceNames[service], err)
+			}
+		}
+		if err := checkThread(service, thread); err != nil {
+			return nil, fmt.Errorf("%s: %w", serviceNames[service], err)
+		}
+		if !req.Force {
+			if err := checkDuplicate(config, service, thread[0].Text); err != nil {
+				return nil, err
+			}
+		}
+		threads[service] = thread
+	}
+
+	var deliveries []apiDelivery
+	if !at.IsZero() {
+		for _, service := range services {
+			d := apiDelivery{Service: service, Status: "scheduled"}
+			if err := scheduleThread(service, threads[service], at); err != nil {
+				d.Status, d.Error = "failed", fmt.Sprintf("failed to schedule the post: %v", err)
+			}
+			deliveries = append(deliveries, d)
+		}
+		return deliveries, nil
+	}
+
+	for _, d := range deliverAll(services, threads) {
+		result := apiDelivery{Service: d.Service, Status: "posted"}
+		switch {
+		case d.Err != nil:
+			result.Status, result.Error = "failed", d.Err.Error()
+		case d.Queued:
+			result.Status = "queued"
+		default:
+			result.URL, result.URI = d.Results[0].URL, d.Results[0].URI
+		}
+		deliveries = append(deliveries, result)
+	}
+	return deliveries, nil
+}
+
+// listHistory serves the most recent posts, newest first, up to ?limit (default 20)
+func (s *apiServer) listHistory(w http.ResponseWriter, r *http.Request) {
+	limit := 20
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid limit %q", value)})
+			return
+		}
+	}
+
+	store, err := openStore()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	entries, err := store.RecentHistory(limit)
+	store.Close()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("failed to read history: %v", err)})
+		return
+	}
+	if entries == nil {
+		entries = []HistoryEntry{}
+	}
+	writeJSON(w, http.StatusOK, map[string][]HistoryEntry{"posts": entries})
+}
+
+// listScheduled serves the scheduled posts, soonest first
+func (s *apiServer) listScheduled(w http.ResponseWriter, r *http.Request) {
+	scheduled, err := scheduledPosts()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+	list := []apiScheduled{}
+	for _, queued := range scheduled {
+		list = append(list, apiScheduled{
+			ID:        queued.ID,
+			Service:   queued.Service,
+			Text:      queued.Text,
+			Posts:     max(len(queued.Posts), 1),
+			At:        queued.NotBefore,
+			CreatedAt: queued.CreatedAt,
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string][]apiScheduled{"scheduled": list})
+}
+
+// isLoopback reports whether addr only listens on this machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// apiCommand runs the local API server until Ctrl-C
+func apiCommand(args []string) error {
+	fs := flag.NewFlagSet("api", flag.ExitOnError)
+	listen := fs.String("listen", "127.0.0.1:7777", "address to listen on")
+	token := fs.String("token", "", "shared secret callers must send as 'Authorization: Bearer <token>'; required unless listening on localhost")
+	parseFlags(fs, args)
+
+	if *token == "" && !isLoopback(*listen) {
+		return withExitCode(exitValidation, fmt.Errorf("a --token is required to listen on %s, since other machines can reach it", *listen))
+	}
+
+	server := &http.Server{Addr: *listen, Handler: (&apiServer{token: *token}).routes()}
+	go func() {
+		// Stop taking requests on Ctrl-C. Ctrl-C cancels the requests of posts
+		// being published too, so they're answered with an error before it closes.
+		<-rootCtx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), interruptGracePeriod)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	acknowledgeReloads()
+	infof("Serving the API on http://%s\n", *listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
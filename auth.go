@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// appPasswordPattern matches the xxxx-xxxx-xxxx-xxxx format of Bluesky app passwords
+var appPasswordPattern = regexp.MustCompile(`^[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{4}-[a-z0-9]{4}$`)
+
+// mainPasswordWarning explains why a password that isn't an app password is risky
+const mainPasswordWarning = "Warning: this doesn't look like an app password (xxxx-xxxx-xxxx-xxxx). Your main password gives full control of your account; create an app password under Settings > Privacy and Security > App Passwords instead."
+
+// confirmAppPassword warns when an entered password looks like a main account
+// password and refuses to continue unless the user confirms
+func confirmAppPassword(password string) error {
+	if appPasswordPattern.MatchString(password) {
+		return nil
+	}
+
+	fmt.Println(mainPasswordWarning)
+	answer, err := promptLine("Use it anyway? [y/N]: ")
+	if err != nil {
+		return err
+	}
+	if a := strings.ToLower(answer); a != "y" && a != "yes" {
+		return fmt.Errorf("refusing to log in with what looks like a main account password")
+	}
+	return nil
+}
+
+// warnIfMainPassword prints a warning for non-interactive logins that look like they use a main account password
+func warnIfMainPassword(password string) {
+	if !appPasswordPattern.MatchString(password) {
+		fmt.Println(mainPasswordWarning)
+	}
+}
+
+// jwtExpiry reads the exp claim from a JWT without verifying its signature
+func jwtExpiry(token string) (time.Time, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return time.Time{}, fmt.Errorf("malformed token")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return time.Time{}, fmt.Errorf("malformed token payload: %w", err)
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return time.Time{}, fmt.Errorf("malformed token claims: %w", err)
+	}
+	if claims.Exp == 0 {
+		return time.Time{}, fmt.Errorf("token has no expiry")
+	}
+
+	return time.Unix(claims.Exp, 0), nil
+}
+
+// describeExpiry formats a token's expiry and how long it remains valid
+func describeExpiry(token string) string {
+	expiry, err := jwtExpiry(token)
+	if err != nil {
+		return fmt.Sprintf("unknown (%v)", err)
+	}
+	return describeTime(expiry)
+}
+
+// describeTime formats when a token expires and how long it remains valid
+func describeTime(expiry time.Time) string {
+	remaining := time.Until(expiry)
+	if remaining <= 0 {
+		return fmt.Sprintf("expired %s (%s ago)", expiry.Local().Format(time.RFC1123), (-remaining).Round(time.Minute))
+	}
+	return fmt.Sprintf("%s (valid for %s)", expiry.Local().Format(time.RFC1123), remaining.Round(time.Minute))
+}
+
+// authStatus prints which accounts are authenticated and when their tokens expire
+func authStatus() error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if session := config.BlueskySession; session.AccessJwt != "" {
+		fmt.Printf("Bluesky: @%s on %s\n", session.Handle, strings.TrimSuffix(session.xrpcURL(""), "/xrpc/"))
+		fmt.Printf("  Access token expires:  %s\n", describeExpiry(session.AccessJwt))
+		if session.OAuth != nil {
+			// OAuth refresh tokens are opaque, so their expiry isn't known
+			fmt.Printf("  Signed in with OAuth through %s\n", session.OAuth.Issuer)
+		} else {
+			fmt.Printf("  Refresh token expires: %s\n", describeExpiry(session.RefreshJwt))
+		}
+	} else {
+		fmt.Println("Bluesky: not authenticated")
+	}
+
+	if session := config.MastodonSession; session.AccessToken != "" {
+		fmt.Printf("Mastodon: @%s on %s\n", session.Username, session.InstanceURL)
+		fmt.Println("  Access token does not expire")
+	} else {
+		fmt.Println("Mastodon: not authenticated")
+	}
+
+	if session := config.MatrixSession; session.AccessToken != "" {
+		fmt.Printf("Matrix: %s on %s, posting to %s\n", session.UserID, session.HomeserverURL, session.RoomID)
+		fmt.Println("  Access token does not expire")
+	} else {
+		fmt.Println("Matrix: not authenticated")
+	}
+
+	if session := config.RedditSession; session.ClientID != "" {
+		fmt.Printf("Reddit: u/%s\n", session.Username)
+		fmt.Printf("  Access token expires:  %s\n", describeTime(session.ExpiresAt))
+	} else {
+		fmt.Println("Reddit: not authenticated")
+	}
+
+	if session := config.LemmySession; session.JWT != "" {
+		fmt.Printf("Lemmy: %s on %s\n", session.Username, session.InstanceURL)
+		if expiry, err := jwtExpiry(session.JWT); err == nil {
+			fmt.Printf("  Login token expires:   %s\n", describeTime(expiry))
+		} else {
+			fmt.Println("  Login token does not expire")
+		}
+	} else {
+		fmt.Println("Lemmy: not authenticated")
+	}
+
+	if session := config.PixelfedSession; session.AccessToken != "" {
+		fmt.Printf("Pixelfed: @%s on %s\n", session.Username, session.InstanceURL)
+		fmt.Println("  Access token does not expire")
+	} else {
+		fmt.Println("Pixelfed: not authenticated")
+	}
+
+	if session := config.WordPressSession; session.AppPassword != "" {
+		fmt.Printf("WordPress: %s on %s\n", session.Username, session.SiteURL)
+		fmt.Println("  Application password does not expire")
+	} else {
+		fmt.Println("WordPress: not authenticated")
+	}
+
+	if session := config.GhostSession; session.AdminAPIKey != "" {
+		fmt.Printf("Ghost: %s\n", session.SiteURL)
+		fmt.Println("  Admin API key does not expire")
+	} else {
+		fmt.Println("Ghost: not authenticated")
+	}
+
+	if session := config.DevToSession; session.APIKey != "" {
+		fmt.Printf("dev.to: @%s\n", session.Username)
+		fmt.Println("  API key does not expire")
+	} else {
+		fmt.Println("dev.to: not authenticated")
+	}
+
+	return nil
+}
+
+// authRefresh refreshes the tokens of the given services now rather than
+// waiting for them to expire. Mastodon and Matrix tokens don't expire, so they are only checked.
+func authRefresh(services []string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	for _, service := range services {
+		switch service {
+		case "bluesky":
+			if config.BlueskySession.RefreshJwt == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with Bluesky, please run 'shout auth bluesky' first"))
+			}
+			if err := refreshStoredSession(config); err != nil {
+				return err
+			}
+			infof("Refreshed Bluesky session for @%s, access token expires %s\n", config.BlueskySession.Handle, describeExpiry(config.BlueskySession.AccessJwt))
+		case "mastodon", "pixelfed":
+			session := *mastodonAPISession(config, service)
+			if session.AccessToken == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with %s, please run 'shout auth %s' first", serviceNames[service], service))
+			}
+			if err := mastodonRequest(session, "GET", "/api/v1/accounts/verify_credentials", "", nil, nil); err != nil {
+				return fmt.Errorf("%s access token no longer works: %w", serviceNames[service], err)
+			}
+			infof("%s access token for @%s is still valid\n", serviceNames[service], session.Username)
+		case "matrix":
+			if config.MatrixSession.AccessToken == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with Matrix, please run 'shout auth matrix' first"))
+			}
+			if err := matrixRequest(config.MatrixSession, "GET", "/_matrix/client/v3/account/whoami", "", nil, nil); err != nil {
+				return fmt.Errorf("Matrix access token no longer works: %w", err)
+			}
+			infof("Matrix access token for %s is still valid\n", config.MatrixSession.UserID)
+		case "reddit":
+			// Reddit tokens can't be refreshed, only replaced by logging in again
+			config.RedditSession.ExpiresAt = time.Time{}
+			if err := saveConfig(config); err != nil {
+				return fmt.Errorf("failed to save config: %w", err)
+			}
+			if config, err = loadRedditSession(); err != nil {
+				return err
+			}
+			infof("Logged in to Reddit again as u/%s, access token expires %s\n", config.RedditSession.Username, describeTime(config.RedditSession.ExpiresAt))
+		case "lemmy":
+			if config.LemmySession.JWT == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with Lemmy, please run 'shout auth lemmy' first"))
+			}
+			if err := lemmyRequest(config.LemmySession, "GET", "/user/validate_auth", nil, nil); err != nil {
+				return fmt.Errorf("Lemmy login token no longer works: %w", err)
+			}
+			infof("Lemmy login token for %s is still valid\n", config.LemmySession.Username)
+		case "wordpress":
+			if config.WordPressSession.AppPassword == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with WordPress, please run 'shout auth wordpress' first"))
+			}
+			if err := wordpressRequest(config.WordPressSession, "GET", "/users/me", "", nil, nil); err != nil {
+				return fmt.Errorf("WordPress application password no longer works: %w", err)
+			}
+			infof("WordPress application password for %s is still valid\n", config.WordPressSession.Username)
+		case "ghost":
+			if config.GhostSession.AdminAPIKey == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with Ghost, please run 'shout auth ghost' first"))
+			}
+			if err := ghostRequest(config.GhostSession, "GET", "/site/", "", nil, nil); err != nil {
+				return fmt.Errorf("Ghost Admin API key no longer works: %w", err)
+			}
+			infof("Ghost Admin API key for %s is still valid\n", config.GhostSession.SiteURL)
+		case "devto":
+			if config.DevToSession.APIKey == "" {
+				return withExitCode(exitAuth, fmt.Errorf("not authenticated with dev.to, please run 'shout auth devto' first"))
+			}
+			if err := devtoRequest(config.DevToSession, "GET", "/users/me", nil, nil); err != nil {
+				return fmt.Errorf("dev.to API key no longer works: %w", err)
+			}
+			infof("dev.to API key for @%s is still valid\n", config.DevToSession.Username)
+		default:
+			return fmt.Errorf("unknown service: %s", service)
+		}
+	}
+
+	return nil
+}
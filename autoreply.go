@@ -0,0 +1,373 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AutoReplyConfig has shout daemon answer mentions that match its rules, for
+// bot accounts that answer "help" and the like with a canned reply
+type AutoReplyConfig struct {
+	// Services are the accounts whose mentions are answered: bluesky, mastodon, or both
+	Services []string `json:"services,omitempty" toml:"services"`
+
+	// Interval is how often notifications are checked, like "2m". Empty means 5m.
+	Interval string `json:"interval,omitempty" toml:"interval"`
+
+	// RepliesPerHour caps the replies sent on each service. 0 means 10.
+	RepliesPerHour int `json:"replies_per_hour,omitempty" toml:"replies_per_hour"`
+
+	// Allow limits replies to mentions by these accounts, like
+	// alice.bsky.social or bob@mastodon.social. Empty means everyone.
+	Allow []string `json:"allow,omitempty" toml:"allow"`
+
+	// Rules are tried in order, and the first that matches a mention answers it
+	Rules []AutoReplyRule `json:"rules,omitempty" toml:"rules"`
+}
+
+// AutoReplyRule answers mentions whose text matches Match
+type AutoReplyRule struct {
+	// Match is a regular expression, matched ignoring case
+	Match string `json:"match" toml:"match"`
+
+	// Reply is a template: {{.author}} is who mentioned the account, {{.text}}
+	// their post, and {{now}} and {{env "NAME"}} are available
+	Reply string `json:"reply" toml:"reply"`
+}
+
+const (
+	defaultAutoReplyInterval = 5 * time.Minute
+	defaultRepliesPerHour    = 10
+)
+
+// mention is a post that mentions the account
+type mention struct {
+	Cursor     string // where the notifications continue after this one
+	Author     string
+	Text       string
+	Post       *PostResult
+	Root       *PostResult // the first post of its thread on Bluesky
+	Visibility string      // the reply's visibility on Mastodon, for private mentions
+}
+
+// autoReplier is a validated AutoReplyConfig
+type autoReplier struct {
+	services []string
+	interval time.Duration
+	perHour  int
+	allow    map[string]bool
+	rules    []autoReplyRule
+}
+
+type autoReplyRule struct {
+	match *regexp.Regexp
+	reply string
+}
+
+// loadAutoReplier checks the config's auto-replies. It returns nil if there are none.
+func loadAutoReplier(config *Config) (*autoReplier, error) {
+	settings := config.AutoReply
+	if len(settings.Services) == 0 && len(settings.Rules) == 0 {
+		return nil, nil
+	}
+	if len(settings.Services) == 0 {
+		return nil, fmt.Errorf("auto_reply: services is empty, so no mentions are answered")
+	}
+	if len(settings.Rules) == 0 {
+		return nil, fmt.Errorf("auto_reply: there are no rules to answer mentions with")
+	}
+
+	replier := &autoReplier{interval: defaultAutoReplyInterval, perHour: defaultRepliesPerHour, allow: make(map[string]bool)}
+	for _, service := range settings.Services {
+		service = strings.ToLower(strings.TrimSpace(service))
+		if service != "bluesky" && service != "mastodon" {
+			return nil, fmt.Errorf("auto_reply: can't answer mentions on %s, only on bluesky and mastodon", service)
+		}
+		replier.services = append(replier.services, service)
+	}
+	if settings.Interval != "" {
+		interval, err := time.ParseDuration(settings.Interval)
+		if err != nil || interval < time.Minute {
+			return nil, fmt.Errorf("auto_reply: invalid interval %q, expected a duration of at least 1m", settings.Interval)
+		}
+		replier.interval = interval
+	}
+	if settings.RepliesPerHour < 0 {
+		return nil, fmt.Errorf("auto_reply: replies_per_hour can't be negative")
+	}
+	if settings.RepliesPerHour > 0 {
+		replier.perHour = settings.RepliesPerHour
+	}
+	for _, account := range settings.Allow {
+		replier.allow[normalizeAccount(account)] = true
+	}
+	for i, rule := range settings.Rules {
+		match, err := regexp.Compile("(?i)" + rule.Match)
+		if err != nil {
+			return nil, fmt.Errorf("auto_reply.rules[%d]: invalid match: %w", i, err)
+		}
+		if strings.TrimSpace(rule.Reply) == "" {
+			return nil, fmt.Errorf("auto_reply.rules[%d]: reply is empty", i)
+		}
+		if _, err := renderTemplate(rule.Reply, map[string]string{"author": "", "text": ""}); err != nil {
+			return nil, fmt.Errorf("auto_reply.rules[%d]: %w", i, err)
+		}
+		replier.rules = append(replier.rules, autoReplyRule{match: match, reply: rule.Reply})
+	}
+	return replier, nil
+}
+
+// loadAutoReplies reads and checks the auto-replies from the config
+func loadAutoReplies() (*autoReplier, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	return loadAutoReplier(config)
+}
+
+// normalizeAccount lowercases a handle or user@instance and drops its leading @
+func normalizeAccount(account string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(account), "@"))
+}
+
+// check answers the mentions on each service since the last check. The first
+// check on a service only notes where its notifications are, so turning
+// auto-replies on doesn't answer old mentions.
+func (a *autoReplier) check() {
+	for _, service := range a.services {
+		if err := a.checkService(service); err != nil {
+			daemonLogf("Couldn't check %s mentions: %v\n", serviceNames[service], err)
+		}
+	}
+}
+
+func (a *autoReplier) checkService(service string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	cursor, err := store.AutoReplyCursor(service)
+	store.Close()
+	if err != nil {
+		return err
+	}
+
+	var mentions []mention
+	var latest string
+	switch service {
+	case "bluesky":
+		mentions, latest, err = blueskyMentions(cursor)
+	case "mastodon":
+		mentions, latest, err = mastodonMentions(cursor)
+	}
+	if err != nil {
+		return err
+	}
+	if cursor == "" {
+		daemonLogf("Answering %s mentions from now on\n", serviceNames[service])
+		return saveAutoReplyCursor(service, latest)
+	}
+
+	for _, m := range mentions {
+		if err := a.answer(service, m); err != nil {
+			daemonLogf("Couldn't answer %s's mention on %s: %v\n", m.Author, serviceNames[service], err)
+		}
+		// Move past the mention even when answering it failed, so one bad
+		// mention doesn't get answered over and over
+		if err := saveAutoReplyCursor(service, m.Cursor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// answer replies to a mention with the first rule that matches it
+func (a *autoReplier) answer(service string, m mention) error {
+	if len(a.allow) > 0 && !a.allow[normalizeAccount(m.Author)] {
+		logf(logDebug, "Not answering %s, who isn't in auto_reply.allow", m.Author)
+		return nil
+	}
+	i := slices.IndexFunc(a.rules, func(rule autoReplyRule) bool { return rule.match.MatchString(m.Text) })
+	if i < 0 {
+		return nil
+	}
+	text, err := renderTemplate(a.rules[i].reply, map[string]string{"author": m.Author, "text": m.Text})
+	if err != nil {
+		return err
+	}
+	// Mastodon only notifies the people a reply mentions
+	if service == "mastodon" {
+		text = "@" + m.Author + " " + text
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	wait, err := store.TakeToken("auto_reply:"+service, a.perHour, time.Now())
+	store.Close()
+	if err != nil {
+		return fmt.Errorf("failed to check the reply limit: %w", err)
+	}
+	if wait > 0 {
+		return fmt.Errorf("reached the limit of %d replies per hour, skipping it", a.perHour)
+	}
+
+	post, err := applyConfigDefaults(service, Post{Text: text})
+	if err != nil {
+		return err
+	}
+	post.ReplyTo, post.ThreadRoot = m.Post, m.Root
+	if m.Visibility != "" {
+		post.Visibility = m.Visibility
+	}
+	if err := checkThread(service, []*Post{post}); err != nil {
+		return err
+	}
+	if _, _, err := deliverThread(service, []*Post{post}); err != nil {
+		return err
+	}
+	daemonLogf("Answered %s's mention on %s\n", m.Author, serviceNames[service])
+	return nil
+}
+
+// saveAutoReplyCursor remembers where a service's notifications were last read
+func saveAutoReplyCursor(service, cursor string) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.SetAutoReplyCursor(service, cursor)
+}
+
+// blueskyMentions returns the mentions indexed after cursor, an indexedAt
+// time, oldest first, and the newest notification's time
+func blueskyMentions(cursor string) ([]mention, string, error) {
+	config, err := loadBlueskySession()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var response struct {
+		Notifications []struct {
+			URI    string `json:"uri"`
+			CID    string `json:"cid"`
+			Reason string `json:"reason"`
+			Author struct {
+				DID    string `json:"did"`
+				Handle string `json:"handle"`
+			} `json:"author"`
+			Record struct {
+				Text  string `json:"text"`
+				Reply *struct {
+					Root PostResult `json:"root"`
+				} `json:"reply"`
+			} `json:"record"`
+			IndexedAt string `json:"indexedAt"`
+		} `json:"notifications"`
+	}
+	if err := blueskyGet(config, "app.bsky.notification.listNotifications", url.Values{"limit": {"50"}}, &response); err != nil {
+		return nil, "", err
+	}
+
+	latest := cursor
+	var mentions []mention
+	// Notifications come newest first
+	for _, n := range slices.Backward(response.Notifications) {
+		if cursor != "" && !timestampAfter(n.IndexedAt, cursor) {
+			continue
+		}
+		if latest == "" || timestampAfter(n.IndexedAt, latest) {
+			latest = n.IndexedAt
+		}
+		if n.Reason != "mention" || n.Author.DID == config.BlueskySession.Did {
+			continue
+		}
+		m := mention{Cursor: n.IndexedAt, Author: n.Author.Handle, Text: n.Record.Text, Post: &PostResult{URI: n.URI, CID: n.CID}}
+		if n.Record.Reply != nil {
+			root := n.Record.Reply.Root
+			m.Root = &root
+		}
+		mentions = append(mentions, m)
+	}
+	if latest == "" {
+		// An account without notifications starts from now
+		latest = time.Now().UTC().Format(time.RFC3339)
+	}
+	return mentions, latest, nil
+}
+
+// timestampAfter reports whether the RFC 3339 time a is after b
+func timestampAfter(a, b string) bool {
+	ta, errA := time.Parse(time.RFC3339, a)
+	tb, errB := time.Parse(time.RFC3339, b)
+	if errA != nil || errB != nil {
+		return a > b
+	}
+	return ta.After(tb)
+}
+
+// mastodonMentions returns the mentions after cursor, a notification ID,
+// oldest first, and the newest notification's ID
+func mastodonMentions(cursor string) ([]mention, string, error) {
+	config, err := loadMastodonSession()
+	if err != nil {
+		return nil, "", err
+	}
+	session := config.MastodonSession
+
+	// min_id pages forward from the cursor, so a burst of mentions is
+	// answered oldest first over several checks
+	query := url.Values{"types[]": {"mention"}, "limit": {"40"}}
+	if cursor != "" {
+		query.Set("min_id", cursor)
+	}
+	var notifications []struct {
+		ID      string `json:"id"`
+		Account struct {
+			Acct string `json:"acct"`
+		} `json:"account"`
+		Status struct {
+			ID         string `json:"id"`
+			URI        string `json:"uri"`
+			Content    string `json:"content"`
+			Visibility string `json:"visibility"`
+		} `json:"status"`
+	}
+	if err := mastodonRequest(session, "GET", "/api/v1/notifications?"+query.Encode(), "", nil, &notifications); err != nil {
+		return nil, "", err
+	}
+
+	latest := cursor
+	if len(notifications) > 0 {
+		latest = notifications[0].ID
+	}
+	var mentions []mention
+	for _, n := range slices.Backward(notifications) {
+		if strings.EqualFold(n.Account.Acct, session.Username) {
+			continue
+		}
+		m := mention{Cursor: n.ID, Author: n.Account.Acct, Text: plainText(n.Status.Content), Post: &PostResult{ID: n.Status.ID, URI: n.Status.URI}}
+		// Answer private mentions privately
+		switch n.Status.Visibility {
+		case "direct":
+			m.Visibility = "direct"
+		case "private":
+			m.Visibility = "followers"
+		}
+		mentions = append(mentions, m)
+	}
+	if latest == "" {
+		// Mastodon IDs are a millisecond timestamp shifted left 16 bits, so an
+		// account without notifications starts from now
+		latest = strconv.FormatInt(time.Now().UnixMilli()<<16, 10)
+	}
+	return mentions, latest, nil
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// batchEntry is one post in a batch file
+type batchEntry struct {
+	Text     string       `json:"text"`
+	Services []string     `json:"services"`
+	Images   []batchImage `json:"images"`
+
+	// At schedules the post, as RFC 3339 or "2006-01-02 15:04" in local time
+	At string `json:"at"`
+}
+
+type batchImage struct {
+	Path string `json:"path"`
+	Alt  string `json:"alt"`
+}
+
+// batchRow is a checked batch entry, ready to post
+type batchRow struct {
+	number   int
+	services []string
+	threads  map[string][]*Post
+	at       time.Time
+}
+
+// readBatchFile reads a JSON array of entries, or a CSV file with a header
+// naming its columns: text, services, at, and image and alt, which can repeat
+func readBatchFile(path string) ([]batchEntry, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read batch file: %w", err)
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		var entries []batchEntry
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return nil, withExitCode(exitValidation, fmt.Errorf("failed to parse batch file: %w", err))
+		}
+		return entries, nil
+	}
+
+	records, err := csv.NewReader(strings.NewReader(string(data))).ReadAll()
+	if err != nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("failed to parse batch file: %w", err))
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	header := records[0]
+	hasText := false
+	for _, column := range header {
+		switch strings.ToLower(strings.TrimSpace(column)) {
+		case "text":
+			hasText = true
+		case "services", "at", "image", "alt":
+		default:
+			return nil, withExitCode(exitValidation, fmt.Errorf("unknown column %q, expected text, services, image, alt, or at", column))
+		}
+	}
+	if !hasText {
+		return nil, withExitCode(exitValidation, fmt.Errorf("the batch file has no text column"))
+	}
+
+	var entries []batchEntry
+	for _, record := range records[1:] {
+		var entry batchEntry
+		for i, value := range record {
+			switch strings.ToLower(strings.TrimSpace(header[i])) {
+			case "text":
+				entry.Text = value
+			case "services":
+				if value != "" {
+					entry.Services = strings.Split(value, ",")
+				}
+			case "at":
+				entry.At = strings.TrimSpace(value)
+			case "image":
+				if value != "" {
+					entry.Images = append(entry.Images, batchImage{Path: value})
+				}
+			case "alt":
+				// Alt text belongs to the image column before it
+				if len(entry.Images) > 0 {
+					entry.Images[len(entry.Images)-1].Alt = value
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// checkBatchEntry turns an entry into the posts for each of its services,
+// checking them against the services' limits
+func checkBatchEntry(config *Config, entry batchEntry, dir string, defaultServices []string, force bool) (*batchRow, error) {
+	text := strings.TrimSpace(entry.Text)
+	if text == "" && len(entry.Images) == 0 {
+		return nil, withExitCode(exitValidation, fmt.Errorf("no text"))
+	}
+
+	services := defaultServices
+	if len(entry.Services) > 0 {
+		var err error
+		if services, err = parseServices(strings.Join(entry.Services, ",")); err != nil {
+			return nil, withExitCode(exitValidation, err)
+		}
+	}
+
+	row := &batchRow{services: services, threads: make(map[string][]*Post)}
+	if entry.At != "" {
+		var err error
+		if row.at, err = parseBatchTime(entry.At); err != nil {
+			return nil, withExitCode(exitValidation, err)
+		}
+	}
+
+	base := Post{Text: text}
+	for _, image := range entry.Images {
+		path := image.Path
+		if !filepath.IsAbs(path) && !strings.Contains(path, "://") {
+			path = filepath.Join(dir, path)
+		}
+		data, err := readImage(path)
+		if err != nil {
+			return nil, err
+		}
+		base.Images = append(base.Images, Image{Data: data, Alt: image.Alt})
+	}
+
+	for _, service := range services {
+		settings := config.Defaults[service]
+		if err := settings.validate(); err != nil {
+			return nil, fmt.Errorf("invalid %s defaults in config: %w", service, err)
+		}
+
+		thread := []*Post{postForService(base, settings)}
+		if postLength(service, thread[0].Text) > characterLimits[service] {
+			var err error
+			if thread, err = overflowPost(service, base, settings, false); err != nil {
+				return nil, fmt.Errorf("%s: %w", serviceNames[service], err)
+			}
+		}
+		if err := checkThread(service, thread); err != nil {
+			return nil, fmt.Errorf("%s: %w", serviceNames[service], err)
+		}
+		if !force {
+			if err := checkDuplicate(config, service, thread[0].Text); err != nil {
+				return nil, err
+			}
+		}
+		row.threads[service] = thread
+	}
+	return row, nil
+}
+
+func batchCommand(args []string) error {
+	fs := flag.NewFlagSet("batch", flag.ExitOnError)
+	to := fs.String("to", "", "comma-separated services for entries that don't list their own; default_service in the config, or bluesky, if not given")
+	dryRun := fs.Bool("dry-run", false, "check every entry without posting anything")
+	force := fs.Bool("force", false, "post entries even if the same text was recently posted to the service")
+	positional := parseFlags(fs, args)
+
+	if len(positional) != 1 {
+		fmt.Println("Usage: shout batch [--to bluesky,mastodon] [--dry-run] [--force] <posts.json|posts.csv|->")
+		os.Exit(1)
+	}
+	path := positional[0]
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	defaultServices, err := servicesFor(config, *to)
+	if err != nil {
+		return err
+	}
+
+	entries, err := readBatchFile(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return withExitCode(exitValidation, fmt.Errorf("%s has no entries", path))
+	}
+
+	// Check every entry before posting any, so a mistake in the last one
+	// doesn't leave the batch half posted
+	var rows []*batchRow
+	var problems []error
+	seen := make(map[string]int)
+	for i, entry := range entries {
+		row, err := checkBatchEntry(config, entry, filepath.Dir(path), defaultServices, *force)
+		if err == nil {
+			for _, service := range row.services {
+				key := service + "\x00" + row.threads[service][0].Text
+				if first, ok := seen[key]; ok && !*force {
+					err = withExitCode(exitValidation, fmt.Errorf("same text for %s as entry %d", serviceNames[service], first))
+					break
+				}
+				seen[key] = i + 1
+			}
+		}
+		if err != nil {
+			problems = append(problems, fmt.Errorf("entry %d: %w", i+1, err))
+			continue
+		}
+		row.number = i + 1
+		rows = append(rows, row)
+	}
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Fprintln(os.Stderr, problem)
+		}
+		return withExitCode(exitValidation, fmt.Errorf("%d of %d entries have problems, so nothing was posted", len(problems), len(entries)))
+	}
+
+	if *dryRun {
+		fmt.Printf("All %d entries are ready to post.\n", len(entries))
+		return nil
+	}
+
+	flushQueueBeforePosting()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ENTRY\tSERVICE\tSTATUS\tDETAILS")
+	var failures []error
+	for _, row := range rows {
+		if rootCtx.Err() != nil {
+			fmt.Fprintf(w, "%d\t\tskipped\tinterrupted\n", row.number)
+			continue
+		}
+
+		// Scheduled entries wait in the queue until they're due
+		if row.at.After(time.Now()) {
+			for _, service := range row.services {
+				if err := scheduleThread(service, row.threads[service], row.at); err != nil {
+					failures = append(failures, fmt.Errorf("entry %d: %s: %w", row.number, serviceNames[service], err))
+					fmt.Fprintf(w, "%d\t%s\tfailed\t%v\n", row.number, serviceNames[service], err)
+					continue
+				}
+				fmt.Fprintf(w, "%d\t%s\tscheduled\t%s\n", row.number, serviceNames[service], row.at.Local().Format("2006-01-02 15:04"))
+			}
+			continue
+		}
+
+		for _, d := range deliverAll(row.services, row.threads) {
+			switch {
+			case d.Err != nil:
+				failures = append(failures, fmt.Errorf("entry %d: %s: %w", row.number, serviceNames[d.Service], d.Err))
+				fmt.Fprintf(w, "%d\t%s\tfailed\t%v\n", row.number, serviceNames[d.Service], d.Err)
+			case d.Queued:
+				fmt.Fprintf(w, "%d\t%s\tqueued\twill be sent when the service can be reached\n", row.number, serviceNames[d.Service])
+			default:
+				fmt.Fprintf(w, "%d\t%s\tposted\t%s\n", row.number, serviceNames[d.Service], d.Results[0].URL)
+			}
+		}
+	}
+	w.Flush()
+
+	if rootCtx.Err() != nil {
+		return withExitCode(exitInterrupted, fmt.Errorf("interrupted before the whole batch was posted"))
+	}
+	return errors.Join(failures...)
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// copyToClipboard places text on the system clipboard using the platform's clipboard tool
+func copyToClipboard(text string) error {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		cmd = exec.Command("pbcopy")
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("clip")
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		cmd = exec.Command("wl-copy")
+	default:
+		if _, err := exec.LookPath("xclip"); err == nil {
+			cmd = exec.Command("xclip", "-selection", "clipboard")
+		} else {
+			cmd = exec.Command("xsel", "--clipboard", "--input")
+		}
+	}
+
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("failed to copy to clipboard with %s: %w", cmd.Path, err)
+	}
+	return nil
+}
+
+// pasteImageFromClipboard returns the image on the system clipboard, such as
+// a screenshot, as PNG data
+func pasteImageFromClipboard() ([]byte, error) {
+	var cmd *exec.Cmd
+	switch {
+	case runtime.GOOS == "darwin":
+		// pbpaste only pastes text, so ask AppleScript, which prints the data as «data PNGf89504E47…»
+		cmd = exec.Command("osascript", "-e", "the clipboard as «class PNGf»")
+	case runtime.GOOS == "windows":
+		cmd = exec.Command("powershell", "-NoProfile", "-Command",
+			"Add-Type -AssemblyName System.Windows.Forms; $i = [Windows.Forms.Clipboard]::GetImage(); "+
+				"if ($i) { $m = New-Object IO.MemoryStream; $i.Save($m, [Drawing.Imaging.ImageFormat]::Png); "+
+				"$o = [Console]::OpenStandardOutput(); $o.Write($m.ToArray(), 0, $m.Length) }")
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		cmd = exec.Command("wl-paste", "--type", "image/png")
+	default:
+		// xsel only handles text
+		cmd = exec.Command("xclip", "-selection", "clipboard", "-target", "image/png", "-out")
+	}
+
+	data, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to paste an image from the clipboard with %s, is there one on it? %w", cmd.Path, err)
+	}
+	if runtime.GOOS == "darwin" {
+		hexData := strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(string(data)), "«data PNGf"), "»")
+		if data, err = hex.DecodeString(hexData); err != nil {
+			return nil, fmt.Errorf("the clipboard has no image")
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 || !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, fmt.Errorf("the clipboard has no image")
+	}
+	return data, nil
+}
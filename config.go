@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// configMigrations upgrade the config file layout one step at a time. The
+// version field in the file is the number of migrations applied, so new
+// migrations must only ever be appended to this list. They work on the raw
+// JSON object so that they can rename and restructure keys.
+var configMigrations = []func(raw map[string]json.RawMessage) error{
+	// 1: configs written before the version field existed
+	func(raw map[string]json.RawMessage) error { return nil },
+}
+
+// upgradeConfig applies any pending migrations to a config's JSON, returning
+// the version it started at
+func upgradeConfig(data []byte) (upgraded []byte, version int, err error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if v, ok := raw["version"]; ok {
+		if err := json.Unmarshal(v, &version); err != nil {
+			return nil, 0, fmt.Errorf("invalid config version: %w", err)
+		}
+	}
+	if version > len(configMigrations) {
+		return nil, 0, fmt.Errorf("config version %d is newer than this version of shout supports (%d)", version, len(configMigrations))
+	}
+	if version == len(configMigrations) {
+		return data, version, nil
+	}
+
+	for i := version; i < len(configMigrations); i++ {
+		if err := configMigrations[i](raw); err != nil {
+			return nil, 0, fmt.Errorf("config migration %d failed: %w", i+1, err)
+		}
+	}
+	raw["version"], _ = json.Marshal(len(configMigrations))
+
+	upgraded, err = json.MarshalIndent(raw, "", "  ")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return upgraded, version, nil
+}
+
+// migrateConfig applies any pending migrations to the config file's contents.
+// If there were any, the upgraded config is saved in place, with the original
+// kept next to it as config.json.v<version>.bak.
+func migrateConfig(path string, data []byte) ([]byte, error) {
+	migrated, version, err := upgradeConfig(data)
+	if err != nil || version == len(configMigrations) {
+		return migrated, err
+	}
+
+	// Another shout process may be migrating or saving the config too, so
+	// migrate what's in the file once this one holds the lock
+	unlock, err := lockConfigFile("config")
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if data, err = os.ReadFile(path); err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if migrated, version, err = upgradeConfig(data); err != nil || version == len(configMigrations) {
+		return migrated, err
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, version)
+	if err := os.WriteFile(backup, data, 0600); err != nil {
+		return nil, fmt.Errorf("failed to back up config file: %w", err)
+	}
+	if err := writeFileAtomic(path, migrated, 0600); err != nil {
+		return nil, fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return migrated, nil
+}
+
+// configProblem is an issue found by shout config validate
+type configProblem struct {
+	Severity string // "error" if shout can't use the config as-is, otherwise "warning"
+	Message  string
+}
+
+// lineAt returns the 1-based line number of a byte offset in data
+func lineAt(data []byte, offset int64) int {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+// unknownKeys lists the keys in raw that have no matching json field in t,
+// descending into nested objects and maps of objects
+func unknownKeys(raw map[string]interface{}, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.IsExported() && name != "" && name != "-" {
+			fields[name] = field.Type
+		}
+	}
+
+	var unknown []string
+	for key, value := range raw {
+		fieldType, ok := fields[key]
+		if !ok {
+			unknown = append(unknown, prefix+key)
+			continue
+		}
+
+		nested, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch {
+		case fieldType.Kind() == reflect.Struct || fieldType.Kind() == reflect.Pointer:
+			unknown = append(unknown, unknownKeys(nested, fieldType, prefix+key+".")...)
+		case fieldType.Kind() == reflect.Map && fieldType.Elem().Kind() == reflect.Struct:
+			for name, entry := range nested {
+				if entry, ok := entry.(map[string]interface{}); ok {
+					unknown = append(unknown, unknownKeys(entry, fieldType.Elem(), prefix+key+"."+name+".")...)
+				}
+			}
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// checkPDS reports whether a Bluesky server answers its health check
+func checkPDS(serviceURL string) error {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(serviceURL + "/xrpc/_health")
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// validateConfig checks config.json and config.toml in configDir
+func validateConfig(configDir string) ([]configProblem, error) {
+	var problems []configProblem
+	problem := func(severity, format string, args ...interface{}) {
+		problems = append(problems, configProblem{severity, fmt.Sprintf(format, args...)})
+	}
+
+	var config Config
+	path := filepath.Join(configDir, "config.json")
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		problem("warning", "%s doesn't exist yet. Run 'shout auth bluesky' or 'shout auth mastodon' to create it", path)
+	case err != nil:
+		return nil, err
+	default:
+		// The config holds access tokens, so only its owner should be able to read it
+		if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+			problem("warning", "%s can be read by other users (mode %04o). Run 'chmod 600 %s'", path, info.Mode().Perm(), path)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+
+		var raw map[string]interface{}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				problem("error", "line %d: %v", lineAt(data, syntaxErr.Offset), err)
+			} else {
+				problem("error", "the config must be a JSON object: %v", err)
+			}
+			return problems, nil
+		}
+
+		if err := json.Unmarshal(data, &config); err != nil {
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &typeErr) {
+				problem("error", "line %d: %s should be a %s, not a %s", lineAt(data, typeErr.Offset), typeErr.Field, typeErr.Type, typeErr.Value)
+			} else {
+				problem("error", "%v", err)
+			}
+			return problems, nil
+		}
+
+		if config.Version > len(configMigrations) {
+			problem("error", "config version %d is newer than this version of shout supports (%d). Upgrade shout", config.Version, len(configMigrations))
+		}
+
+		for _, key := range unknownKeys(raw, reflect.TypeOf(config), "") {
+			problem("warning", "unknown key %q is ignored. Check it for typos", key)
+		}
+	}
+
+	settings, md, unknown, err := loadSettingsFile(configDir)
+	if err != nil {
+		problem("error", "%v", err)
+		return problems, nil
+	}
+	for _, key := range unknown {
+		problem("warning", "unknown key %q in %s is ignored. Check it for typos", key, settingsFileName)
+	}
+	if settings != nil {
+		settings.applyTo(&config, md)
+	}
+
+	for service, defaults := range config.Defaults {
+		if _, ok := serviceNames[service]; !ok && !registerPlugin(service) {
+			problem("warning", "defaults.%s: unknown service, expected bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto, or one with a %s<service> plugin on the PATH", service, pluginPrefix)
+			continue
+		}
+		if err := defaults.validate(); err != nil {
+			problem("error", "defaults.%s: %v", service, err)
+		}
+	}
+	for service := range config.Credentials {
+		if _, ok := serviceNames[service]; !ok && !registerPlugin(service) {
+			problem("warning", "credentials.%s: unknown service, expected bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto, or one with a %s<service> plugin on the PATH", service, pluginPrefix)
+		}
+	}
+	for i, schedule := range config.Schedules {
+		if _, err := parseCron(schedule.Cron); err != nil {
+			problem("error", "schedules[%d]: %v", i, err)
+		}
+	}
+	if config.Hooks.Webhook != "" {
+		if err := checkWebhookURL(config.Hooks.Webhook); err != nil {
+			problem("error", "hooks.webhook: %v", err)
+		}
+	}
+	if err := checkFeeds(&config); err != nil {
+		problem("error", "%v", err)
+	}
+	if _, err := loadAutoReplier(&config); err != nil {
+		problem("error", "%v", err)
+	}
+	if config.DefaultService != "" {
+		if _, err := parseServices(config.DefaultService); err != nil {
+			problem("error", "default_service: %v", err)
+		}
+	}
+	if config.DefaultAccount != "" && activeProfile != "" {
+		problem("warning", "default_account is only read from the main config, not from a profile's")
+	}
+	for name, definition := range config.Aliases {
+		if isBuiltinCommand(name) {
+			problem("warning", "aliases.%s: %s is a built-in command, so the alias is never used", name, name)
+			continue
+		}
+		if words, err := splitWords(definition); err != nil {
+			problem("error", "aliases.%s: %v", name, err)
+		} else if len(words) == 0 {
+			problem("error", "aliases.%s is empty", name)
+		}
+	}
+	if _, err := config.Log.level(); err != nil {
+		problem("error", "log.level: %v", err)
+	}
+	if _, err := config.Log.handler(io.Discard, logInfo); err != nil {
+		problem("error", "log.format: %v", err)
+	}
+	if _, err := config.duplicateWindow(); err != nil {
+		problem("error", "%v. Use a duration like \"24h\", or \"0\" to turn the check off", err)
+	}
+
+	bluesky := config.BlueskySession
+	switch {
+	case bluesky.AccessJwt == "" && config.Credentials["bluesky"].SecretCommand == "" && os.Getenv("BLUESKY_APP_PASSWORD") == "":
+		problem("warning", "not authenticated with Bluesky. Run 'shout auth bluesky' if you post there")
+	case bluesky.AccessJwt != "" && (bluesky.RefreshJwt == "" || bluesky.Did == ""):
+		problem("error", "the Bluesky session is incomplete. Run 'shout auth bluesky' again")
+	case bluesky.OAuth != nil && (bluesky.OAuth.TokenEndpoint == "" || bluesky.OAuth.DPoPKey == ""):
+		problem("error", "the Bluesky OAuth session is incomplete. Run 'shout auth bluesky --oauth' again")
+	}
+	if bluesky.AccessJwt != "" {
+		serviceURL := bluesky.ServiceURL
+		if serviceURL == "" {
+			serviceURL = defaultBlueskyService
+		}
+		if err := checkPDS(serviceURL); err != nil {
+			problem("warning", "can't reach the Bluesky server %s: %v", serviceURL, err)
+		}
+	}
+
+	mastodon := config.MastodonSession
+	switch {
+	case mastodon.AccessToken == "" && config.Credentials["mastodon"].SecretCommand == "" && os.Getenv("MASTODON_ACCESS_TOKEN") == "":
+		problem("warning", "not authenticated with Mastodon. Run 'shout auth mastodon' if you post there")
+	case mastodon.AccessToken != "" && mastodon.InstanceURL == "":
+		problem("error", "the Mastodon session has no instance_url. Run 'shout auth mastodon' again")
+	}
+
+	if pixelfed := config.PixelfedSession; pixelfed.AccessToken != "" && pixelfed.InstanceURL == "" {
+		problem("error", "the Pixelfed session has no instance_url. Run 'shout auth pixelfed' again")
+	}
+	if wordpress := config.WordPressSession; wordpress.AppPassword != "" && wordpress.SiteURL == "" {
+		problem("error", "the WordPress session has no site_url. Run 'shout auth wordpress' again")
+	}
+	if ghost := config.GhostSession; ghost.AdminAPIKey != "" && ghost.SiteURL == "" {
+		problem("error", "the Ghost session has no site_url. Run 'shout auth ghost' again")
+	}
+
+	// Few people post to Matrix, so a missing login isn't worth a warning
+	if matrix := config.MatrixSession; matrix.AccessToken != "" && (matrix.HomeserverURL == "" || matrix.RoomID == "") {
+		problem("error", "the Matrix session has no homeserver_url or room_id. Run 'shout auth matrix' again")
+	}
+	if reddit := config.RedditSession; reddit.ClientID != "" && time.Now().After(reddit.ExpiresAt) && config.Credentials["reddit"].SecretCommand == "" && os.Getenv("REDDIT_PASSWORD") == "" {
+		problem("warning", "the Reddit session has expired and there are no credentials to log in again. Run 'shout auth reddit' before posting there")
+	}
+
+	return problems, nil
+}
+
+func configCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{""}
+	}
+
+	switch args[0] {
+	case "validate":
+		return validateCommand()
+	case "export":
+		return exportConfigCommand(args[1:])
+	case "import":
+		return importConfigCommand(args[1:])
+	default:
+		fmt.Println("Usage: shout config <validate|export [--no-secrets] [--output <file>]|import <file>>")
+		os.Exit(1)
+	}
+	return nil
+}
+
+func validateCommand() error {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return err
+	}
+	problems, err := validateConfig(configDir)
+	if err != nil {
+		return err
+	}
+
+	errorCount := 0
+	for _, p := range problems {
+		if p.Severity == "error" {
+			errorCount++
+		}
+		fmt.Printf("%-8s %s\n", p.Severity, p.Message)
+	}
+
+	if errorCount > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("the config in %s has %d error(s)", configDir, errorCount))
+	}
+	if len(problems) == 0 {
+		infof("The config in %s is valid.\n", configDir)
+	}
+	return nil
+}
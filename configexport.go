@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PBKDF2 iterations used for new exports; imports use the count stored in the file
+const exportKeyIterations = 600000
+
+// The iteration counts an import accepts: fewer would make a weak key, and
+// many more would keep shout busy for minutes
+const (
+	minExportKeyIterations = 100000
+	maxExportKeyIterations = 10 * exportKeyIterations
+)
+
+// configExport is the file written by shout config export. It holds either
+// the plain config, with secrets removed, or the whole config encrypted.
+type configExport struct {
+	Format    int              `json:"shout_config_export"`
+	Config    json.RawMessage  `json:"config,omitempty"`
+	Encrypted *encryptedConfig `json:"encrypted,omitempty"`
+}
+
+// encryptedConfig is a config sealed with AES-256-GCM under a key derived
+// from a passphrase with PBKDF2-HMAC-SHA256
+type encryptedConfig struct {
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// deriveExportKey derives a 32-byte key from a passphrase with PBKDF2-HMAC-SHA256
+func deriveExportKey(passphrase string, salt []byte, iterations int) []byte {
+	// A single PBKDF2 block is exactly one SHA-256 output
+	prf := hmac.New(sha256.New, []byte(passphrase))
+	prf.Write(salt)
+	prf.Write(binary.BigEndian.AppendUint32(nil, 1))
+	u := prf.Sum(nil)
+
+	key := append([]byte(nil), u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range key {
+			key[j] ^= u[j]
+		}
+	}
+	return key
+}
+
+// exportCipher returns the AES-GCM cipher for a passphrase and salt
+func exportCipher(passphrase string, salt []byte, iterations int) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveExportKey(passphrase, salt, iterations))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// exportPassphrase reads the passphrase protecting an export from
+// SHOUT_PASSPHRASE, or asks for it on stderr so it doesn't end up in the export
+func exportPassphrase(confirm bool) (string, error) {
+	if passphrase := os.Getenv("SHOUT_PASSPHRASE"); passphrase != "" {
+		return passphrase, nil
+	}
+
+	fmt.Fprint(os.Stderr, "Passphrase: ")
+	passphrase, err := stdinReader.ReadString('\n')
+	if err != nil && (err != io.EOF || passphrase == "") {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	passphrase = strings.TrimRight(passphrase, "\r\n")
+	if passphrase == "" {
+		return "", fmt.Errorf("the passphrase can't be empty")
+	}
+
+	if confirm {
+		fmt.Fprint(os.Stderr, "Repeat the passphrase: ")
+		repeated, _ := stdinReader.ReadString('\n')
+		if strings.TrimRight(repeated, "\r\n") != passphrase {
+			return "", fmt.Errorf("the passphrases don't match")
+		}
+	}
+	return passphrase, nil
+}
+
+// stripSecrets removes tokens, keys, and passwords from a config. Credential
+// commands are kept, since they only say where the secrets are.
+func stripSecrets(config *Config) {
+	config.BlueskySession.AccessJwt = ""
+	config.BlueskySession.RefreshJwt = ""
+	config.BlueskySession.OAuth = nil
+	config.MastodonSession.AccessToken = ""
+	config.MatrixSession.AccessToken = ""
+	config.RedditSession.AccessToken = ""
+	config.RedditSession.ClientSecret = ""
+	config.LemmySession.JWT = ""
+	config.PixelfedSession.AccessToken = ""
+	config.WordPressSession.AppPassword = ""
+	config.GhostSession.AdminAPIKey = ""
+	config.DevToSession.APIKey = ""
+	config.AI.APIKey = ""
+	config.Hooks.WebhookSecret = ""
+}
+
+func exportConfigCommand(args []string) error {
+	fs := flag.NewFlagSet("config export", flag.ExitOnError)
+	noSecrets := fs.Bool("no-secrets", false, "leave out tokens and API keys instead of encrypting the export")
+	output := fs.String("output", "", "write the export to a file instead of stdout")
+	parseFlags(fs, args)
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	config.Version = len(configMigrations)
+
+	export := configExport{Format: 1}
+	if *noSecrets {
+		stripSecrets(config)
+		if export.Config, err = json.Marshal(config); err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+	} else {
+		passphrase, err := exportPassphrase(true)
+		if err != nil {
+			return err
+		}
+
+		plaintext, err := json.Marshal(config)
+		if err != nil {
+			return fmt.Errorf("failed to marshal config: %w", err)
+		}
+
+		sealed := &encryptedConfig{Iterations: exportKeyIterations, Salt: make([]byte, 16)}
+		if _, err := rand.Read(sealed.Salt); err != nil {
+			return err
+		}
+		aead, err := exportCipher(passphrase, sealed.Salt, sealed.Iterations)
+		if err != nil {
+			return err
+		}
+		sealed.Nonce = make([]byte, aead.NonceSize())
+		if _, err := rand.Read(sealed.Nonce); err != nil {
+			return err
+		}
+		sealed.Ciphertext = aead.Seal(nil, sealed.Nonce, plaintext, nil)
+		export.Encrypted = sealed
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal export: %w", err)
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0600); err != nil {
+		return fmt.Errorf("failed to write export: %w", err)
+	}
+	infof("Exported the config to %s\n", *output)
+	return nil
+}
+
+func importConfigCommand(args []string) error {
+	if len(args) != 1 {
+		fmt.Println("Usage: shout config import <file>  (- reads from stdin)")
+		os.Exit(1)
+	}
+
+	var data []byte
+	var err error
+	if args[0] == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(args[0])
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+
+	var export configExport
+	if err := json.Unmarshal(data, &export); err != nil || export.Format == 0 {
+		return withExitCode(exitValidation, fmt.Errorf("%s is not a shout config export", args[0]))
+	}
+	if export.Format > 1 {
+		return fmt.Errorf("the export was made by a newer version of shout")
+	}
+
+	plaintext := []byte(export.Config)
+	if sealed := export.Encrypted; sealed != nil {
+		passphrase, err := exportPassphrase(false)
+		if err != nil {
+			return err
+		}
+		if sealed.Iterations < minExportKeyIterations || sealed.Iterations > maxExportKeyIterations || len(sealed.Salt) == 0 {
+			return withExitCode(exitValidation, fmt.Errorf("the export is damaged: its key settings are invalid"))
+		}
+		aead, err := exportCipher(passphrase, sealed.Salt, sealed.Iterations)
+		if err != nil {
+			return err
+		}
+		if len(sealed.Nonce) != aead.NonceSize() {
+			return withExitCode(exitValidation, fmt.Errorf("the export is damaged: its nonce is %d bytes, not %d", len(sealed.Nonce), aead.NonceSize()))
+		}
+		if plaintext, err = aead.Open(nil, sealed.Nonce, sealed.Ciphertext, nil); err != nil {
+			return withExitCode(exitAuth, fmt.Errorf("wrong passphrase, or the export is damaged"))
+		}
+	}
+
+	upgraded, _, err := upgradeConfig(plaintext)
+	if err != nil {
+		return err
+	}
+	var imported Config
+	if err := json.Unmarshal(upgraded, &imported); err != nil {
+		return fmt.Errorf("failed to parse imported config: %w", err)
+	}
+
+	current, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Keep this machine's logins for anything the export has no secrets for
+	if imported.BlueskySession.AccessJwt == "" {
+		imported.BlueskySession = current.BlueskySession
+	}
+	if imported.MastodonSession.AccessToken == "" {
+		imported.MastodonSession = current.MastodonSession
+	}
+	if imported.MatrixSession.AccessToken == "" {
+		imported.MatrixSession = current.MatrixSession
+	}
+	if imported.RedditSession.ClientSecret == "" {
+		imported.RedditSession = current.RedditSession
+	}
+	if imported.LemmySession.JWT == "" {
+		imported.LemmySession = current.LemmySession
+	}
+	if imported.PixelfedSession.AccessToken == "" {
+		imported.PixelfedSession = current.PixelfedSession
+	}
+	if imported.WordPressSession.AppPassword == "" {
+		imported.WordPressSession = current.WordPressSession
+	}
+	if imported.GhostSession.AdminAPIKey == "" {
+		imported.GhostSession = current.GhostSession
+	}
+	if imported.DevToSession.APIKey == "" {
+		imported.DevToSession = current.DevToSession
+	}
+	if imported.AI.APIKey == "" {
+		imported.AI.APIKey = current.AI.APIKey
+	}
+	if imported.Hooks.WebhookSecret == "" && imported.Hooks.Webhook == current.Hooks.Webhook {
+		imported.Hooks.WebhookSecret = current.Hooks.WebhookSecret
+	}
+
+	configDir, err := getConfigDir()
+	if err != nil {
+		return err
+	}
+	configFile := filepath.Join(configDir, "config.json")
+	if existing, err := os.ReadFile(configFile); err == nil {
+		if err := os.WriteFile(configFile+".bak", existing, 0600); err != nil {
+			return fmt.Errorf("failed to back up config file: %w", err)
+		}
+		infof("Backed up the previous config to %s.bak\n", configFile)
+	}
+
+	if err := saveConfig(&imported); err != nil {
+		return err
+	}
+	infof("Imported the config into %s\n", configFile)
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// How long to wait for another shout process to release a config lock
+const configLockTimeout = 30 * time.Second
+
+// lockConfigFile takes the advisory lock on <name>.lock in the config
+// directory, so shout processes running at the same time, like parallel CI
+// jobs, take turns at what it guards. It waits up to configLockTimeout and
+// returns the function that releases the lock. The OS releases it too if the
+// process dies.
+func lockConfigFile(name string) (func(), error) {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	return lockPath(filepath.Join(configDir, name+".lock"), configLockTimeout)
+}
+
+// lockPath takes the advisory lock on the file at path, waiting up to
+// timeout. With a timeout of zero it tries once, and returns a nil function
+// if another process holds the lock.
+func lockPath(path string, timeout time.Duration) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file: %w", err)
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		locked, err := tryLockFile(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		if locked {
+			return func() {
+				unlockFile(f)
+				f.Close()
+			}, nil
+		}
+		if timeout == 0 {
+			f.Close()
+			return nil, nil
+		}
+		if time.Now().After(deadline) {
+			f.Close()
+			return nil, fmt.Errorf("another shout process has held %s for over %s", path, timeout)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// writeFileAtomic replaces path with data so that it's never seen half
+// written, even after a crash or power cut: the data goes to a temporary file
+// next to it, which is synced to disk and then renamed over path
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// Sync the directory too, so the rename itself survives a crash. Windows
+	// can't open directories for this, and doesn't need to.
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// readSavedConfig reads config.json as it is now, upgraded to the current
+// version without rewriting it
+func readSavedConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, fmt.Errorf("failed to read config file: %w", err)
+	}
+	upgraded, _, err := upgradeConfig(data)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(upgraded, &config); err != nil {
+		return config, fmt.Errorf("failed to parse config file: %w", err)
+	}
+	return config, nil
+}
+
+// configKeys splits a config's JSON into its top-level keys
+func configKeys(config Config) (map[string]json.RawMessage, error) {
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	var keys map[string]json.RawMessage
+	err = json.Unmarshal(data, &keys)
+	return keys, err
+}
+
+// mergeConfigChanges applies the top-level keys that changed between loaded
+// and saved to onDisk, so a process saving its config keeps what others
+// saved since it was loaded, such as tokens another run refreshed
+func mergeConfigChanges(loaded, saved, onDisk Config) (Config, error) {
+	before, err := configKeys(loaded)
+	if err != nil {
+		return saved, err
+	}
+	after, err := configKeys(saved)
+	if err != nil {
+		return saved, err
+	}
+	merged, err := configKeys(onDisk)
+	if err != nil {
+		return saved, err
+	}
+
+	for key, value := range after {
+		if !bytes.Equal(value, before[key]) {
+			merged[key] = value
+		}
+	}
+	// Keys left out of saved were cleared since loading
+	for key := range before {
+		if _, ok := after[key]; !ok {
+			delete(merged, key)
+		}
+	}
+
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return saved, err
+	}
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return saved, err
+	}
+	return config, nil
+}
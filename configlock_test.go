@@ -0,0 +1,192 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// useTempConfigDir points the config directory at a new temporary directory
+// for the rest of the test
+func useTempConfigDir(t *testing.T) string {
+	t.Helper()
+	homedir.DisableCache = true
+	t.Cleanup(func() { homedir.DisableCache = false })
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	return filepath.Join(home, ".config", "shout")
+}
+
+func TestMergeConfigChanges(t *testing.T) {
+	bluesky := func(token string) BlueskySession {
+		return BlueskySession{Handle: "me.bsky.social", AccessJwt: token}
+	}
+	mastodon := func(token string) MastodonSession {
+		return MastodonSession{InstanceURL: "https://mastodon.social", AccessToken: token}
+	}
+
+	tests := []struct {
+		name   string
+		loaded Config
+		saved  Config
+		onDisk Config
+		want   Config
+	}{
+		{
+			name:   "a changed key is written",
+			loaded: Config{BlueskySession: bluesky("old")},
+			saved:  Config{BlueskySession: bluesky("ours")},
+			onDisk: Config{BlueskySession: bluesky("old")},
+			want:   Config{BlueskySession: bluesky("ours")},
+		},
+		{
+			name:   "an unchanged key keeps what another process saved",
+			loaded: Config{BlueskySession: bluesky("old"), MastodonSession: mastodon("old")},
+			saved:  Config{BlueskySession: bluesky("ours"), MastodonSession: mastodon("old")},
+			onDisk: Config{BlueskySession: bluesky("old"), MastodonSession: mastodon("theirs")},
+			want:   Config{BlueskySession: bluesky("ours"), MastodonSession: mastodon("theirs")},
+		},
+		{
+			name:   "a key both changed ends up with ours",
+			loaded: Config{BlueskySession: bluesky("old")},
+			saved:  Config{BlueskySession: bluesky("ours")},
+			onDisk: Config{BlueskySession: bluesky("theirs")},
+			want:   Config{BlueskySession: bluesky("ours")},
+		},
+		{
+			name:   "a key cleared since loading is removed",
+			loaded: Config{PostsPerHour: 10, DuplicateWindow: "1h"},
+			saved:  Config{DuplicateWindow: "1h"},
+			onDisk: Config{PostsPerHour: 10, DuplicateWindow: "2h"},
+			want:   Config{DuplicateWindow: "2h"},
+		},
+		{
+			name:   "a key another process added is kept",
+			loaded: Config{},
+			saved:  Config{PostsPerHour: 5},
+			onDisk: Config{Defaults: map[string]ServiceDefaults{"bluesky": {Signature: "sig"}}},
+			want:   Config{PostsPerHour: 5, Defaults: map[string]ServiceDefaults{"bluesky": {Signature: "sig"}}},
+		},
+		{
+			name:   "nothing changed leaves the disk alone",
+			loaded: Config{PostsPerHour: 5},
+			saved:  Config{PostsPerHour: 5},
+			onDisk: Config{PostsPerHour: 7, MastodonSession: mastodon("theirs")},
+			want:   Config{PostsPerHour: 7, MastodonSession: mastodon("theirs")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeConfigChanges(tt.loaded, tt.saved, tt.onDisk)
+			if err != nil {
+				t.Fatalf("mergeConfigChanges: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeConfigChanges() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLockPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.lock")
+
+	unlock, err := lockPath(path, 0)
+	if err != nil || unlock == nil {
+		t.Fatalf("lockPath() = %v, want the lock", err)
+	}
+	if again, err := lockPath(path, 0); err != nil || again != nil {
+		t.Errorf("lockPath() while held = %v, want no lock and no error", err)
+	}
+	unlock()
+
+	again, err := lockPath(path, 0)
+	if err != nil || again == nil {
+		t.Fatalf("lockPath() after unlock = %v, want the lock", err)
+	}
+	again()
+}
+
+func TestSaveConfigConcurrentTokenRefreshes(t *testing.T) {
+	useTempConfigDir(t)
+	if err := saveConfig(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every process loads the config before any of them saves, then each
+	// refreshes the token of a different service
+	refreshes := []func(*Config){
+		func(c *Config) { c.BlueskySession.AccessJwt = "bluesky-token" },
+		func(c *Config) { c.MastodonSession.AccessToken = "mastodon-token" },
+		func(c *Config) { c.MatrixSession.AccessToken = "matrix-token" },
+		func(c *Config) { c.RedditSession.AccessToken = "reddit-token" },
+		func(c *Config) { c.LemmySession.JWT = "lemmy-token" },
+		func(c *Config) { c.PixelfedSession.AccessToken = "pixelfed-token" },
+		func(c *Config) { c.DevToSession.APIKey = "devto-key" },
+	}
+	configs := make([]*Config, len(refreshes))
+	for i := range refreshes {
+		config, err := loadConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		configs[i] = config
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(refreshes))
+	for i, refresh := range refreshes {
+		wg.Add(1)
+		go func(i int, refresh func(*Config)) {
+			defer wg.Done()
+			refresh(configs[i])
+			errs[i] = saveConfig(configs[i])
+		}(i, refresh)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("saveConfig: %v", err)
+		}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Config{}
+	for _, refresh := range refreshes {
+		refresh(want)
+	}
+	tokens := map[string][2]string{
+		"bluesky":  {config.BlueskySession.AccessJwt, want.BlueskySession.AccessJwt},
+		"mastodon": {config.MastodonSession.AccessToken, want.MastodonSession.AccessToken},
+		"matrix":   {config.MatrixSession.AccessToken, want.MatrixSession.AccessToken},
+		"reddit":   {config.RedditSession.AccessToken, want.RedditSession.AccessToken},
+		"lemmy":    {config.LemmySession.JWT, want.LemmySession.JWT},
+		"pixelfed": {config.PixelfedSession.AccessToken, want.PixelfedSession.AccessToken},
+		"devto":    {config.DevToSession.APIKey, want.DevToSession.APIKey},
+	}
+	for service, token := range tokens {
+		if token[0] != token[1] {
+			t.Errorf("%s token = %q after the saves, want %q", service, token[0], token[1])
+		}
+	}
+
+	// A later save from the same process only writes what it changed since
+	configs[0].PostsPerHour = 3
+	if err := saveConfig(configs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if config, err = loadConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if config.PostsPerHour != 3 || config.MastodonSession.AccessToken != "mastodon-token" {
+		t.Errorf("second save gave posts_per_hour %d and mastodon token %q, want 3 and %q",
+			config.PostsPerHour, config.MastodonSession.AccessToken, "mastodon-token")
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// configPath is the file given with --config, or - for stdin
+var configPath string
+
+// configOverride holds the config given with --config or SHOUT_CONFIG_JSON,
+// for containers without a writable home directory. It replaces config.json
+// and config.toml, and changes to it, such as refreshed tokens, only last
+// until shout exits.
+var (
+	configOverride   []byte
+	configOverrideMu sync.Mutex
+)
+
+// readConfigOverride reads the config from --config or SHOUT_CONFIG_JSON, if either is given
+func readConfigOverride() error {
+	var data []byte
+	var err error
+	source := configPath
+	switch {
+	case configPath == "-":
+		source = "stdin"
+		data, err = io.ReadAll(os.Stdin)
+	case configPath != "":
+		data, err = os.ReadFile(configPath)
+	case os.Getenv("SHOUT_CONFIG_JSON") != "":
+		source = "SHOUT_CONFIG_JSON"
+		data = []byte(os.Getenv("SHOUT_CONFIG_JSON"))
+	default:
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("the config from %s isn't a JSON object: %w", source, err))
+	}
+	configOverride = data
+	return nil
+}
+
+// loadConfigOverride parses the config given with --config or SHOUT_CONFIG_JSON
+func loadConfigOverride() (*Config, error) {
+	configOverrideMu.Lock()
+	data := configOverride
+	configOverrideMu.Unlock()
+
+	upgraded, _, err := upgradeConfig(data)
+	if err != nil {
+		return nil, err
+	}
+	var config Config
+	if err := json.Unmarshal(upgraded, &config); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	return &config, nil
+}
+
+// saveConfigOverride keeps changes to a config given with --config or
+// SHOUT_CONFIG_JSON for the rest of the run, without writing them anywhere
+func saveConfigOverride(config *Config) error {
+	config.Version = len(configMigrations)
+	data, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	configOverrideMu.Lock()
+	configOverride = data
+	configOverrideMu.Unlock()
+	return nil
+}
+
+// storeDir returns the directory holding shout.db. That's the config
+// directory, unless the config came from --config or SHOUT_CONFIG_JSON and
+// the config directory can't be written, in which case a temporary directory
+// is used.
+func storeDir() (string, error) {
+	configDir, err := getConfigDir()
+	if configOverride == nil {
+		return configDir, err
+	}
+
+	if err == nil {
+		probe, probeErr := os.CreateTemp(configDir, ".shout-write-test")
+		if probeErr == nil {
+			probe.Close()
+			os.Remove(probe.Name())
+			return configDir, nil
+		}
+	}
+
+	dir := filepath.Join(os.TempDir(), fmt.Sprintf("shout-%d", os.Getuid()))
+	if activeProfile != "" {
+		dir = filepath.Join(dir, "profiles", activeProfile)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create a directory for the store: %w", err)
+	}
+	return dir, nil
+}
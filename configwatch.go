@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// How often the daemon checks the config files for changes
+const configWatchInterval = 2 * time.Second
+
+// configWatcher notices edits to the config files that change what the
+// daemon keeps in memory: the schedules, feeds, auto-replies, and default
+// services. Sessions are read for each post, so it ignores the tokens shout
+// saves when it refreshes them.
+type configWatcher struct {
+	stamp    string
+	settings string
+}
+
+// newConfigWatcher starts watching from the config as it is now
+func newConfigWatcher() *configWatcher {
+	w := &configWatcher{}
+	w.reset()
+	return w
+}
+
+// configFilesStamp sums up the size and modification time of config.json and
+// config.toml, which change whenever either file is written
+func configFilesStamp() string {
+	configDir, err := getConfigDir()
+	if err != nil {
+		return ""
+	}
+	var stamp string
+	for _, name := range []string{"config.json", settingsFileName} {
+		if info, err := os.Stat(filepath.Join(configDir, name)); err == nil {
+			stamp += fmt.Sprintf("%s:%d:%d;", name, info.Size(), info.ModTime().UnixNano())
+		}
+	}
+	return stamp
+}
+
+// daemonSettings returns the parts of the config the daemon keeps in memory
+func daemonSettings(config *Config) string {
+	data, _ := json.Marshal(struct {
+		Schedules      []Schedule
+		Feeds          []Feed
+		AutoReply      AutoReplyConfig
+		DefaultService string
+	}{config.Schedules, config.Feeds, config.AutoReply, config.DefaultService})
+	return string(data)
+}
+
+// reset records the config as it is now, after the daemon has loaded it
+func (w *configWatcher) reset() {
+	w.stamp = configFilesStamp()
+	if config, err := loadConfig(); err == nil {
+		w.settings = daemonSettings(config)
+	}
+}
+
+// changed reports whether the daemon's settings changed since the last check
+func (w *configWatcher) changed() bool {
+	// --config and SHOUT_CONFIG_JSON are read once, so there's nothing to watch
+	if configOverride != nil {
+		return false
+	}
+	stamp := configFilesStamp()
+	if stamp == w.stamp {
+		return false
+	}
+	w.stamp = stamp
+
+	config, err := loadConfig()
+	if err != nil {
+		// Perhaps an editor is halfway through saving it; the next write is checked again
+		daemonLogf("The config changed but can't be read, so it isn't reloaded: %v\n", err)
+		return false
+	}
+	settings := daemonSettings(config)
+	if settings == w.settings {
+		return false
+	}
+	w.settings = settings
+	return true
+}
+
+// acknowledgeReloads keeps SIGHUP, which would otherwise stop the process,
+// from stopping servers that read the config for each request anyway
+func acknowledgeReloads() {
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			infof("The config is read for each post, so changes to it already apply\n")
+		}
+	}()
+}
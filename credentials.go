@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// CredentialSource tells shout how to log in to a service without storing the
+// secret in the config. SecretCommand is run at auth time and its first line of
+// output is used as the app password (Bluesky), access token (Mastodon, Matrix, Pixelfed), password (Reddit, Lemmy), application password (WordPress), or API key (Ghost, dev.to).
+type CredentialSource struct {
+	// Identifier is the Bluesky handle or email, the Mastodon or Pixelfed instance or Matrix homeserver, the Reddit username, the Lemmy account as user@instance, or the WordPress or Ghost site
+	Identifier    string `json:"identifier,omitempty" toml:"identifier"`
+	SecretCommand string `json:"secret_command,omitempty" toml:"secret_command"`
+}
+
+// shellCommand returns a command line to run through the platform's shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("sh", "-c", command)
+}
+
+// runSecretCommand runs a command through the shell and returns the first line of its output
+func runSecretCommand(command string) (string, error) {
+	cmd := shellCommand(command)
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+
+	secret, _, _ := strings.Cut(string(out), "\n")
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", fmt.Errorf("secret command printed nothing")
+	}
+	return secret, nil
+}
+
+// configuredCredentials returns a service's identifier and secret from its
+// credential source in the config, falling back to the given environment
+// variables. ok is false if neither provides both.
+func configuredCredentials(config *Config, service, identifierEnv, secretEnv string) (identifier, secret string, ok bool, err error) {
+	if source, found := config.Credentials[service]; found && source.Identifier != "" && source.SecretCommand != "" {
+		secret, err := runSecretCommand(source.SecretCommand)
+		if err != nil {
+			return "", "", false, err
+		}
+		return source.Identifier, secret, true, nil
+	}
+
+	identifier, secret = os.Getenv(identifierEnv), os.Getenv(secretEnv)
+	if identifier != "" && secret != "" {
+		return identifier, secret, true, nil
+	}
+
+	return "", "", false, nil
+}
+
+// loginBlueskyNonInteractive creates a new Bluesky session from configured
+// credentials. ok is false if no credentials are configured.
+func loginBlueskyNonInteractive(config *Config) (ok bool, err error) {
+	identifier, appPassword, ok, err := configuredCredentials(config, "bluesky", "BLUESKY_IDENTIFIER", "BLUESKY_APP_PASSWORD")
+	if err != nil || !ok {
+		return false, err
+	}
+	warnIfMainPassword(appPassword)
+
+	authResult, err := authenticateWithCredentials(identifier, appPassword)
+	if err != nil {
+		return true, err
+	}
+
+	return true, saveBlueskySession(config, identifier, authResult)
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronMacros are the @ shorthands accepted in place of a cron expression
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var (
+	cronMonthNames = []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}
+	cronDayNames   = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+)
+
+// cronSchedule is a parsed five-field cron expression (minute, hour, day of
+// month, month, day of week), or a fixed interval from @every
+type cronSchedule struct {
+	minute, hour, dom, month, dow map[int]bool
+
+	// Cron treats day of month and day of week as alternatives when both are restricted
+	domRestricted, dowRestricted bool
+
+	// Schedules for set hours run once in the hour the clocks go back, not twice
+	hourRestricted bool
+
+	every time.Duration
+}
+
+// parseCron parses a cron expression such as "*/15 9-17 * * mon-fri",
+// an @daily style macro, or "@every 90m"
+func parseCron(expr string) (*cronSchedule, error) {
+	expr = strings.TrimSpace(expr)
+	if interval, ok := strings.CutPrefix(expr, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(interval))
+		if err != nil || every < time.Minute {
+			return nil, fmt.Errorf("invalid cron expression %q: @every needs a duration of at least 1m", expr)
+		}
+		return &cronSchedule{every: every}, nil
+	}
+	if macro, ok := cronMacros[strings.ToLower(expr)]; ok {
+		expr = macro
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields (minute hour day-of-month month day-of-week)", expr)
+	}
+
+	var s cronSchedule
+	var err error
+	if s.minute, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("invalid minute in %q: %w", expr, err)
+	}
+	if s.hour, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("invalid hour in %q: %w", expr, err)
+	}
+	if s.dom, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("invalid day of month in %q: %w", expr, err)
+	}
+	if s.month, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("invalid month in %q: %w", expr, err)
+	}
+	if s.dow, err = parseCronField(fields[4], 0, 7, cronDayNames); err != nil {
+		return nil, fmt.Errorf("invalid day of week in %q: %w", expr, err)
+	}
+
+	// 7 is another name for Sunday
+	if s.dow[7] {
+		s.dow[0] = true
+	}
+	s.domRestricted = fields[2] != "*"
+	s.dowRestricted = fields[4] != "*"
+	s.hourRestricted = fields[1] != "*"
+	return &s, nil
+}
+
+// parseCronField parses a comma-separated list of values, ranges (a-b), and
+// steps (*/n or a-b/n). names, if given, are accepted in place of numbers,
+// the first name standing for min.
+func parseCronField(field string, min, max int, names []string) (map[int]bool, error) {
+	value := func(s string) (int, error) {
+		for i, name := range names {
+			if strings.EqualFold(s, name) {
+				return min + i, nil
+			}
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < min || n > max {
+			return 0, fmt.Errorf("%q is not between %d and %d", s, min, max)
+		}
+		return n, nil
+	}
+
+	set := make(map[int]bool)
+	for _, part := range strings.Split(field, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+
+		lo, hi := min, max
+		switch {
+		case span == "*":
+		case strings.Contains(span, "-"):
+			from, to, _ := strings.Cut(span, "-")
+			var err error
+			if lo, err = value(from); err != nil {
+				return nil, err
+			}
+			if hi, err = value(to); err != nil {
+				return nil, err
+			}
+			if lo > hi {
+				return nil, fmt.Errorf("range %q runs backwards", span)
+			}
+		default:
+			n, err := value(span)
+			if err != nil {
+				return nil, err
+			}
+			lo = n
+			if !hasStep {
+				hi = n
+			}
+		}
+
+		for n := lo; n <= hi; n += step {
+			set[n] = true
+		}
+	}
+	return set, nil
+}
+
+// matchesDay reports whether the schedule runs on t's day
+func (s *cronSchedule) matchesDay(t time.Time) bool {
+	dom, dow := s.dom[t.Day()], s.dow[int(t.Weekday())]
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// repeatedClockTime reports whether the clock showed t's time once already
+// that day, before it was turned back for the end of daylight saving time
+func repeatedClockTime(t time.Time) bool {
+	_, offset := t.Zone()
+	_, before := t.Add(-3 * time.Hour).Zone()
+	if before <= offset {
+		return false
+	}
+	earlier := t.Add(-time.Duration(before-offset) * time.Second)
+	return earlier.Hour() == t.Hour() && earlier.Minute() == t.Minute()
+}
+
+// next returns the first time after t that the schedule runs, in t's location
+func (s *cronSchedule) next(t time.Time) time.Time {
+	if s.every > 0 {
+		return t.Truncate(time.Minute).Add(s.every)
+	}
+
+	t = t.Truncate(time.Minute).Add(time.Minute)
+
+	// Anything that can run does so within a few years (Feb 29 at worst), while
+	// dates such as Feb 30 never come, in which case the zero time is returned
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !s.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hour[t.Hour()]:
+			// Moving on in real time, rather than by the clock, keeps the
+			// first of two 2:00s when the clocks go back
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+		case !s.minute[t.Minute()], s.hourRestricted && repeatedClockTime(t):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
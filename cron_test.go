@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Skipf("time zone %s isn't available: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseCronErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * 32 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+		"@every 30s",
+		"@every soon",
+	}
+	for _, expr := range tests {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	utc := func(year int, month time.Month, day, hour, minute int) time.Time {
+		return time.Date(year, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"every minute", "* * * * *", utc(2026, 1, 1, 12, 0), utc(2026, 1, 1, 12, 1)},
+		{"seconds are dropped", "* * * * *", utc(2026, 1, 1, 12, 0).Add(59 * time.Second), utc(2026, 1, 1, 12, 1)},
+		{"step", "*/15 * * * *", utc(2026, 1, 1, 12, 1), utc(2026, 1, 1, 12, 15)},
+		{"range with step", "10-40/15 * * * *", utc(2026, 1, 1, 12, 26), utc(2026, 1, 1, 12, 40)},
+		{"list", "0 9,17 * * *", utc(2026, 1, 1, 9, 0), utc(2026, 1, 1, 17, 0)},
+		{"next day", "30 8 * * *", utc(2026, 1, 1, 9, 0), utc(2026, 1, 2, 8, 30)},
+		{"month names", "0 0 1 mar *", utc(2026, 1, 15, 0, 0), utc(2026, 3, 1, 0, 0)},
+		{"end of year", "0 0 1 1 *", utc(2026, 12, 31, 23, 59), utc(2027, 1, 1, 0, 0)},
+		{"weekdays by name", "0 9 * * mon-fri", utc(2026, 10, 16, 10, 0), utc(2026, 10, 19, 9, 0)}, // Friday to Monday
+		{"7 is Sunday", "0 9 * * 7", utc(2026, 10, 16, 10, 0), utc(2026, 10, 18, 9, 0)},
+		{"0 is Sunday", "0 9 * * 0", utc(2026, 10, 16, 10, 0), utc(2026, 10, 18, 9, 0)},
+		{"@daily", "@daily", utc(2026, 1, 1, 0, 0), utc(2026, 1, 2, 0, 0)},
+		{"@weekly runs on Sunday", "@weekly", utc(2026, 10, 14, 0, 0), utc(2026, 10, 18, 0, 0)},
+		{"@every", "@every 90m", utc(2026, 1, 1, 12, 0).Add(30 * time.Second), utc(2026, 1, 1, 13, 30)},
+		{"leap day", "0 0 29 2 *", utc(2026, 3, 1, 0, 0), utc(2028, 2, 29, 0, 0)},
+		{"day that never comes", "0 0 30 2 *", utc(2026, 1, 1, 0, 0), time.Time{}},
+		{"31st skips short months", "0 0 31 * *", utc(2026, 4, 1, 0, 0), utc(2026, 5, 31, 0, 0)},
+
+		// With both day fields restricted, either one matching is enough
+		{"day of month or week: the 13th comes first", "0 0 13 * fri", utc(2026, 10, 10, 0, 0), utc(2026, 10, 13, 0, 0)},
+		{"day of month or week: Friday comes first", "0 0 13 * fri", utc(2026, 10, 14, 0, 0), utc(2026, 10, 16, 0, 0)},
+		{"day of month alone", "0 0 13 * *", utc(2026, 10, 14, 0, 0), utc(2026, 11, 13, 0, 0)},
+		{"day of week alone", "0 0 * * fri", utc(2026, 10, 17, 0, 0), utc(2026, 10, 23, 0, 0)},
+		{"restricted by step counts as restricted", "0 0 */10 * mon", utc(2026, 10, 11, 12, 0), utc(2026, 10, 12, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", tt.expr, err)
+			}
+			if got := schedule.next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.from, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCronNextDST(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, berlin)
+	}
+	// On 2026-10-25 the clocks go back from 03:00 CEST to 02:00 CET, so 02:30 happens twice
+	firstHalfPast2 := time.Date(2026, 10, 25, 0, 30, 0, 0, time.UTC)
+	secondHalfPast2 := time.Date(2026, 10, 25, 1, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		// On 2026-03-29 the clocks go forward from 02:00 to 03:00, so there's no 02:30
+		{"a time skipped in spring waits a day", "30 2 * * *", at(3, 29, 0, 0), at(3, 30, 2, 30)},
+		{"hourly skips the missing hour", "0 * * * *", at(3, 29, 1, 30), at(3, 29, 3, 0)},
+		{"times after the change keep their wall clock", "0 9 * * *", at(3, 28, 10, 0), at(3, 29, 9, 0)},
+		{"a repeated time runs the first time", "30 2 * * *", at(10, 25, 0, 0), firstHalfPast2},
+		{"a repeated time doesn't run again", "30 2 * * *", firstHalfPast2, at(10, 26, 2, 30)},
+		{"hourly runs in both repeated hours", "30 * * * *", firstHalfPast2, secondHalfPast2},
+		{"@every counts real time", "@every 1h", firstHalfPast2, secondHalfPast2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schedule, err := parseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("parseCron(%q): %v", tt.expr, err)
+			}
+			if got := schedule.next(tt.from.In(berlin)); !got.Equal(tt.want) {
+				t.Errorf("next(%s) = %s, want %s", tt.from.In(berlin), got, tt.want.In(berlin))
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"text/tabwriter"
+)
+
+// delivery is the outcome of delivering a post or thread to one service
+type delivery struct {
+	Service string
+	Results []*PostResult
+	Queued  bool
+	Err     error
+}
+
+// deliverAll delivers each service's thread at the same time, returning the
+// outcomes in the order of services
+func deliverAll(services []string, threads map[string][]*Post) []delivery {
+	deliveries := make([]delivery, len(services))
+	var wg sync.WaitGroup
+	for i, service := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, queued, err := deliverThread(service, threads[service])
+			deliveries[i] = delivery{Service: service, Results: results, Queued: queued, Err: err}
+		}()
+	}
+	wg.Wait()
+	return deliveries
+}
+
+// printDeliverySummary prints a table of the outcome for each service, or a
+// sentence for each in plain mode
+func printDeliverySummary(deliveries []delivery) {
+	if plain {
+		for _, d := range deliveries {
+			switch {
+			case d.Err != nil:
+				fmt.Printf("Failed to post to %s: %v\n", serviceNames[d.Service], d.Err)
+			case d.Queued:
+				fmt.Printf("Queued for %s, to be sent when the service can be reached\n", serviceNames[d.Service])
+			default:
+				fmt.Printf("Posted to %s: %s\n", serviceNames[d.Service], d.Results[0].URL)
+			}
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	// The statuses are all as wide as the heading, so the colors, which
+	// tabwriter would count as text, go in the last column with the details
+	fmt.Fprintln(w, "SERVICE\tSTATUS  DETAILS")
+	for _, d := range deliveries {
+		switch {
+		case d.Err != nil:
+			fmt.Fprintf(w, "%s\t%s  %v\n", serviceNames[d.Service], colorize(os.Stdout, styleError, "failed"), d.Err)
+		case d.Queued:
+			fmt.Fprintf(w, "%s\t%s  will be sent when the service can be reached\n", serviceNames[d.Service], colorize(os.Stdout, styleWarning, "queued"))
+		default:
+			fmt.Fprintf(w, "%s\t%s  %s\n", serviceNames[d.Service], colorize(os.Stdout, styleSuccess, "posted"), d.Results[0].URL)
+		}
+	}
+	w.Flush()
+}
+
+// deliveryErrors combines the failures of deliveries into one error, or returns nil
+func deliveryErrors(deliveries []delivery) error {
+	var errs []error
+	for _, d := range deliveries {
+		if d.Err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", serviceNames[d.Service], d.Err))
+		}
+	}
+	return errors.Join(errs...)
+}
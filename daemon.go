@@ -0,0 +1,474 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Schedule is a job that shout daemon runs on a cron schedule
+type Schedule struct {
+	Name string `json:"name" toml:"name"`
+	Cron string `json:"cron" toml:"cron"`
+
+	// Action is "post" to post Text to the To services, "flush-queue" to
+	// deliver queued posts, "feeds" to announce new feed items, or "command"
+	// to run Command through the shell
+	Action string `json:"action" toml:"action"`
+
+	// Text is a post template: {{now}}, {{env "NAME"}}, and {{.name}}, the schedule's name, are available
+	Text    string `json:"text,omitempty" toml:"text"`
+	To      string `json:"to,omitempty" toml:"to"`
+	Command string `json:"command,omitempty" toml:"command"`
+
+	// Feed limits a feeds schedule to the feed with that name; empty means all of them
+	Feed string `json:"feed,omitempty" toml:"feed"`
+
+	// CatchUp runs the schedule once when the daemon starts if it missed
+	// any runs while the daemon was stopped
+	CatchUp bool `json:"catch_up,omitempty" toml:"catch_up"`
+}
+
+// Missed runs are recorded one by one up to this many per schedule, so a
+// frequent schedule left for a long time doesn't flood the run history
+const maxMissedRuns = 100
+
+// scheduledJob is a validated Schedule and the next time it runs
+type scheduledJob struct {
+	Schedule
+	cron     *cronSchedule
+	services []string
+	next     time.Time
+}
+
+// daemonLogf prints a timestamped line to the daemon's log, unless the log
+// file is stderr and already has it
+func daemonLogf(format string, args ...interface{}) {
+	logf(logInfo, format, args...)
+	if loggedToStderr(logInfo) {
+		return
+	}
+	fmt.Printf("%s "+format, append([]interface{}{time.Now().Format(time.RFC3339)}, args...)...)
+}
+
+// loadSchedules reads and checks the schedules from the config
+func loadSchedules() ([]*scheduledJob, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	var jobs []*scheduledJob
+	for i, schedule := range config.Schedules {
+		if schedule.Name == "" {
+			schedule.Name = fmt.Sprintf("schedule %d", i+1)
+		}
+
+		job := &scheduledJob{Schedule: schedule}
+		if job.cron, err = parseCron(schedule.Cron); err != nil {
+			return nil, fmt.Errorf("%s: %w", schedule.Name, err)
+		}
+		if job.cron.next(time.Now()).IsZero() {
+			return nil, fmt.Errorf("%s: %q never runs", schedule.Name, schedule.Cron)
+		}
+
+		switch schedule.Action {
+		case "post":
+			if schedule.Text == "" {
+				return nil, fmt.Errorf("%s: a post schedule needs text", schedule.Name)
+			}
+			if job.services, err = servicesFor(config, schedule.To); err != nil {
+				return nil, fmt.Errorf("%s: %w", schedule.Name, err)
+			}
+		case "flush-queue":
+		case "feeds":
+			if len(config.Feeds) == 0 {
+				return nil, fmt.Errorf("%s: a feeds schedule needs feeds in the config", schedule.Name)
+			}
+		case "command":
+			if schedule.Command == "" {
+				return nil, fmt.Errorf("%s: a command schedule needs a command", schedule.Name)
+			}
+		default:
+			return nil, fmt.Errorf("%s: unknown action %q, expected post, flush-queue, feeds, or command", schedule.Name, schedule.Action)
+		}
+
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// run carries out a scheduled job once
+func (j *scheduledJob) run() error {
+	switch j.Action {
+	case "post":
+		text, err := renderTemplate(j.Text, map[string]string{"name": j.Name})
+		if err != nil {
+			return err
+		}
+		return postText(j.services, text)
+
+	case "feeds":
+		return announceFeeds(j.Feed, false)
+
+	case "flush-queue":
+		delivered, err := flushQueue()
+		if delivered > 0 {
+			daemonLogf("Delivered %d queued post(s)\n", delivered)
+		}
+		if err != nil && (isNetworkError(err) || errors.Is(err, errQueueBusy)) {
+			return nil
+		}
+		return err
+
+	default:
+		cmd := shellCommand(j.Command)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return cmd.Run()
+	}
+}
+
+// recordRun adds a run to the history. The daemon keeps going if it can't.
+func recordRun(run ScheduleRun) {
+	store, err := openStore()
+	if err == nil {
+		err = store.AddRun(&run)
+		store.Close()
+	}
+	if err != nil {
+		daemonLogf("Failed to record the run of %s: %v\n", run.Schedule, err)
+	}
+}
+
+// missedRuns returns the times the job was due after after and before now,
+// up to maxMissedRuns of them
+func (j *scheduledJob) missedRuns(after, now time.Time) []time.Time {
+	var missed []time.Time
+	for t := j.cron.next(after); !t.IsZero() && t.Before(now) && len(missed) < maxMissedRuns; t = j.cron.next(t) {
+		missed = append(missed, t)
+	}
+	return missed
+}
+
+// reportMissed records runs that were due while nothing was running, and
+// says so in the log and a notification. With catchUp, the last of them is
+// left unrecorded and returned instead, to be run late.
+func (j *scheduledJob) reportMissed(missed []time.Time, catchUp bool) time.Time {
+	if len(missed) == 0 {
+		return time.Time{}
+	}
+	count := fmt.Sprint(len(missed))
+	if len(missed) == maxMissedRuns {
+		count = "at least " + count
+	}
+	daemonLogf("%s missed %s run(s), the first due at %s\n", j.Name, count, missed[0].Format(time.RFC3339))
+	notify("shout: scheduled job missed", fmt.Sprintf("%s missed %s run(s)", j.Name, count))
+
+	var late time.Time
+	if catchUp {
+		late, missed = missed[len(missed)-1], missed[:len(missed)-1]
+	}
+	for _, due := range missed {
+		recordRun(ScheduleRun{Schedule: j.Name, Cron: j.Cron, Due: due})
+	}
+	return late
+}
+
+// checkMissed looks for runs each job missed since its last recorded one,
+// while the daemon wasn't running. Jobs whose cron expression changed since
+// then are skipped, since their old runs say nothing about the new times.
+func checkMissed(jobs []*scheduledJob, now time.Time) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	last := make(map[*scheduledJob]*ScheduleRun)
+	for _, job := range jobs {
+		run, err := store.LastRun(job.Name)
+		if err != nil {
+			store.Close()
+			return fmt.Errorf("failed to read the run history: %w", err)
+		}
+		last[job] = run
+	}
+	store.Close()
+
+	for _, job := range jobs {
+		run := last[job]
+		if run == nil || run.Cron != job.Cron {
+			continue
+		}
+		if late := job.reportMissed(job.missedRuns(run.Due, now), job.CatchUp); !late.IsZero() {
+			daemonLogf("Catching up on %s\n", job.Name)
+			job.next = late
+		}
+	}
+	return nil
+}
+
+// postText posts text to each service with its config defaults, after
+// checking it against all of their limits. Posts to services that can't be
+// reached are queued.
+func postText(services []string, text string) error {
+	var posts []*Post
+	for _, service := range services {
+		post, err := applyConfigDefaults(service, Post{Text: text})
+		if err != nil {
+			return err
+		}
+		if err := checkThread(service, []*Post{post}); err != nil {
+			return fmt.Errorf("%s: %w", serviceNames[service], err)
+		}
+		posts = append(posts, post)
+	}
+
+	var failures []error
+	for i, service := range services {
+		if _, _, err := deliverThread(service, []*Post{posts[i]}); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", serviceNames[service], err))
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// scheduleNext sets when each job runs next, after now
+func scheduleNext(jobs []*scheduledJob, now time.Time) {
+	for _, job := range jobs {
+		if job.next.IsZero() || !job.next.After(now) {
+			job.next = job.cron.next(now)
+		}
+	}
+}
+
+func daemonCommand(args []string) error {
+	if len(args) > 0 && args[0] == "history" {
+		return daemonHistory(args[1:])
+	}
+
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	listen := fs.String("listen", "", "serve /healthz for health checks on this address, e.g. :9090")
+	withMetrics := fs.Bool("metrics", false, "also serve Prometheus metrics at /metrics on the --listen address")
+	fs.Parse(args)
+
+	if *withMetrics && *listen == "" {
+		return withExitCode(exitValidation, fmt.Errorf("--metrics needs a --listen address to serve them on"))
+	}
+
+	jobs, err := loadSchedules()
+	if err != nil {
+		return err
+	}
+	replier, err := loadAutoReplies()
+	if err != nil {
+		return err
+	}
+	if len(jobs) == 0 && replier == nil {
+		return fmt.Errorf("no schedules or auto-replies in the config; add some under \"schedules\" or \"auto_reply\"")
+	}
+
+	// Reload the schedules and auto-replies on SIGHUP, and when the config is edited
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	watcher := newConfigWatcher()
+	watchTicker := time.NewTicker(configWatchInterval)
+	defer watchTicker.Stop()
+
+	daemonHealth = &schedulerHealth{}
+	if *listen != "" {
+		if *withMetrics {
+			enableMetrics()
+		}
+		if err := startDaemonServer(*listen, *withMetrics); err != nil {
+			return err
+		}
+		daemonLogf("Serving health checks on %s/healthz\n", *listen)
+	}
+
+	scheduleNext(jobs, time.Now())
+	daemonLogf("Started with %d schedule(s)\n", len(jobs))
+	if err := checkMissed(jobs, time.Now()); err != nil {
+		daemonLogf("Couldn't check for missed runs: %v\n", err)
+	}
+
+	// Mentions are checked on a ticker of their own, which is stopped when
+	// there are no auto-replies
+	replyTicker := time.NewTicker(time.Hour)
+	replyTicker.Stop()
+	defer replyTicker.Stop()
+	startReplies := func() {
+		if replier == nil {
+			replyTicker.Stop()
+			return
+		}
+		var names []string
+		for _, service := range replier.services {
+			names = append(names, serviceNames[service])
+		}
+		daemonLogf("Checking %s mentions every %s\n", strings.Join(names, " and "), replier.interval)
+		replyTicker.Reset(replier.interval)
+		replier.check()
+	}
+	startReplies()
+
+	// reloadDaemon swaps in the schedules and auto-replies from the config,
+	// keeping the current ones if the new ones have a mistake
+	reloadDaemon := func() {
+		reloaded, err := loadSchedules()
+		if err != nil {
+			daemonLogf("Keeping the current schedules, reloading failed: %v\n", err)
+			return
+		}
+		reloadedReplier, err := loadAutoReplies()
+		if err != nil {
+			daemonLogf("Keeping the current schedules, reloading failed: %v\n", err)
+			return
+		}
+		jobs, replier = reloaded, reloadedReplier
+		scheduleNext(jobs, time.Now())
+		daemonLogf("Reloaded %d schedule(s)\n", len(jobs))
+		startReplies()
+	}
+
+	for {
+		// Sleep until the next job is due; a schedule that never runs has a zero next time
+		var due time.Time
+		for _, job := range jobs {
+			if !job.next.IsZero() && (due.IsZero() || job.next.Before(due)) {
+				due = job.next
+			}
+		}
+		wait := 24 * time.Hour
+		if !due.IsZero() {
+			wait = time.Until(due)
+		}
+		timer := time.NewTimer(wait)
+		daemonHealth.waiting(due)
+
+		select {
+		case <-timer.C:
+			now := time.Now()
+			for _, job := range jobs {
+				if job.next.IsZero() || job.next.After(now) {
+					continue
+				}
+				// Runs that came and went while the machine was asleep are missed too
+				job.reportMissed(job.missedRuns(job.next, now), false)
+
+				daemonLogf("Running %s\n", job.Name)
+				daemonHealth.runningJob(job.Name)
+				run := ScheduleRun{Schedule: job.Name, Cron: job.Cron, Due: job.next, RanAt: time.Now()}
+				if err := job.run(); err != nil {
+					daemonLogf("%s failed: %v\n", job.Name, err)
+					notify("shout: scheduled job failed", fmt.Sprintf("%s: %v", job.Name, err))
+					run.Error = err.Error()
+				}
+				recordRun(run)
+			}
+			scheduleNext(jobs, time.Now())
+
+		case <-replyTicker.C:
+			timer.Stop()
+			replier.check()
+
+		case <-watchTicker.C:
+			timer.Stop()
+			if watcher.changed() {
+				daemonLogf("The config changed, reloading\n")
+				reloadDaemon()
+			}
+
+		case <-reload:
+			timer.Stop()
+			reloadDaemon()
+			watcher.reset()
+
+		case <-rootCtx.Done():
+			timer.Stop()
+			daemonLogf("Stopping\n")
+			return nil
+		}
+	}
+}
+
+// startDaemonServer listens on addr and serves the health checks, and the
+// metrics if they're turned on, in the background until rootCtx is cancelled
+func startDaemonServer(addr string, withMetrics bool) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthHandler)
+	mux.HandleFunc("GET /healthz/live", healthHandler)
+	if withMetrics {
+		mux.HandleFunc("GET /metrics", metricsHandler)
+	}
+	server := &http.Server{Handler: mux}
+	go func() {
+		<-rootCtx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), interruptGracePeriod)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			daemonLogf("The health check server stopped: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// daemonHistory lists the schedules' recent runs, including missed ones
+func daemonHistory(args []string) error {
+	fs := flag.NewFlagSet("daemon history", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "how many runs to show")
+	name := fs.String("schedule", "", "only show runs of the schedule with this name")
+	missedOnly := fs.Bool("missed", false, "only show missed runs, and exit with an error if there are any")
+	parseFlags(fs, args)
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	runs, err := store.RecentRuns(*limit, func(run ScheduleRun) bool {
+		return (*name == "" || run.Schedule == *name) && (!*missedOnly || run.RanAt.IsZero())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read the run history: %w", err)
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded.")
+		return nil
+	}
+
+	missed := 0
+	for _, run := range runs {
+		status := "ok"
+		switch {
+		case run.RanAt.IsZero():
+			status = "missed"
+			missed++
+		case run.Error != "":
+			status = "failed: " + run.Error
+		case run.RanAt.Sub(run.Due) > time.Minute:
+			status = fmt.Sprintf("ran %s late", run.RanAt.Sub(run.Due).Round(time.Minute))
+		}
+		fmt.Printf("%s\t%s\t%s\n", run.Due.Local().Format("2006-01-02 15:04"), run.Schedule, status)
+	}
+	if *missedOnly && missed > 0 {
+		return fmt.Errorf("%d missed run(s)", missed)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ServiceDefaults are per-service settings applied to every post unless a flag overrides them
+type ServiceDefaults struct {
+	Language     string `json:"language,omitempty" toml:"language"`
+	Visibility   string `json:"visibility,omitempty" toml:"visibility"`
+	Signature    string `json:"signature,omitempty" toml:"signature"`
+	LinkCards    *bool  `json:"link_cards,omitempty" toml:"link_cards"` // nil means on
+	ReplyControl string `json:"reply_control,omitempty" toml:"reply_control"`
+	Overflow     string `json:"overflow,omitempty" toml:"overflow"`
+	Subreddit    string `json:"subreddit,omitempty" toml:"subreddit"`
+	Community    string `json:"community,omitempty" toml:"community"`
+}
+
+// replyControls lists the accepted --reply-control values
+var replyControls = map[string]bool{
+	"everyone":  true,
+	"mentioned": true,
+	"following": true,
+	"nobody":    true,
+}
+
+// validate checks the visibility and reply control values
+func (d ServiceDefaults) validate() error {
+	if d.Visibility != "" {
+		if _, ok := mastodonVisibilities[d.Visibility]; !ok {
+			return fmt.Errorf("unknown visibility %q, expected public, unlisted, followers, or direct", d.Visibility)
+		}
+	}
+	if d.ReplyControl != "" && !replyControls[d.ReplyControl] {
+		return fmt.Errorf("unknown reply control %q, expected everyone, mentioned, following, or nobody", d.ReplyControl)
+	}
+	if d.Overflow != "" && !overflowStrategies[d.Overflow] {
+		return fmt.Errorf("unknown overflow strategy %q, expected fail, truncate, or thread", d.Overflow)
+	}
+	return nil
+}
+
+// fediverseMentionPattern matches @user and @user@instance mentions, which
+// address a direct post on Mastodon
+var fediverseMentionPattern = regexp.MustCompile(`(?:^|[\s(])@[A-Za-z0-9_]+(?:@[A-Za-z0-9.-]+\.[A-Za-z]{2,})?(?:$|[^A-Za-z0-9_@.-]|\.(?:$|\s))`)
+
+// checkVisibility checks that a direct post goes only where it stays
+// private: to Mastodon or Pixelfed, addressed to the accounts it mentions
+func checkVisibility(service string, post *Post) error {
+	if post.Visibility != "direct" {
+		return nil
+	}
+	if service != "mastodon" && service != "pixelfed" {
+		return withExitCode(exitValidation, fmt.Errorf("%s has no direct posts, so this post would be public there. Leave %s out of --to, or use 'shout dm' for Bluesky", serviceNames[service], service))
+	}
+	if !fediverseMentionPattern.MatchString(post.Text) {
+		return withExitCode(exitValidation, fmt.Errorf("a direct post is only seen by the accounts it mentions, and this one mentions none. Add someone like @alice@mastodon.social"))
+	}
+	return nil
+}
+
+// postFlags registers the flags that override ServiceDefaults
+type postFlags struct {
+	fs       *flag.FlagSet
+	defaults ServiceDefaults
+	card     bool
+	noCard   bool
+}
+
+func newPostFlags(fs *flag.FlagSet) *postFlags {
+	f := &postFlags{fs: fs}
+	fs.StringVar(&f.defaults.Language, "lang", "", "language code of the post, e.g. en or de, or a comma-separated list of them for Bluesky")
+	fs.StringVar(&f.defaults.Visibility, "visibility", "", "who can see the post on Mastodon: public, unlisted, followers, or direct")
+	fs.StringVar(&f.defaults.Signature, "signature", "", "text appended to the message, e.g. hashtags (\"\" for none)")
+	fs.BoolVar(&f.card, "card", true, "embed a preview card for the first link on Bluesky when there are no images")
+	fs.BoolVar(&f.noCard, "no-card", false, "don't embed a link preview card")
+	fs.StringVar(&f.defaults.ReplyControl, "reply-control", "", "who can reply on Bluesky: everyone, mentioned, following, or nobody")
+	fs.StringVar(&f.defaults.Subreddit, "subreddit", "", "subreddit to submit the post to on Reddit")
+	fs.StringVar(&f.defaults.Community, "community", "", "community to post to on Lemmy, like golang@lemmy.ml")
+	return f
+}
+
+// apply overlays the flags that were given on the command line onto defaults
+func (f *postFlags) apply(defaults ServiceDefaults) ServiceDefaults {
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "lang":
+			defaults.Language = f.defaults.Language
+		case "visibility":
+			defaults.Visibility = f.defaults.Visibility
+		case "signature":
+			defaults.Signature = f.defaults.Signature
+		case "card":
+			card := f.card
+			defaults.LinkCards = &card
+		case "no-card":
+			card := !f.noCard
+			defaults.LinkCards = &card
+		case "reply-control":
+			defaults.ReplyControl = f.defaults.ReplyControl
+		case "subreddit":
+			defaults.Subreddit = f.defaults.Subreddit
+		case "community":
+			defaults.Community = f.defaults.Community
+		}
+	})
+	return defaults
+}
+
+// postForService returns a copy of post with a service's settings applied
+func postForService(post Post, settings ServiceDefaults) *Post {
+	if settings.Signature != "" {
+		post.Text += "\n\n" + settings.Signature
+	}
+	post.Language = settings.Language
+	post.Visibility = settings.Visibility
+	post.LinkCard = settings.LinkCards == nil || *settings.LinkCards
+	post.ReplyControl = settings.ReplyControl
+	post.Subreddit = settings.Subreddit
+	post.Community = settings.Community
+	return &post
+}
+
+// splitTitle returns the title and body of a post for services whose posts
+// have titles: the title is --title, or else the first line of the text,
+// which is then left out of the body
+func splitTitle(post *Post) (title, body string) {
+	title, body = post.Title, post.Text
+	if title == "" {
+		title, body, _ = strings.Cut(post.Text, "\n")
+	}
+	return strings.TrimSpace(title), strings.TrimSpace(body)
+}
+
+// isOnlyLink reports whether text is nothing but a link
+func isOnlyLink(text string) bool {
+	link := firstURL(text)
+	return link != "" && link == text
+}
+
+// applyConfigDefaults returns a copy of post with the service's configured defaults applied
+func applyConfigDefaults(service string, post Post) (*Post, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	settings := config.Defaults[service]
+	if err := settings.validate(); err != nil {
+		return nil, fmt.Errorf("invalid %s defaults in config: %w", service, err)
+	}
+
+	return postForService(post, settings), nil
+}
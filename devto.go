@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum character count shout sends to dev.to. Articles have no documented
+// limit, so this only keeps shout from sending runaway input.
+const DevToCharacterLimit = 100000
+
+// Maximum character count of a dev.to article's title
+const devtoTitleLimit = 128
+
+// dev.to's API endpoint
+var devtoAPIURL = "https://dev.to/api"
+
+// DevToSession holds the API key of a dev.to account
+type DevToSession struct {
+	Username string `json:"username"`
+	APIKey   string `json:"api_key"`
+}
+
+// devtoRequest sends a JSON request to the API and decodes the JSON response into out
+func devtoRequest(session DevToSession, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, devtoAPIURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("api-key", session.APIKey)
+	req.Header.Set("Accept", "application/vnd.forem.api-v1+json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// loadDevToSession loads the config and checks that a dev.to session is stored
+func loadDevToSession() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.DevToSession.APIKey == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with dev.to, please run 'shout auth devto' first"))
+	}
+
+	return config, nil
+}
+
+func authenticateDevTo() error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// dev.to only needs the key, so a credential source's identifier is optional
+	key := os.Getenv("DEVTO_API_KEY")
+	if source := config.Credentials["devto"]; source.SecretCommand != "" {
+		if key, err = runSecretCommand(source.SecretCommand); err != nil {
+			return err
+		}
+	}
+	if key == "" {
+		fmt.Println("Generate an API key under Settings > Extensions > DEV Community API Keys.")
+		if key, err = promptLine("Enter your dev.to API key: "); err != nil {
+			return fmt.Errorf("failed to read API key: %w", err)
+		}
+	}
+	session := DevToSession{APIKey: strings.TrimSpace(key)}
+
+	// Check the key works before saving it
+	var me struct {
+		Username string `json:"username"`
+	}
+	if err := devtoRequest(session, "GET", "/users/me", nil, &me); err != nil {
+		return fmt.Errorf("failed to verify API key: %w", err)
+	}
+	session.Username = me.Username
+
+	config.DevToSession = session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with dev.to as @%s!\n", session.Username)
+	return nil
+}
+
+// devtoArticle returns the title and markdown of the article for a post: the
+// --article file, titled by --title or its frontmatter, or else the message
+// with its title from --title or the first line
+func devtoArticle(post *Post) (title, markdown string) {
+	if post.Article == "" {
+		return splitTitle(post)
+	}
+	title = post.Title
+	if frontmatter, _, ok := splitFrontmatter(post.Article); ok && title == "" {
+		// dev.to reads the frontmatter's tags, canonical_url, and so on itself
+		if fields, err := parseFrontmatter(frontmatter); err == nil {
+			title, _ = fields["title"].(string)
+		}
+	}
+	return strings.TrimSpace(title), post.Article
+}
+
+// checkDevToPost checks a post that would be published on dev.to
+func checkDevToPost(post *Post) error {
+	title, _ := devtoArticle(post)
+	if title == "" {
+		return withExitCode(exitValidation, fmt.Errorf("posting to dev.to needs a --title, a title in the article's frontmatter, or a first line of the message to use as the title"))
+	}
+	if length := utf8.RuneCountInString(title); length > devtoTitleLimit {
+		return withExitCode(exitValidation, fmt.Errorf("the dev.to title is %d characters, over the limit of %d. Pass a shorter --title", length, devtoTitleLimit))
+	}
+	return nil
+}
+
+// PostToDevTo publishes the post's article, or the message itself when it has none
+func PostToDevTo(post *Post) (*PostResult, error) {
+	if post.ReplyTo != nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("dev.to doesn't support threads"))
+	}
+	if err := checkDevToPost(post); err != nil {
+		return nil, err
+	}
+	config, err := loadDevToSession()
+	if err != nil {
+		return nil, err
+	}
+
+	title, markdown := devtoArticle(post)
+	article := map[string]interface{}{"title": title, "body_markdown": markdown, "published": true}
+	var created struct {
+		ID  int    `json:"id"`
+		URL string `json:"url"`
+	}
+	if err := devtoRequest(config.DevToSession, "POST", "/articles", map[string]interface{}{"article": article}, &created); err != nil {
+		return nil, fmt.Errorf("posting failed: %w", err)
+	}
+
+	result := &PostResult{ID: strconv.Itoa(created.ID), URI: created.URL, URL: created.URL}
+	successf("Successfully posted to dev.to!\n  URL: %s\n", result.URL)
+
+	if err := recordHistory("devto", post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// deleteDevToPost unpublishes an article, since the API can't delete them,
+// after checking that it's still published and ours
+func deleteDevToPost(id string) error {
+	config, err := loadDevToSession()
+	if err != nil {
+		return err
+	}
+
+	// Only published articles can be looked up by ID
+	var article struct {
+		User struct {
+			Username string `json:"username"`
+		} `json:"user"`
+	}
+	err = devtoRequest(config.DevToSession, "GET", "/articles/"+id, nil, &article)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return err
+	}
+	if config.DevToSession.Username != "" && !strings.EqualFold(article.User.Username, config.DevToSession.Username) {
+		return errOtherAccount
+	}
+
+	unpublish := map[string]interface{}{"article": map[string]interface{}{"published": false}}
+	err = devtoRequest(config.DevToSession, "PUT", "/articles/"+id, unpublish, nil)
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("unpublishing failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum character count of a Bluesky direct message
+const BlueskyDMCharacterLimit = 1000
+
+// The chat service, which the user's server forwards chat.bsky requests to
+const blueskyChatService = "did:web:api.bsky.chat#bsky_chat"
+
+// blueskyChat calls a chat.bsky method through the user's server, as a query
+// when body is nil and as a procedure otherwise, and decodes the JSON
+// response into out
+func blueskyChat(config *Config, method string, params url.Values, body interface{}, out interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode %s request: %w", method, err)
+		}
+	}
+
+	chatURL := config.BlueskySession.xrpcURL(method)
+	if len(params) > 0 {
+		chatURL += "?" + params.Encode()
+	}
+	resp, err := doBlueskyRequest(config, func() (*http.Request, error) {
+		req, err := http.NewRequest("GET", chatURL, nil)
+		if body != nil {
+			req, err = http.NewRequest("POST", chatURL, bytes.NewReader(reqBody))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("atproto-proxy", blueskyChatService)
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	return nil
+}
+
+// sendDirectMessage sends text to an account in the conversation between the
+// two of them, which Bluesky starts if there isn't one yet
+func sendDirectMessage(config *Config, actor, text string) error {
+	member, err := actorDID(config, actor)
+	if err != nil {
+		return err
+	}
+
+	var convo struct {
+		Convo struct {
+			ID string `json:"id"`
+		} `json:"convo"`
+	}
+	err = blueskyChat(config, "chat.bsky.convo.getConvoForMembers", url.Values{"members": {member}}, nil, &convo)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && (statusErr.Status == http.StatusUnauthorized || strings.Contains(statusErr.Body, "Bad token scope")) {
+		return withExitCode(exitAuth, fmt.Errorf("this login can't send direct messages. Create an app password with direct messages allowed and run 'shout auth bluesky' again"))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open a conversation with %s: %w", actor, err)
+	}
+
+	message := map[string]interface{}{"text": text}
+	if facets := blueskyFacets(config, text); len(facets) > 0 {
+		message["facets"] = facets
+	}
+	send := map[string]interface{}{"convoId": convo.Convo.ID, "message": message}
+	if err := blueskyChat(config, "chat.bsky.convo.sendMessage", nil, send, nil); err != nil {
+		return fmt.Errorf("sending the message to %s failed: %w", actor, err)
+	}
+	infof("Sent a direct message to %s\n", actor)
+	return nil
+}
+
+// dmCommand sends a Bluesky direct message
+func dmCommand(args []string) error {
+	fs := flag.NewFlagSet("dm", flag.ExitOnError)
+	fromStdin := fs.Bool("stdin", false, "read the message from stdin")
+	positional := parseFlags(fs, args)
+
+	var actor, text string
+	switch {
+	case *fromStdin && len(positional) == 1:
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		actor, text = positional[0], string(input)
+	case !*fromStdin && len(positional) == 2:
+		actor, text = positional[0], positional[1]
+	default:
+		fmt.Println("Usage: shout dm [--stdin] <handle> <message>")
+		os.Exit(1)
+	}
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return withExitCode(exitValidation, fmt.Errorf("the message is empty"))
+	}
+	if length := utf8.RuneCountInString(text); length > BlueskyDMCharacterLimit {
+		return withExitCode(exitValidation, fmt.Errorf("the message is %d characters, over Bluesky's limit of %d for direct messages", length, BlueskyDMCharacterLimit))
+	}
+
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+	return sendDirectMessage(config, actor, text)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// loadDraft returns the saved draft with the given ID
+func loadDraft(arg string) (*Draft, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("invalid draft ID: %s", arg))
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	draft, err := store.Draft(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read drafts: %w", err)
+	}
+	if draft == nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("no draft with ID %d", id))
+	}
+	return draft, nil
+}
+
+// deleteDraft removes a draft once it has been posted
+func deleteDraft(id uint64) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	return store.DeleteDraft(id)
+}
+
+func draftCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		drafts, err := store.Drafts()
+		if err != nil {
+			return fmt.Errorf("failed to read drafts: %w", err)
+		}
+		if len(drafts) == 0 {
+			fmt.Println("There are no drafts.")
+			return nil
+		}
+		for _, draft := range drafts {
+			fmt.Printf("%d\t%s\t%s\n", draft.ID, draft.UpdatedAt.Local().Format("2006-01-02 15:04"), truncateText(strings.ReplaceAll(draft.Text, "\n", " "), 50))
+		}
+		return nil
+
+	case "save":
+		fs := flag.NewFlagSet("draft save", flag.ExitOnError)
+		fromStdin := fs.Bool("stdin", false, "read the draft from stdin")
+		positional := parseFlags(fs, args[1:])
+
+		var text string
+		switch {
+		case *fromStdin:
+			input, err := io.ReadAll(os.Stdin)
+			if err != nil {
+				return fmt.Errorf("failed to read stdin: %w", err)
+			}
+			text = string(input)
+		case len(positional) > 0:
+			text = positional[0]
+		}
+		if text = strings.TrimSpace(text); text == "" {
+			return withExitCode(exitValidation, fmt.Errorf("usage: shout draft save [--stdin] <message>"))
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		draft := &Draft{Text: text, UpdatedAt: time.Now()}
+		if err := store.SaveDraft(draft); err != nil {
+			return fmt.Errorf("failed to save draft: %w", err)
+		}
+		infof("Saved draft %d. Post it with 'shout post --draft %d'.\n", draft.ID, draft.ID)
+		return nil
+
+	case "show":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: shout draft show <id>")
+		}
+		draft, err := loadDraft(args[1])
+		if err != nil {
+			return err
+		}
+		fmt.Println(draft.Text)
+		return nil
+
+	case "drop":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: shout draft drop <id>")
+		}
+		draft, err := loadDraft(args[1])
+		if err != nil {
+			return err
+		}
+		return deleteDraft(draft.ID)
+
+	default:
+		fmt.Println("Usage: shout draft [list|save [--stdin] <message>|show <id>|drop <id>]")
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// How long a posted text blocks an identical post to the same service, unless configured otherwise
+const defaultDuplicateWindow = 24 * time.Hour
+
+// duplicateWindow returns the configured duplicate protection window. Zero disables the check.
+func (c *Config) duplicateWindow() (time.Duration, error) {
+	if c.DuplicateWindow == "" {
+		return defaultDuplicateWindow, nil
+	}
+
+	window, err := time.ParseDuration(c.DuplicateWindow)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duplicate_window in config: %w", err)
+	}
+	return window, nil
+}
+
+// checkDuplicate refuses a post whose text was already posted to the service
+// within the configured window, which usually means a script or cron job ran twice
+func checkDuplicate(config *Config, service, text string) error {
+	window, err := config.duplicateWindow()
+	if err != nil || window <= 0 {
+		return err
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	entry, err := store.FindRecent(service, text, time.Now().Add(-window))
+	if err != nil {
+		return fmt.Errorf("failed to check post history: %w", err)
+	}
+	if entry != nil {
+		return withExitCode(exitValidation, fmt.Errorf("the same text was already posted to %s at %s; use --force to post it again", serviceNames[service], entry.PostedAt.Local().Format("2006-01-02 15:04")))
+	}
+	return nil
+}
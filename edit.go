@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// parseATURI splits an at:// URI into its repo, collection, and record key
+func parseATURI(uri string) (repo, collection, rkey string, err error) {
+	parts := strings.Split(strings.TrimPrefix(uri, "at://"), "/")
+	if !strings.HasPrefix(uri, "at://") || len(parts) != 3 {
+		return "", "", "", fmt.Errorf("invalid at:// URI: %s", uri)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
+
+// editBlueskyPost replaces the text of one of our own posts with putRecord,
+// returning the text it had. The links, mentions, and hashtags are detected
+// again in the new text, since facets point at byte offsets in the old one.
+func editBlueskyPost(ref, text string) (*PostResult, string, error) {
+	config, err := loadBlueskySession()
+	if err != nil {
+		return nil, "", err
+	}
+
+	uri, err := postURIFromReference(config, ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	repo, collection, rkey, err := parseATURI(uri)
+	if err != nil {
+		return nil, "", err
+	}
+	if repo != config.BlueskySession.Did {
+		return nil, "", fmt.Errorf("only your own posts can be edited")
+	}
+
+	var current struct {
+		CID   string                 `json:"cid"`
+		Value map[string]interface{} `json:"value"`
+	}
+	params := url.Values{"repo": {repo}, "collection": {collection}, "rkey": {rkey}}
+	if err := blueskyGet(config, "com.atproto.repo.getRecord", params, &current); err != nil {
+		return nil, "", err
+	}
+
+	record := current.Value
+	old, _ := record["text"].(string)
+	record["text"] = text
+	if facets := blueskyFacets(config, text); len(facets) > 0 {
+		record["facets"] = facets
+	} else {
+		delete(record, "facets")
+	}
+
+	var result PostResult
+	err = blueskyProcedure(config, "com.atproto.repo.putRecord", map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"rkey":       rkey,
+		"record":     record,
+		"swapRecord": current.CID,
+	}, &result)
+	if err != nil {
+		return nil, "", fmt.Errorf("editing failed: %w", err)
+	}
+	result.URL = blueskyPostURL(repo, result.URI)
+
+	return &result, old, nil
+}
+
+// serviceForPostReference works out which service a post URL or URI belongs to
+func serviceForPostReference(config *Config, ref string) string {
+	if strings.HasPrefix(ref, "at://") {
+		return "bluesky"
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+
+	switch {
+	case u.Host == "bsky.app" || u.Host == "staging.bsky.app":
+		return "bluesky"
+	case config.MastodonSession.InstanceURL != "" && strings.HasSuffix(config.MastodonSession.InstanceURL, "://"+u.Host):
+		return "mastodon"
+	}
+	return ""
+}
+
+func editCommand(args []string) error {
+	if len(args) < 2 {
+		fmt.Println("Usage: shout edit <post-url> <new text>")
+		os.Exit(1)
+	}
+
+	ref, text := args[0], args[1]
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	service := serviceForPostReference(config, ref)
+	if service == "" {
+		return fmt.Errorf("editing is not supported for %s", ref)
+	}
+
+	// Mastodon checks again once the post's content warning is known
+	if err := checkLengthFor(service, text); err != nil {
+		return err
+	}
+
+	var result *PostResult
+	var old string
+	switch service {
+	case "bluesky":
+		result, old, err = editBlueskyPost(ref, text)
+	case "mastodon":
+		result, old, err = editMastodonPost(ref, text)
+	default:
+		return fmt.Errorf("editing is not supported for %s", ref)
+	}
+	if err != nil {
+		return err
+	}
+
+	if quiet {
+		fmt.Println(result.URL)
+		return nil
+	}
+	successf("Successfully edited %s post!\n", serviceNames[service])
+	printTextDiff(old, text)
+	return nil
+}
+
+// printTextDiff shows the lines that changed between two texts, the old ones
+// marked - in red and the new ones + in green, with the unchanged lines
+// around them
+func printTextDiff(old, new string) {
+	before, after := strings.Split(old, "\n"), strings.Split(new, "\n")
+	start := 0
+	for start < len(before) && start < len(after) && before[start] == after[start] {
+		start++
+	}
+	end := 0
+	for end < len(before)-start && end < len(after)-start && before[len(before)-1-end] == after[len(after)-1-end] {
+		end++
+	}
+
+	for _, line := range before[:start] {
+		fmt.Println("  " + line)
+	}
+	for _, line := range before[start : len(before)-end] {
+		fmt.Println(colorize(os.Stdout, styleError, "- "+line))
+	}
+	for _, line := range after[start : len(after)-end] {
+		fmt.Println(colorize(os.Stdout, styleSuccess, "+ "+line))
+	}
+	for _, line := range before[len(before)-end:] {
+		fmt.Println("  " + line)
+	}
+}
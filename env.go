@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+)
+
+// loadEnvFile loads variables from the file named by SHOUT_ENV_FILE, or from
+// .env in the current directory if there is one. Variables that are already
+// set in the environment take precedence over the file.
+func loadEnvFile() error {
+	path := os.Getenv("SHOUT_ENV_FILE")
+	if path == "" {
+		if _, err := os.Stat(".env"); err != nil {
+			return nil
+		}
+		path = ".env"
+	}
+
+	if err := godotenv.Load(path); err != nil {
+		return fmt.Errorf("failed to load env file %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// Exit codes, so scripts and CI steps can tell classes of failure apart. Flag
+// parsing errors exit with 2.
+const (
+	exitFailure    = 1 // anything not covered below
+	exitAuth       = 3 // not logged in, or credentials or tokens rejected
+	exitValidation = 4 // the post was refused before sending, e.g. too long
+	exitNetwork    = 5 // the service couldn't be reached
+	exitRateLimit  = 6 // the service answered 429 Too Many Requests
+	exitServer     = 7 // the service answered with a 5xx error
+
+	exitInterrupted = 130 // stopped with Ctrl-C, as shells report 128+SIGINT
+)
+
+// statusError is an error response from a service's HTTP API
+type statusError struct {
+	Action string // what failed, e.g. an XRPC method
+	Status int
+	Body   string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("%s failed: status %d, response: %s", e.Action, e.Status, e.Body)
+}
+
+// codedError attaches an exit code to an error without changing its message
+type codedError struct {
+	err  error
+	code int
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// withExitCode marks err as belonging to the class of failures with the given exit code
+func withExitCode(code int, err error) error {
+	return &codedError{err: err, code: code}
+}
+
+// exitCode returns the exit code for the class of failure err belongs to
+func exitCode(err error) int {
+	if rootCtx.Err() != nil && errors.Is(err, context.Canceled) {
+		return exitInterrupted
+	}
+
+	if isNetworkError(err) {
+		return exitNetwork
+	}
+
+	var coded *codedError
+	if errors.As(err, &coded) {
+		return coded.code
+	}
+
+	var status *statusError
+	if errors.As(err, &status) {
+		switch {
+		case status.Status == http.StatusUnauthorized || status.Status == http.StatusForbidden:
+			return exitAuth
+		case status.Status == http.StatusUnprocessableEntity:
+			return exitValidation
+		case status.Status == http.StatusTooManyRequests:
+			return exitRateLimit
+		case status.Status >= 500:
+			return exitServer
+		}
+	}
+
+	return exitFailure
+}
+
+// fail prints an error after the given prefix and exits with the code for its class of failure
+func fail(prefix string, err error) {
+	logf(logError, "%s: %v", prefix, err)
+	fmt.Printf("%s: %v\n", colorize(os.Stdout, styleError, prefix), err)
+	os.Exit(exitCode(err))
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// hashtagPattern matches #hashtags that contain at least one letter
+var hashtagPattern = regexp.MustCompile(`(?:^|\s)(#[\p{L}\p{N}_]*\p{L}[\p{L}\p{N}_]*)`)
+
+// richTextSpan is a link, mention, or hashtag detected in a post's text.
+// Start and End are byte offsets, as Bluesky facets use.
+type richTextSpan struct {
+	Start, End int
+	Kind       string // "link", "mention", or "tag"
+	Value      string // the link URL, the mentioned handle without the @, or the tag without the #
+}
+
+// detectRichText finds the links, mentions, and hashtags in text, in order
+func detectRichText(text string) []richTextSpan {
+	var spans []richTextSpan
+
+	for _, loc := range urlPattern.FindAllStringIndex(text, -1) {
+		link := strings.TrimRight(text[loc[0]:loc[1]], ".,;:!?)'\"")
+		spans = append(spans, richTextSpan{loc[0], loc[0] + len(link), "link", link})
+	}
+
+	// Group 1 starts after the @
+	for _, loc := range mentionPattern.FindAllStringSubmatchIndex(text, -1) {
+		spans = append(spans, richTextSpan{loc[2] - 1, loc[3], "mention", text[loc[2]:loc[3]]})
+	}
+
+	for _, loc := range hashtagPattern.FindAllStringSubmatchIndex(text, -1) {
+		spans = append(spans, richTextSpan{loc[2], loc[3], "tag", text[loc[2]+1 : loc[3]]})
+	}
+
+	// Drop anything inside a link, such as a #fragment
+	sort.Slice(spans, func(i, j int) bool { return spans[i].Start < spans[j].Start })
+	var result []richTextSpan
+	for _, span := range spans {
+		if len(result) > 0 && span.Start < result[len(result)-1].End {
+			continue
+		}
+		result = append(result, span)
+	}
+	return result
+}
+
+// blueskyFacets returns the app.bsky.richtext.facet records that make the
+// links, mentions, and hashtags in text clickable. Mentions of handles that
+// don't resolve, and fediverse mentions, stay plain text.
+func blueskyFacets(config *Config, text string) []map[string]interface{} {
+	var facets []map[string]interface{}
+	for _, span := range detectRichText(text) {
+		var feature map[string]interface{}
+		switch span.Kind {
+		case "link":
+			feature = map[string]interface{}{"$type": "app.bsky.richtext.facet#link", "uri": span.Value}
+		case "tag":
+			feature = map[string]interface{}{"$type": "app.bsky.richtext.facet#tag", "tag": span.Value}
+		case "mention":
+			if strings.Contains(span.Value, "@") {
+				continue
+			}
+			did, err := resolveHandle(config, span.Value)
+			if err != nil {
+				continue
+			}
+			feature = map[string]interface{}{"$type": "app.bsky.richtext.facet#mention", "did": did}
+		}
+
+		facets = append(facets, map[string]interface{}{
+			"index":    map[string]int{"byteStart": span.Start, "byteEnd": span.End},
+			"features": []map[string]interface{}{feature},
+		})
+	}
+	return facets
+}
@@ -0,0 +1,499 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Feed is an RSS, Atom, or JSON Feed feed whose new items shout announces
+type Feed struct {
+	Name string `json:"name" toml:"name"`
+	URL  string `json:"url" toml:"url"`
+	To   string `json:"to,omitempty" toml:"to"`
+
+	// Template is the post for each item, see feedItem.templateData; empty means defaultFeedTemplate
+	Template string `json:"template,omitempty" toml:"template"`
+
+	// Categories and Keywords limit the items announced to those in one of the
+	// categories, or with one of the keywords in their title or description.
+	// Both ignore case.
+	Categories []string `json:"categories,omitempty" toml:"categories"`
+	Keywords   []string `json:"keywords,omitempty" toml:"keywords"`
+}
+
+const defaultFeedTemplate = "{{.title}}\n\n{{.link}}"
+
+// Feeds are fetched with this much time to answer, and up to this size
+const (
+	feedTimeout  = 30 * time.Second
+	maxFeedBytes = 10 << 20
+)
+
+// A feed's state file remembers at most this many posted items, which is
+// plenty for feeds that only list their latest ones
+const maxFeedStateItems = 1000
+
+// feedItem is an entry of a feed, whatever its format
+type feedItem struct {
+	ID          string
+	Title       string
+	Link        string
+	Description string
+	Categories  []string
+}
+
+type rssDocument struct {
+	Channel struct {
+		Title string    `xml:"title"`
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type rssItem struct {
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	GUID        string   `xml:"guid"`
+	Description string   `xml:"description"`
+	Categories  []string `xml:"category"`
+}
+
+type atomDocument struct {
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID    string `xml:"id"`
+	Title string `xml:"title"`
+	Links []struct {
+		Rel  string `xml:"rel,attr"`
+		Href string `xml:"href,attr"`
+	} `xml:"link"`
+	Summary    string `xml:"summary"`
+	Content    string `xml:"content"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+// jsonFeedDocument is a JSON Feed, https://www.jsonfeed.org/version/1.1/
+type jsonFeedDocument struct {
+	Items []struct {
+		ID          json.RawMessage `json:"id"`
+		URL         string          `json:"url"`
+		Title       string          `json:"title"`
+		Summary     string          `json:"summary"`
+		ContentText string          `json:"content_text"`
+		ContentHTML string          `json:"content_html"`
+		Tags        []string        `json:"tags"`
+	} `json:"items"`
+}
+
+// feedState is a feed's state file: the items that were already announced
+type feedState struct {
+	Posted []string `json:"posted"`
+}
+
+var (
+	htmlTagPattern    = regexp.MustCompile(`<[^>]*>`)
+	feedSlugPattern   = regexp.MustCompile(`[^a-z0-9_-]+`)
+	whitespacePattern = regexp.MustCompile(`\s+`)
+)
+
+// plainText turns an item's HTML description into plain text
+func plainText(s string) string {
+	s = htmlTagPattern.ReplaceAllString(s, " ")
+	return strings.TrimSpace(whitespacePattern.ReplaceAllString(html.UnescapeString(s), " "))
+}
+
+// fetchFeed downloads and parses a feed, returning its items oldest first
+func fetchFeed(url string) ([]feedItem, error) {
+	client := &http.Client{Timeout: feedTimeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch the feed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch the feed: status %d", resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxFeedBytes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the feed: %w", err)
+	}
+	return parseFeed(data)
+}
+
+// parseFeed reads the items of an RSS, Atom, or JSON Feed feed, oldest first
+func parseFeed(data []byte) ([]feedItem, error) {
+	data = bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\uFEFF")))
+	var items []feedItem
+	var err error
+	if bytes.HasPrefix(data, []byte("{")) {
+		items, err = parseJSONFeed(data)
+	} else {
+		items, err = parseXMLFeed(data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Feeds list their newest items first
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	for i := range items {
+		item := &items[i]
+		item.Title = plainText(item.Title)
+		item.Link = strings.TrimSpace(item.Link)
+		item.Description = plainText(item.Description)
+		if item.ID = strings.TrimSpace(item.ID); item.ID == "" {
+			item.ID = item.Link
+		}
+		if item.ID == "" {
+			item.ID = item.Title
+		}
+	}
+	return items, nil
+}
+
+// parseXMLFeed reads an RSS or Atom feed, telling them apart by their root element
+func parseXMLFeed(data []byte) ([]feedItem, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var root string
+	for root == "" {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid feed, expected RSS, Atom, or JSON Feed: %w", err)
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root = start.Name.Local
+		}
+	}
+
+	var items []feedItem
+	switch root {
+	case "rss":
+		var doc rssDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid RSS feed: %w", err)
+		}
+		for _, item := range doc.Channel.Items {
+			items = append(items, feedItem{
+				ID:          item.GUID,
+				Title:       item.Title,
+				Link:        item.Link,
+				Description: item.Description,
+				Categories:  item.Categories,
+			})
+		}
+
+	case "feed":
+		var doc atomDocument
+		if err := xml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("invalid Atom feed: %w", err)
+		}
+		for _, entry := range doc.Entries {
+			item := feedItem{ID: entry.ID, Title: entry.Title, Description: entry.Summary}
+			if item.Description == "" {
+				item.Description = entry.Content
+			}
+			// The entry's own page is its alternate link, which is also the default
+			for _, link := range entry.Links {
+				if link.Rel == "" || link.Rel == "alternate" {
+					item.Link = link.Href
+					break
+				}
+			}
+			for _, category := range entry.Categories {
+				item.Categories = append(item.Categories, category.Term)
+			}
+			items = append(items, item)
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid feed: expected RSS, Atom, or JSON Feed, not <%s>", root)
+	}
+	return items, nil
+}
+
+// parseJSONFeed reads a JSON Feed
+func parseJSONFeed(data []byte) ([]feedItem, error) {
+	var doc jsonFeedDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON Feed: %w", err)
+	}
+
+	var items []feedItem
+	for _, entry := range doc.Items {
+		// IDs should be strings, but some feeds use numbers
+		var id string
+		if err := json.Unmarshal(entry.ID, &id); err != nil {
+			id = string(entry.ID)
+		}
+		item := feedItem{ID: id, Title: entry.Title, Link: entry.URL, Categories: entry.Tags}
+		for _, description := range []string{entry.Summary, entry.ContentText, entry.ContentHTML} {
+			if description != "" {
+				item.Description = description
+				break
+			}
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// matches reports whether an item passes the feed's category and keyword filters
+func (f *Feed) matches(item feedItem) bool {
+	if len(f.Categories) > 0 {
+		found := false
+		for _, want := range f.Categories {
+			for _, category := range item.Categories {
+				if strings.EqualFold(strings.TrimSpace(category), strings.TrimSpace(want)) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(f.Keywords) > 0 {
+		text := strings.ToLower(item.Title + " " + item.Description)
+		for _, keyword := range f.Keywords {
+			if strings.Contains(text, strings.ToLower(keyword)) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// templateData is what a feed's template can use: {{.title}}, {{.link}},
+// {{.description}} as plain text, {{.categories}} comma-separated, and
+// {{.feed}}, the feed's name
+func (item feedItem) templateData(feed string) map[string]string {
+	return map[string]string{
+		"title":       item.Title,
+		"link":        item.Link,
+		"description": item.Description,
+		"categories":  strings.Join(item.Categories, ", "),
+		"feed":        feed,
+	}
+}
+
+// statePath returns where the feed's state file is kept, next to the store
+func (f *Feed) statePath() (string, error) {
+	dir, err := storeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "feeds", feedSlug(f.Name)+".json"), nil
+}
+
+// feedSlug turns a feed's name into its state file's name
+func feedSlug(name string) string {
+	return strings.Trim(feedSlugPattern.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// loadFeedState reads a feed's state file. ok is false if there is none yet.
+func loadFeedState(path string) (state *feedState, ok bool, err error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &feedState{}, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read feed state: %w", err)
+	}
+	state = &feedState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, false, fmt.Errorf("failed to parse feed state %s: %w", path, err)
+	}
+	return state, true, nil
+}
+
+// save writes the state file, replacing the old one only once the new one is complete
+func (s *feedState) save(path string) error {
+	if len(s.Posted) > maxFeedStateItems {
+		s.Posted = s.Posted[len(s.Posted)-maxFeedStateItems:]
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create the feed state directory: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write feed state: %w", err)
+	}
+	return nil
+}
+
+func (s *feedState) posted(id string) bool {
+	for _, posted := range s.Posted {
+		if posted == id {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFeeds checks the feeds in the config. Their names have to tell their
+// state files apart.
+func checkFeeds(config *Config) error {
+	slugs := make(map[string]string)
+	for i, feed := range config.Feeds {
+		slug := feedSlug(feed.Name)
+		switch {
+		case slug == "":
+			return fmt.Errorf("feeds[%d]: a feed needs a name with letters or digits", i)
+		case slugs[slug] != "":
+			return fmt.Errorf("feeds[%d]: %q is too much like the name of feed %q", i, feed.Name, slugs[slug])
+		case feed.URL == "":
+			return fmt.Errorf("%s: a feed needs a url", feed.Name)
+		}
+		slugs[slug] = feed.Name
+		if _, err := servicesFor(config, feed.To); err != nil {
+			return fmt.Errorf("%s: %w", feed.Name, err)
+		}
+		if feed.Template != "" {
+			if _, err := renderTemplate(feed.Template, feedItem{}.templateData(feed.Name)); err != nil {
+				return fmt.Errorf("%s: %w", feed.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// announceFeed posts the feed's items that weren't announced before. The
+// first time a feed is checked its current items are only remembered, so
+// adding a feed doesn't announce its whole history.
+func announceFeed(config *Config, feed Feed, dryRun bool) error {
+	services, err := servicesFor(config, feed.To)
+	if err != nil {
+		return err
+	}
+	path, err := feed.statePath()
+	if err != nil {
+		return err
+	}
+	state, seen, err := loadFeedState(path)
+	if err != nil {
+		return err
+	}
+	items, err := fetchFeed(feed.URL)
+	if err != nil {
+		return err
+	}
+
+	if !seen {
+		for _, item := range items {
+			state.Posted = append(state.Posted, item.ID)
+		}
+		infof("%s: first check, so its %d current item(s) are remembered without being announced\n", feed.Name, len(items))
+		if dryRun {
+			return nil
+		}
+		return state.save(path)
+	}
+
+	template := feed.Template
+	if template == "" {
+		template = defaultFeedTemplate
+	}
+
+	var failures []error
+	for _, item := range items {
+		if item.ID == "" || state.posted(item.ID) {
+			continue
+		}
+		if !feed.matches(item) {
+			logf(logDebug, "%s: skipping %q, which doesn't match the filters", feed.Name, item.Title)
+			state.Posted = append(state.Posted, item.ID)
+			continue
+		}
+
+		text, err := renderTemplate(template, item.templateData(feed.Name))
+		if err != nil {
+			return err
+		}
+		text = strings.TrimSpace(text)
+		if dryRun {
+			var names []string
+			for _, service := range services {
+				names = append(names, serviceNames[service])
+			}
+			fmt.Printf("Would announce on %s:\n%s\n\n", strings.Join(names, ", "), text)
+			continue
+		}
+
+		// The item is remembered even if posting fails, so that a post that
+		// can never succeed, such as one over the limit, isn't retried forever
+		if err := postText(services, text); err != nil {
+			failures = append(failures, fmt.Errorf("%q: %w", item.Title, err))
+		} else {
+			infof("%s: announced %q\n", feed.Name, item.Title)
+		}
+		state.Posted = append(state.Posted, item.ID)
+	}
+
+	if !dryRun {
+		if err := state.save(path); err != nil {
+			return err
+		}
+	}
+	return errors.Join(failures...)
+}
+
+// announceFeeds checks every feed in the config, or only the one named
+func announceFeeds(name string, dryRun bool) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := checkFeeds(config); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+
+	var failures []error
+	found := false
+	for _, feed := range config.Feeds {
+		if name != "" && feed.Name != name {
+			continue
+		}
+		found = true
+		if err := announceFeed(config, feed, dryRun); err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", feed.Name, err))
+		}
+	}
+	if !found && name != "" {
+		return withExitCode(exitValidation, fmt.Errorf("there is no feed named %q in the config", name))
+	}
+	if !found {
+		return withExitCode(exitValidation, fmt.Errorf("no feeds in the config; add some under \"feeds\""))
+	}
+	return errors.Join(failures...)
+}
+
+func feedsCommand(args []string) error {
+	fs := flag.NewFlagSet("feeds", flag.ExitOnError)
+	name := fs.String("name", "", "only check the feed with this name")
+	dryRun := fs.Bool("dry-run", false, "show what would be announced without posting it or remembering it")
+	parseFlags(fs, args)
+
+	return announceFeeds(*name, *dryRun)
+}
@@ -0,0 +1,457 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// selfLabels are the content warnings a post can carry. Bluesky stores them
+// on the post; Mastodon marks the post's media as sensitive.
+var selfLabels = map[string]bool{
+	"sexual":        true,
+	"nudity":        true,
+	"porn":          true,
+	"graphic-media": true,
+}
+
+// checkLabels rejects labels that aren't one of selfLabels
+func checkLabels(labels []string) error {
+	for _, label := range labels {
+		if !selfLabels[label] {
+			return fmt.Errorf("unknown label %q, expected sexual, nudity, porn, or graphic-media", label)
+		}
+	}
+	return nil
+}
+
+// contentWarningFlags are the --cw and --label flags, which win over a
+// file's cw and labels
+type contentWarningFlags struct {
+	cw     string
+	labels stringList
+	fs     *flag.FlagSet
+}
+
+func newContentWarningFlags(fs *flag.FlagSet) *contentWarningFlags {
+	f := &contentWarningFlags{fs: fs}
+	fs.StringVar(&f.cw, "cw", "", "content warning shown in place of the text on Mastodon")
+	fs.Var(&f.labels, "label", "content label: sexual, nudity, porn, or graphic-media; Bluesky labels the post, and Mastodon marks its media as sensitive (repeatable)")
+	return f
+}
+
+// applyTo overlays the flags that were given on a file's metadata
+func (f *contentWarningFlags) applyTo(meta *postMetadata) error {
+	if err := checkLabels(f.labels); err != nil {
+		return withExitCode(exitValidation, fmt.Errorf("--label: %w", err))
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		switch fl.Name {
+		case "cw":
+			meta.ContentWarning = f.cw
+		case "label":
+			meta.Labels = f.labels
+		}
+	})
+	return nil
+}
+
+// warnUnlabelled points out that Bluesky has no written content warnings, so
+// a warning without labels leaves the Bluesky post uncovered
+func (m *postMetadata) warnUnlabelled(services []string) {
+	if m.ContentWarning == "" || len(m.Labels) > 0 {
+		return
+	}
+	for _, service := range services {
+		if service == "bluesky" {
+			warnf("Bluesky has no written content warnings, so the Bluesky post will show without one. Add a --label to hide it behind a label.\n")
+			return
+		}
+	}
+}
+
+// postMetadata is the frontmatter at the top of a post or thread file
+type postMetadata struct {
+	Langs          []string
+	Labels         []string
+	ContentWarning string
+	Services       []string
+	Images         []batchImage
+	At             time.Time
+	Texts          map[string]string // text_<service> variants of the message
+}
+
+// frontmatterKeyPattern matches the "key:" that starts a mapping entry
+var frontmatterKeyPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_-]*):(?:\s+|$)`)
+
+// splitFrontmatter separates the frontmatter between a first line of "---"
+// and the next "---" from the rest of a file. ok is false if there is none.
+func splitFrontmatter(text string) (frontmatter, body string, ok bool) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	rest, found := strings.CutPrefix(text, "---\n")
+	if !found {
+		return "", text, false
+	}
+	lines := strings.Split(rest, "\n")
+	for i, line := range lines {
+		if strings.TrimRight(line, " \t") == "---" {
+			return strings.Join(lines[:i], "\n"), strings.Join(lines[i+1:], "\n"), true
+		}
+	}
+	return "", text, false
+}
+
+type frontmatterLine struct {
+	number int
+	indent int
+	text   string
+}
+
+// parseFrontmatter reads the small part of YAML that frontmatter needs: keys
+// with a scalar, a [flow, list], or a block list of scalars or of key: value
+// mappings. Values are strings, []interface{}, or map[string]string.
+func parseFrontmatter(text string) (map[string]interface{}, error) {
+	var lines []frontmatterLine
+	for i, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "\t") {
+			return nil, fmt.Errorf("line %d: indent with spaces, not tabs", i+2)
+		}
+		lines = append(lines, frontmatterLine{number: i + 2, indent: len(line) - len(trimmed), text: strings.TrimRight(trimmed, " \t")})
+	}
+
+	values := make(map[string]interface{})
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		match := frontmatterKeyPattern.FindStringSubmatch(line.text)
+		if line.indent != 0 || match == nil {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", line.number)
+		}
+		key, rest := match[1], line.text[len(match[0]):]
+		if _, ok := values[key]; ok {
+			return nil, fmt.Errorf("line %d: %s is set twice", line.number, key)
+		}
+
+		if rest != "" && !strings.HasPrefix(rest, "#") {
+			value, err := parseFrontmatterValue(rest)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line.number, err)
+			}
+			values[key] = value
+			continue
+		}
+
+		// A block list follows on the next lines
+		var list []interface{}
+		for i+1 < len(lines) && strings.HasPrefix(lines[i+1].text+" ", "- ") {
+			i++
+			item := lines[i]
+			content := strings.TrimSpace(strings.TrimPrefix(item.text, "-"))
+			entry := frontmatterKeyPattern.FindStringSubmatch(content)
+			if entry == nil {
+				value, err := parseFrontmatterScalar(content)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", item.number, err)
+				}
+				list = append(list, value)
+				continue
+			}
+
+			// A mapping, whose other keys are indented below the first
+			mapping := make(map[string]string)
+			entryIndent := item.indent + len(item.text) - len(content)
+			for {
+				value, err := parseFrontmatterScalar(content[len(entry[0]):])
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lines[i].number, err)
+				}
+				mapping[entry[1]] = value
+				if i+1 >= len(lines) || lines[i+1].indent != entryIndent {
+					break
+				}
+				i++
+				content = lines[i].text
+				if entry = frontmatterKeyPattern.FindStringSubmatch(content); entry == nil {
+					return nil, fmt.Errorf("line %d: expected \"key: value\"", lines[i].number)
+				}
+			}
+			list = append(list, mapping)
+		}
+		if i+1 < len(lines) && lines[i+1].indent > 0 {
+			return nil, fmt.Errorf("line %d: unexpected indentation", lines[i+1].number)
+		}
+		values[key] = list
+	}
+	return values, nil
+}
+
+// parseFrontmatterValue parses a scalar or a [flow, list] of scalars
+func parseFrontmatterValue(text string) (interface{}, error) {
+	if !strings.HasPrefix(text, "[") {
+		return parseFrontmatterScalar(text)
+	}
+
+	var list []interface{}
+	var item strings.Builder
+	var quote rune
+	closed := false
+	for i, r := range text[1:] {
+		switch {
+		case closed:
+			if rest := strings.TrimSpace(text[1+i:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("unexpected %q after the list", rest)
+			}
+			return list, nil
+		case quote != 0:
+			item.WriteRune(r)
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			item.WriteRune(r)
+		case r == ',' || r == ']':
+			if value := strings.TrimSpace(item.String()); value != "" {
+				parsed, err := parseFrontmatterScalar(value)
+				if err != nil {
+					return nil, err
+				}
+				list = append(list, parsed)
+			}
+			item.Reset()
+			closed = r == ']'
+		default:
+			item.WriteRune(r)
+		}
+	}
+	if !closed {
+		return nil, fmt.Errorf("the list has no closing ]")
+	}
+	return list, nil
+}
+
+// parseFrontmatterScalar parses a plain, 'single-quoted', or "double-quoted" string
+func parseFrontmatterScalar(text string) (string, error) {
+	text = strings.TrimSpace(text)
+	switch {
+	case strings.HasPrefix(text, `"`):
+		end := strings.LastIndex(text, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated \" quote")
+		}
+		if rest := strings.TrimSpace(text[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the closing quote", rest)
+		}
+		value, err := strconv.Unquote(text[:end+1])
+		if err != nil {
+			return "", fmt.Errorf("invalid quoted string %s", text[:end+1])
+		}
+		return value, nil
+	case strings.HasPrefix(text, "'"):
+		end := strings.LastIndex(text, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated ' quote")
+		}
+		if rest := strings.TrimSpace(text[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %q after the closing quote", rest)
+		}
+		return strings.ReplaceAll(text[1:end], "''", "'"), nil
+	}
+
+	// As in YAML, " #" starts a comment
+	if i := strings.Index(text, " #"); i >= 0 {
+		text = strings.TrimSpace(text[:i])
+	}
+	return text, nil
+}
+
+// frontmatterStrings reads a value that may be one string, a comma-separated
+// string, or a list of strings
+func frontmatterStrings(key string, value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case string:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		return items, nil
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s: expected a list of strings", key)
+			}
+			items = append(items, s)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("%s: expected a string or a list", key)
+}
+
+// parsePostMetadata checks a file's frontmatter. Relative image paths are
+// relative to dir.
+func parsePostMetadata(frontmatter, dir string) (*postMetadata, error) {
+	values, err := parseFrontmatter(frontmatter)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := &postMetadata{}
+	for key, value := range values {
+		switch key {
+		case "langs", "labels", "services":
+			items, err := frontmatterStrings(key, value)
+			if err != nil {
+				return nil, err
+			}
+			switch key {
+			case "langs":
+				meta.Langs = items
+			case "labels":
+				if err := checkLabels(items); err != nil {
+					return nil, fmt.Errorf("labels: %w", err)
+				}
+				meta.Labels = items
+			case "services":
+				if _, err := parseServices(strings.Join(items, ",")); err != nil {
+					return nil, fmt.Errorf("services: %w", err)
+				}
+				meta.Services = items
+			}
+
+		case "images":
+			list, ok := value.([]interface{})
+			if !ok {
+				if path, isString := value.(string); isString {
+					list = []interface{}{path}
+				} else {
+					return nil, fmt.Errorf("images: expected a list")
+				}
+			}
+			for _, item := range list {
+				var image batchImage
+				switch item := item.(type) {
+				case string:
+					image.Path = item
+				case map[string]string:
+					for field := range item {
+						if field != "path" && field != "alt" {
+							return nil, fmt.Errorf("images: unknown key %q, expected path or alt", field)
+						}
+					}
+					image = batchImage{Path: item["path"], Alt: item["alt"]}
+				}
+				if image.Path == "" {
+					return nil, fmt.Errorf("images: every image needs a path")
+				}
+				if !filepath.IsAbs(image.Path) && !strings.Contains(image.Path, "://") {
+					image.Path = filepath.Join(dir, image.Path)
+				}
+				meta.Images = append(meta.Images, image)
+			}
+
+		case "cw":
+			cw, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("cw: expected a string")
+			}
+			meta.ContentWarning = cw
+
+		case "at":
+			at, ok := value.(string)
+			if !ok {
+				return nil, fmt.Errorf("at: expected a time")
+			}
+			if meta.At, err = parseBatchTime(at); err != nil {
+				return nil, fmt.Errorf("at: %w", err)
+			}
+
+		default:
+			service, ok := strings.CutPrefix(key, "text_")
+			if !ok {
+				return nil, fmt.Errorf("unknown frontmatter key %q, expected langs, labels, cw, images, services, at, or text_<service>", key)
+			}
+			if _, known := serviceNames[service]; !known {
+				return nil, fmt.Errorf("%s: unknown service %s", key, service)
+			}
+			text, isString := value.(string)
+			if !isString {
+				return nil, fmt.Errorf("%s: expected a string", key)
+			}
+			if meta.Texts == nil {
+				meta.Texts = make(map[string]string)
+			}
+			meta.Texts[service] = text
+		}
+	}
+	return meta, nil
+}
+
+// readPostFile reads a post from a file, along with its frontmatter if it
+// has any. Local images written as ![alt](path) in the text are returned
+// separately, after those the frontmatter lists.
+func readPostFile(path string) (*postMetadata, string, []Image, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", nil, fmt.Errorf("failed to read post file: %w", err)
+	}
+
+	meta := &postMetadata{}
+	frontmatter, body, ok := splitFrontmatter(string(data))
+	if ok {
+		if meta, err = parsePostMetadata(frontmatter, filepath.Dir(path)); err != nil {
+			return nil, "", nil, withExitCode(exitValidation, fmt.Errorf("%s frontmatter: %w", path, err))
+		}
+	}
+
+	images, err := meta.readImages()
+	if err != nil {
+		return nil, "", nil, err
+	}
+	text, inline, err := extractMarkdownImages(body, filepath.Dir(path))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	return meta, text, append(images, inline...), nil
+}
+
+// services returns the services the file names, comma-separated, or to if
+// it's set, since flags win over the file
+func (m *postMetadata) services(to string) string {
+	if to != "" {
+		return to
+	}
+	return strings.Join(m.Services, ",")
+}
+
+// applyTo sets the file's languages on a service's settings
+func (m *postMetadata) applyTo(settings ServiceDefaults) ServiceDefaults {
+	if len(m.Langs) > 0 {
+		settings.Language = strings.Join(m.Langs, ",")
+	}
+	return settings
+}
+
+// readImages reads the images the file names
+func (m *postMetadata) readImages() ([]Image, error) {
+	var images []Image
+	for _, image := range m.Images {
+		data, err := readImage(image.Path)
+		if err != nil {
+			return nil, err
+		}
+		images = append(images, Image{Data: data, Alt: image.Alt})
+	}
+	return images, nil
+}
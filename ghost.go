@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Maximum character count shout sends to Ghost. Ghost itself has no limit,
+// but shout posts short notes rather than articles.
+const GhostCharacterLimit = 10000
+
+// Maximum character count of a Ghost post's title
+const ghostTitleLimit = 255
+
+// GhostSession holds the site and the Admin API key of a custom integration
+type GhostSession struct {
+	SiteURL     string `json:"site_url"`
+	AdminAPIKey string `json:"admin_api_key"` // id:secret, as Ghost shows it
+}
+
+// ghostToken signs the short-lived JWT the Admin API takes instead of the key itself
+func ghostToken(adminAPIKey string) (string, error) {
+	id, secret, ok := strings.Cut(adminAPIKey, ":")
+	key, err := hex.DecodeString(secret)
+	if !ok || id == "" || err != nil || len(key) == 0 {
+		return "", withExitCode(exitAuth, fmt.Errorf("invalid Ghost Admin API key, expected the id:secret shown on the integration's page"))
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": id})
+	now := time.Now().Unix()
+	claims, _ := json.Marshal(map[string]interface{}{"iat": now, "exp": now + 5*60, "aud": "/admin/"})
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ghostRequest sends a request to the site's Admin API and decodes the JSON
+// response into out
+func ghostRequest(session GhostSession, method, path, contentType string, body io.Reader, out interface{}) error {
+	token, err := ghostToken(session.AdminAPIKey)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(method, session.SiteURL+"/ghost/api/admin"+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if upload, ok := body.(*progressReader); ok {
+		req.ContentLength = upload.total
+	}
+	req.Header.Set("Authorization", "Ghost "+token)
+	req.Header.Set("Accept-Version", "v5.0")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// loadGhostSession loads the config and checks that a Ghost session is stored
+func loadGhostSession() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.GhostSession.AdminAPIKey == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with Ghost, please run 'shout auth ghost' first"))
+	}
+
+	return config, nil
+}
+
+func authenticateGhost() error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use credentials from the config or environment when available, otherwise prompt
+	site, key, ok, err := configuredCredentials(config, "ghost", "GHOST_URL", "GHOST_ADMIN_API_KEY")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if site, err = promptLine("Enter your Ghost site (e.g. blog.example.com): "); err != nil {
+			return fmt.Errorf("failed to read site: %w", err)
+		}
+		fmt.Println("Add a custom integration under Settings > Integrations and copy its Admin API key.")
+		if key, err = promptLine("Enter the Admin API key: "); err != nil {
+			return fmt.Errorf("failed to read Admin API key: %w", err)
+		}
+	}
+
+	site = strings.TrimSuffix(strings.TrimSpace(site), "/")
+	if !strings.HasPrefix(site, "https://") && !strings.HasPrefix(site, "http://") {
+		site = "https://" + site
+	}
+	session := GhostSession{SiteURL: site, AdminAPIKey: strings.TrimSpace(key)}
+
+	// Check the key works before saving it
+	var response struct {
+		Site struct {
+			Title string `json:"title"`
+		} `json:"site"`
+	}
+	if err := ghostRequest(session, "GET", "/site/", "", nil, &response); err != nil {
+		return fmt.Errorf("failed to verify Admin API key: %w", err)
+	}
+
+	config.GhostSession = session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with Ghost for %s on %s!\n", response.Site.Title, site)
+	return nil
+}
+
+// uploadGhostImage uploads an image and returns its URL
+func uploadGhostImage(session GhostSession, image Image) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	header := make(textproto.MIMEHeader)
+	contentType := http.DetectContentType(image.Data)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="image.%s"`, strings.TrimPrefix(contentType, "image/")))
+	header.Set("Content-Type", contentType)
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	part.Write(image.Data)
+	form.Close()
+
+	var response struct {
+		Images []struct {
+			URL string `json:"url"`
+		} `json:"images"`
+	}
+	upload := newProgressReader("Ghost", body.Bytes())
+	if err := ghostRequest(session, "POST", "/images/upload/", form.FormDataContentType(), upload, &response); err != nil {
+		return "", fmt.Errorf("image upload failed: %w", err)
+	}
+	if len(response.Images) == 0 {
+		return "", fmt.Errorf("image upload failed: the response has no image")
+	}
+	return response.Images[0].URL, nil
+}
+
+// checkGhostPost checks a post that would be published on Ghost
+func checkGhostPost(post *Post) error {
+	title, _ := splitTitle(post)
+	if title == "" {
+		return withExitCode(exitValidation, fmt.Errorf("posting to Ghost needs a --title, or a first line to use as the title"))
+	}
+	if length := utf8.RuneCountInString(title); length > ghostTitleLimit {
+		return withExitCode(exitValidation, fmt.Errorf("the Ghost title is %d characters, over the limit of %d. Pass a shorter --title", length, ghostTitleLimit))
+	}
+	return nil
+}
+
+// PostToGhost publishes the post, with its title from --title or the first line
+func PostToGhost(post *Post) (*PostResult, error) {
+	if post.ReplyTo != nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("Ghost doesn't support threads"))
+	}
+	if err := checkGhostPost(post); err != nil {
+		return nil, err
+	}
+	config, err := loadGhostSession()
+	if err != nil {
+		return nil, err
+	}
+	session := config.GhostSession
+
+	var tags []string
+	var featured, featuredAlt string
+	for i, image := range post.Images {
+		if image, err = prepareImage("ghost", post, image); err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		imageURL, err := uploadGhostImage(session, image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload image %d: %w", i+1, err)
+		}
+		if featured == "" {
+			featured, featuredAlt = imageURL, image.Alt
+		}
+		tags = append(tags, fmt.Sprintf("<img src=\"%s\" alt=\"%s\">", html.EscapeString(imageURL), html.EscapeString(image.Alt)))
+	}
+
+	title, body := splitTitle(post)
+	created := map[string]interface{}{
+		"title":  title,
+		"html":   postHTML(body, post.ContentWarning, tags),
+		"status": "published",
+	}
+	if featured != "" {
+		created["feature_image"] = featured
+		created["feature_image_alt"] = featuredAlt
+	}
+	data, err := json.Marshal(map[string]interface{}{"posts": []interface{}{created}})
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Posts []struct {
+			ID  string `json:"id"`
+			URL string `json:"url"`
+		} `json:"posts"`
+	}
+	// source=html has Ghost convert the HTML into its own editor format
+	if err := ghostRequest(session, "POST", "/posts/?source=html", "application/json", bytes.NewReader(data), &response); err != nil {
+		return nil, fmt.Errorf("posting failed: %w", err)
+	}
+	if len(response.Posts) == 0 {
+		return nil, fmt.Errorf("posting failed: the response has no post")
+	}
+
+	result := &PostResult{ID: response.Posts[0].ID, URI: response.Posts[0].URL, URL: response.Posts[0].URL}
+	successf("Successfully posted to Ghost!\n  URL: %s\n", result.URL)
+
+	if err := recordHistory("ghost", post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// deleteGhostPost deletes a post by its ID, after checking that it's still
+// there. The Admin API key belongs to the site rather than an author, so any
+// of the site's posts is ours.
+func deleteGhostPost(id string) error {
+	config, err := loadGhostSession()
+	if err != nil {
+		return err
+	}
+
+	err = ghostRequest(config.GhostSession, "GET", "/posts/"+id+"/", "", nil, nil)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return err
+	}
+
+	err = ghostRequest(config.GhostSession, "DELETE", "/posts/"+id+"/", "", nil, nil)
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The daemon counts as stuck once a job is this overdue, which happens when
+// the job before it has been running that long
+const schedulerStallAfter = 15 * time.Minute
+
+// schedulerHealth is what the daemon's loop reports about itself, for /healthz
+type schedulerHealth struct {
+	mu      sync.Mutex
+	nextDue time.Time
+	running string
+}
+
+// daemonHealth is nil unless shout daemon is running
+var daemonHealth *schedulerHealth
+
+// waiting records that the loop is asleep until due
+func (h *schedulerHealth) waiting(due time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.nextDue, h.running = due, ""
+}
+
+// runningJob records that the loop is carrying out a job
+func (h *schedulerHealth) runningJob(name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.running = name
+}
+
+type serviceHealth struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type schedulerStatus struct {
+	OK      bool       `json:"ok"`
+	Error   string     `json:"error,omitempty"`
+	NextDue *time.Time `json:"next_due,omitempty"`
+	Running string     `json:"running,omitempty"`
+}
+
+type healthReport struct {
+	Status    string                   `json:"status"`
+	Services  map[string]serviceHealth `json:"services,omitempty"`
+	Scheduler *schedulerStatus         `json:"scheduler,omitempty"`
+}
+
+// status reports whether the loop is keeping up with its schedules
+func (h *schedulerHealth) status(now time.Time) *schedulerStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	status := &schedulerStatus{OK: true, Running: h.running}
+	if !h.nextDue.IsZero() {
+		due := h.nextDue
+		status.NextDue = &due
+		if late := now.Sub(due); late > schedulerStallAfter {
+			status.OK = false
+			status.Error = fmt.Sprintf("a job due %s ago hasn't run", late.Round(time.Minute))
+			if h.running != "" {
+				status.Error += fmt.Sprintf(", %s is still running", h.running)
+			}
+		}
+	}
+	return status
+}
+
+// checkAuth checks, without contacting the service, that shout can post to
+// it: it has a session whose refresh token hasn't expired, or the
+// credentials to log in again
+func checkAuth(config *Config, service string) error {
+	switch service {
+	case "bluesky":
+		session := config.BlueskySession
+		canLogIn := config.Credentials["bluesky"].SecretCommand != "" || os.Getenv("BLUESKY_APP_PASSWORD") != ""
+		switch {
+		case session.AccessJwt == "" && !canLogIn:
+			return fmt.Errorf("not authenticated")
+		case session.AccessJwt == "" || session.OAuth != nil:
+			return nil
+		}
+		expiry, err := jwtExpiry(session.RefreshJwt)
+		if err != nil && !canLogIn {
+			return fmt.Errorf("refresh token: %w", err)
+		}
+		if err == nil && expiry.Before(time.Now()) && !canLogIn {
+			return fmt.Errorf("the session expired at %s, run 'shout auth bluesky' again", expiry.Format(time.RFC3339))
+		}
+	case "mastodon":
+		if config.MastodonSession.AccessToken == "" && config.Credentials["mastodon"].SecretCommand == "" && os.Getenv("MASTODON_ACCESS_TOKEN") == "" {
+			return fmt.Errorf("not authenticated")
+		}
+	case "matrix":
+		if config.MatrixSession.AccessToken == "" && config.Credentials["matrix"].SecretCommand == "" && os.Getenv("MATRIX_ACCESS_TOKEN") == "" {
+			return fmt.Errorf("not authenticated")
+		}
+	case "reddit":
+		session := config.RedditSession
+		canLogIn := config.Credentials["reddit"].SecretCommand != "" || os.Getenv("REDDIT_PASSWORD") != ""
+		switch {
+		case session.ClientID == "":
+			return fmt.Errorf("not authenticated")
+		case session.ExpiresAt.Before(time.Now()) && !canLogIn:
+			return fmt.Errorf("the session expired at %s, run 'shout auth reddit' again", session.ExpiresAt.Format(time.RFC3339))
+		}
+	case "pixelfed":
+		if config.PixelfedSession.AccessToken == "" && config.Credentials["pixelfed"].SecretCommand == "" && os.Getenv("PIXELFED_ACCESS_TOKEN") == "" {
+			return fmt.Errorf("not authenticated")
+		}
+	case "wordpress":
+		if config.WordPressSession.AppPassword == "" {
+			return fmt.Errorf("not authenticated")
+		}
+	case "devto":
+		if config.DevToSession.APIKey == "" && config.Credentials["devto"].SecretCommand == "" && os.Getenv("DEVTO_API_KEY") == "" {
+			return fmt.Errorf("not authenticated")
+		}
+	case "ghost":
+		if config.GhostSession.AdminAPIKey == "" && config.Credentials["ghost"].SecretCommand == "" && os.Getenv("GHOST_ADMIN_API_KEY") == "" {
+			return fmt.Errorf("not authenticated")
+		}
+	case "lemmy":
+		if config.LemmySession.JWT == "" {
+			return fmt.Errorf("not authenticated")
+		}
+		if expiry, err := jwtExpiry(config.LemmySession.JWT); err == nil && expiry.Before(time.Now()) {
+			return fmt.Errorf("the login expired at %s, run 'shout auth lemmy' again", expiry.Format(time.RFC3339))
+		}
+	}
+	// Plugins handle their own logins
+	return nil
+}
+
+// loggedInServices returns the built-in services the config has a login for
+func loggedInServices(config *Config) map[string]bool {
+	loggedIn := make(map[string]bool)
+	if config.BlueskySession.AccessJwt != "" {
+		loggedIn["bluesky"] = true
+	}
+	if config.MastodonSession.AccessToken != "" {
+		loggedIn["mastodon"] = true
+	}
+	if config.MatrixSession.AccessToken != "" {
+		loggedIn["matrix"] = true
+	}
+	if config.RedditSession.ClientID != "" {
+		loggedIn["reddit"] = true
+	}
+	if config.LemmySession.JWT != "" {
+		loggedIn["lemmy"] = true
+	}
+	if config.PixelfedSession.AccessToken != "" {
+		loggedIn["pixelfed"] = true
+	}
+	if config.WordPressSession.AppPassword != "" {
+		loggedIn["wordpress"] = true
+	}
+	if config.GhostSession.AdminAPIKey != "" {
+		loggedIn["ghost"] = true
+	}
+	if config.DevToSession.APIKey != "" {
+		loggedIn["devto"] = true
+	}
+	return loggedIn
+}
+
+// healthServices returns the services shout is set up to post to: those
+// that are logged in, the default ones, and those schedules and feeds use
+func healthServices(config *Config) []string {
+	wanted := loggedInServices(config)
+	destinations := []string{""}
+	for _, schedule := range config.Schedules {
+		if schedule.Action == "post" {
+			destinations = append(destinations, schedule.To)
+		}
+	}
+	for _, feed := range config.Feeds {
+		destinations = append(destinations, feed.To)
+	}
+	for _, to := range destinations {
+		services, err := servicesFor(config, to)
+		if err != nil {
+			continue
+		}
+		for _, service := range services {
+			wanted[service] = true
+		}
+	}
+
+	var services []string
+	for service := range wanted {
+		services = append(services, service)
+	}
+	sort.Strings(services)
+	return services
+}
+
+// healthHandler serves /healthz, for readiness probes: whether each service
+// can be posted to and, in the daemon, whether the scheduler is keeping up.
+// /healthz/live only checks the scheduler, for liveness probes, since
+// restarting doesn't fix a login. Both answer 503 when something is wrong.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	report := healthReport{Status: "ok"}
+	if daemonHealth != nil {
+		report.Scheduler = daemonHealth.status(time.Now())
+		if !report.Scheduler.OK {
+			report.Status = "unhealthy"
+		}
+	}
+
+	if r.URL.Path != "/healthz/live" {
+		report.Services = make(map[string]serviceHealth)
+		config, err := loadConfig()
+		if err != nil {
+			writeJSON(w, http.StatusServiceUnavailable, map[string]string{"status": "unhealthy", "error": fmt.Sprintf("failed to load config: %v", err)})
+			return
+		}
+		for _, service := range healthServices(config) {
+			health := serviceHealth{OK: true}
+			if err := checkAuth(config, service); err != nil {
+				health = serviceHealth{Error: err.Error()}
+				report.Status = "unhealthy"
+			}
+			report.Services[service] = health
+		}
+	}
+
+	status := http.StatusOK
+	if report.Status != "ok" {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, report)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Hooks are shell commands run around each post
+type Hooks struct {
+	// PrePost gets the message on stdin and prints the text to post instead.
+	// Exiting with a non-zero status cancels the post, with stderr as the reason.
+	PrePost string `json:"pre_post,omitempty" toml:"pre_post"`
+
+	// PostSuccess runs after a post is published, with SHOUT_POST_URL and the
+	// other details of the post in its environment
+	PostSuccess string `json:"post_success,omitempty" toml:"post_success"`
+
+	// Webhook is a URL that gets a webhookPayload as JSON after each post is
+	// published. With WebhookSecret, the payload is signed with HMAC-SHA256.
+	Webhook       string `json:"webhook,omitempty" toml:"webhook"`
+	WebhookSecret string `json:"webhook_secret,omitempty" toml:"webhook_secret"`
+}
+
+// webhookPayload is the JSON sent to the webhook for each published post
+type webhookPayload struct {
+	Service    string    `json:"service"`
+	Text       string    `json:"text"`
+	URL        string    `json:"url"`
+	URI        string    `json:"uri,omitempty"`
+	ID         string    `json:"id,omitempty"`
+	ReplyToURL string    `json:"reply_to_url,omitempty"`
+	PostedAt   time.Time `json:"posted_at"`
+}
+
+// The webhook gets this long to answer
+const webhookTimeout = 10 * time.Second
+
+// hookEnv returns the environment of a hook for a post to service
+func hookEnv(service string, post *Post) []string {
+	env := append(os.Environ(), "SHOUT_SERVICE="+service)
+	if post.ReplyTo != nil {
+		env = append(env, "SHOUT_REPLY_TO_URL="+post.ReplyTo.URL)
+	}
+	return env
+}
+
+// runPrePostHook passes the post's text through the pre-post hook, replacing
+// it with what the hook prints
+func runPrePostHook(command, service string, post *Post) error {
+	var stdout, stderr bytes.Buffer
+	cmd := shellCommand(command)
+	cmd.Env = hookEnv(service, post)
+	cmd.Stdin = strings.NewReader(post.Text)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return fmt.Errorf("pre-post hook failed: %w", err)
+		}
+		reason := strings.TrimSpace(stderr.String())
+		if reason == "" {
+			reason = fmt.Sprintf("exit status %d", exitErr.ExitCode())
+		}
+		return withExitCode(exitValidation, fmt.Errorf("pre-post hook refused the post: %s", reason))
+	}
+
+	text := strings.TrimSpace(stdout.String())
+	if text == "" {
+		return withExitCode(exitValidation, fmt.Errorf("pre-post hook printed an empty message"))
+	}
+	if text != post.Text {
+		post.Text = text
+		if err := checkLengthFor(service, post.Text); err != nil {
+			return fmt.Errorf("after the pre-post hook: %w", err)
+		}
+	}
+	return nil
+}
+
+// runPostSuccessHook runs the post-success hook for a published post. Its
+// failures are only warned about, since the post is already out.
+func runPostSuccessHook(command, service string, post *Post, result *PostResult) {
+	cmd := shellCommand(command)
+	cmd.Env = append(hookEnv(service, post),
+		"SHOUT_POST_URL="+result.URL,
+		"SHOUT_POST_URI="+result.URI,
+		"SHOUT_POST_ID="+result.ID,
+	)
+	cmd.Stdin = strings.NewReader(post.Text)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+
+	if err := cmd.Run(); err != nil {
+		warnf("post-success hook failed: %v\n", err)
+	}
+}
+
+// checkWebhookURL checks that the webhook is an http or https URL
+func checkWebhookURL(webhook string) error {
+	u, err := url.Parse(webhook)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q, expected an http or https URL", webhook)
+	}
+	return nil
+}
+
+// callWebhook sends a published post to the webhook. Its failures are only
+// warned about, since the post is already out.
+func callWebhook(hooks Hooks, service string, post *Post, result *PostResult) {
+	payload := webhookPayload{
+		Service:  service,
+		Text:     post.Text,
+		URL:      result.URL,
+		URI:      result.URI,
+		ID:       result.ID,
+		PostedAt: time.Now().UTC(),
+	}
+	if post.ReplyTo != nil {
+		payload.ReplyToURL = post.ReplyTo.URL
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		warnf("webhook failed: %v\n", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(rootCtx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", hooks.Webhook, bytes.NewReader(body))
+	if err != nil {
+		warnf("webhook failed: %v\n", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+
+	// The receiver can check that the payload came from shout by computing the same signature
+	if hooks.WebhookSecret != "" {
+		mac := hmac.New(sha256.New, []byte(hooks.WebhookSecret))
+		mac.Write(body)
+		req.Header.Set("X-Shout-Signature", "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		warnf("webhook failed: %v\n", err)
+		return
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<16))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		warnf("webhook failed: %s answered with status %d\n", req.URL.Host, resp.StatusCode)
+	}
+}
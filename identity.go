@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// lookupDID resolves a handle to a DID without a logged-in session, first with
+// the _atproto DNS TXT record and then with the /.well-known/atproto-did file
+func lookupDID(handle string) (string, error) {
+	handle = strings.ToLower(strings.TrimPrefix(handle, "@"))
+
+	if records, err := net.LookupTXT("_atproto." + handle); err == nil {
+		for _, record := range records {
+			if did, ok := strings.CutPrefix(record, "did="); ok {
+				return did, nil
+			}
+		}
+	}
+
+	resp, err := http.Get("https://" + handle + "/.well-known/atproto-did")
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve handle %s: %w", handle, err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	did := strings.TrimSpace(string(body))
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(did, "did:") {
+		return "", fmt.Errorf("failed to resolve handle %s: no DID found", handle)
+	}
+	return did, nil
+}
+
+// didDocument is the subset of a DID document that shout uses
+type didDocument struct {
+	ID      string `json:"id"`
+	Service []struct {
+		ID              string `json:"id"`
+		Type            string `json:"type"`
+		ServiceEndpoint string `json:"serviceEndpoint"`
+	} `json:"service"`
+}
+
+// pdsEndpoint returns the URL of the account's personal data server
+func (d didDocument) pdsEndpoint() (string, error) {
+	for _, service := range d.Service {
+		if (service.ID == "#atproto_pds" || service.ID == d.ID+"#atproto_pds") && service.Type == "AtprotoPersonalDataServer" {
+			return strings.TrimSuffix(service.ServiceEndpoint, "/"), nil
+		}
+	}
+	return "", fmt.Errorf("DID document for %s lists no PDS", d.ID)
+}
+
+// fetchDIDDocument fetches the DID document of a did:plc or did:web identity
+func fetchDIDDocument(did string) (*didDocument, error) {
+	var docURL string
+	switch {
+	case strings.HasPrefix(did, "did:plc:"):
+		docURL = "https://plc.directory/" + did
+	case strings.HasPrefix(did, "did:web:"):
+		docURL = "https://" + strings.TrimPrefix(did, "did:web:") + "/.well-known/did.json"
+	default:
+		return nil, fmt.Errorf("unsupported DID method: %s", did)
+	}
+
+	resp, err := http.Get(docURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch DID document: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch DID document for %s: status %d", did, resp.StatusCode)
+	}
+
+	var doc didDocument
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode DID document: %w", err)
+	}
+	return &doc, nil
+}
+
+// resolvePDS finds the DID and PDS URL for a handle or DID
+func resolvePDS(identifier string) (did, pds string, err error) {
+	did = identifier
+	if !strings.HasPrefix(did, "did:") {
+		if did, err = lookupDID(identifier); err != nil {
+			return "", "", err
+		}
+	}
+
+	doc, err := fetchDIDDocument(did)
+	if err != nil {
+		return "", "", err
+	}
+
+	pds, err = doc.pdsEndpoint()
+	if err != nil {
+		return "", "", err
+	}
+	return did, pds, nil
+}
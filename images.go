@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	_ "image/gif"
+	_ "image/png"
+)
+
+// imageLimit describes the largest image a service accepts. Zero means no limit.
+type imageLimit struct {
+	MaxBytes  int
+	MaxPixels int
+}
+
+// imageLimits holds the upload limits of each service
+var imageLimits = map[string]imageLimit{
+	"bluesky":  {MaxBytes: 1000000},
+	"mastodon": {MaxBytes: 16 << 20, MaxPixels: 3840 * 2160},
+	"matrix":   {MaxBytes: 50 << 20},    // Synapse's default max_upload_size
+	"pixelfed": {MaxBytes: 15000 << 10}, // the default MAX_PHOTO_SIZE
+}
+
+// Images downloaded from a URL can be at most this large, the most any
+// service accepts
+const maxImageDownload = 50 << 20
+
+// readImage reads an image file, or downloads it when path is an http or
+// https URL
+func readImage(path string) ([]byte, error) {
+	if !strings.HasPrefix(path, "https://") && !strings.HasPrefix(path, "http://") {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read image: %w", err)
+		}
+		return data, nil
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download image %s: status %d", path, resp.StatusCode)
+	}
+	if resp.ContentLength > maxImageDownload {
+		return nil, fmt.Errorf("image %s is %d bytes, over the limit of %d", path, resp.ContentLength, maxImageDownload)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxImageDownload+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download image %s: %w", path, err)
+	}
+	if len(data) > maxImageDownload {
+		return nil, fmt.Errorf("image %s is over the limit of %d bytes", path, maxImageDownload)
+	}
+	// Trust the bytes rather than the Content-Type, which servers often get wrong
+	if contentType := http.DetectContentType(data); !strings.HasPrefix(contentType, "image/") {
+		return nil, fmt.Errorf("%s isn't an image, it's %s", path, contentType)
+	}
+	return data, nil
+}
+
+func (l imageLimit) fits(size, width, height int) bool {
+	return (l.MaxBytes == 0 || size <= l.MaxBytes) && (l.MaxPixels == 0 || width*height <= l.MaxPixels)
+}
+
+// fitImage downscales and re-encodes an image as JPEG until it fits within the
+// service's limits. Images that already fit are returned unchanged.
+func fitImage(service string, img Image) (Image, error) {
+	return fitImageWithin(imageLimits[service], serviceNames[service], img)
+}
+
+// fitImageWithin fits an image within limit, naming the destination in messages
+func fitImageWithin(limit imageLimit, name string, img Image) (Image, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(img.Data))
+	if err != nil {
+		// Formats we can't decode are passed through for the service to judge
+		if limit.MaxBytes == 0 || len(img.Data) <= limit.MaxBytes {
+			return img, nil
+		}
+		return img, fmt.Errorf("image is %d bytes, over %s's %d byte limit, and its format can't be resized", len(img.Data), name, limit.MaxBytes)
+	}
+
+	if limit.fits(len(img.Data), cfg.Width, cfg.Height) {
+		return img, nil
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(img.Data))
+	if err != nil {
+		return img, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	width, height := cfg.Width, cfg.Height
+	if limit.MaxPixels > 0 && width*height > limit.MaxPixels {
+		scale := math.Sqrt(float64(limit.MaxPixels) / float64(width*height))
+		width, height = int(float64(width)*scale), int(float64(height)*scale)
+	}
+
+	// Lower the quality first, then keep shrinking the dimensions
+	for width > 0 && height > 0 {
+		scaled := downscale(src, width, height)
+		for quality := 90; quality >= 60; quality -= 10 {
+			var out bytes.Buffer
+			if err := jpeg.Encode(&out, scaled, &jpeg.Options{Quality: quality}); err != nil {
+				return img, fmt.Errorf("failed to encode image: %w", err)
+			}
+			if limit.fits(out.Len(), width, height) {
+				infof("Resized image from %dx%d (%d bytes) to %dx%d (%d bytes) for %s\n", cfg.Width, cfg.Height, len(img.Data), width, height, out.Len(), name)
+				return Image{Data: out.Bytes(), Alt: img.Alt}, nil
+			}
+		}
+		width, height = width*3/4, height*3/4
+	}
+
+	return img, fmt.Errorf("failed to shrink image to fit %s's limits", name)
+}
+
+// downscale resizes src to width x height by averaging each block of source
+// pixels, flattening any transparency onto a white background
+func downscale(src image.Image, width, height int) *image.RGBA {
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(b.Min.Y+(y+1)*b.Dy()/height, y0+1)
+		for x := 0; x < width; x++ {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(b.Min.X+(x+1)*b.Dx()/width, x0+1)
+
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// RGBA is alpha-premultiplied, so adding the missing alpha composites over white
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					bl += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+
+	return dst
+}
+
+// prepareImage applies the default privacy and size processing to an image
+// before it is uploaded to a service
+func prepareImage(service string, post *Post, img Image) (Image, error) {
+	var err error
+	if !post.KeepExif {
+		if img, err = stripMetadata(img); err != nil {
+			return img, err
+		}
+	}
+
+	if !post.NoResize {
+		if img, err = fitImage(service, img); err != nil {
+			return img, err
+		}
+	}
+
+	return img, nil
+}
+
+// stripMetadata removes EXIF (including GPS location), XMP, IPTC, and text
+// metadata from JPEG and PNG images. Other formats are returned unchanged.
+func stripMetadata(img Image) (Image, error) {
+	switch {
+	case bytes.HasPrefix(img.Data, []byte{0xff, 0xd8}):
+		return stripJPEGMetadata(img)
+	case bytes.HasPrefix(img.Data, pngSignature):
+		data, err := stripPNGMetadata(img.Data)
+		if err != nil {
+			return img, err
+		}
+		return Image{Data: data, Alt: img.Alt}, nil
+	default:
+		return img, nil
+	}
+}
+
+// stripJPEGMetadata drops the APP1 (EXIF/XMP), APP13 (IPTC), and comment
+// segments of a JPEG. Because the EXIF orientation is lost with them, rotated
+// photos are re-encoded upright first.
+func stripJPEGMetadata(img Image) (Image, error) {
+	data := img.Data
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	orientation := 1
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xff {
+			return img, fmt.Errorf("malformed JPEG: expected marker at offset %d", pos)
+		}
+
+		marker := data[pos+1]
+		// Start of scan: the rest of the file is image data
+		if marker == 0xda {
+			out.Write(data[pos:])
+			break
+		}
+
+		length := int(data[pos+2])<<8 | int(data[pos+3])
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return img, fmt.Errorf("malformed JPEG: segment at offset %d overruns the file", pos)
+		}
+
+		segment := data[pos:end]
+		switch marker {
+		case 0xe1:
+			if o := exifOrientation(segment[4:]); o != 0 {
+				orientation = o
+			}
+		case 0xed, 0xfe:
+		default:
+			out.Write(segment)
+		}
+		pos = end
+	}
+
+	stripped := Image{Data: out.Bytes(), Alt: img.Alt}
+	if orientation == 1 {
+		return stripped, nil
+	}
+
+	src, err := jpeg.Decode(bytes.NewReader(stripped.Data))
+	if err != nil {
+		return img, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	var upright bytes.Buffer
+	if err := jpeg.Encode(&upright, applyOrientation(src, orientation), &jpeg.Options{Quality: 95}); err != nil {
+		return img, fmt.Errorf("failed to encode image: %w", err)
+	}
+	return Image{Data: upright.Bytes(), Alt: img.Alt}, nil
+}
+
+// exifOrientation reads the orientation tag (1-8) from an APP1 EXIF payload,
+// returning 0 if there is none
+func exifOrientation(payload []byte) int {
+	if !bytes.HasPrefix(payload, []byte("Exif\x00\x00")) || len(payload) < 14 {
+		return 0
+	}
+	tiff := payload[6:]
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:8]))
+	if ifd+2 > len(tiff) {
+		return 0
+	}
+
+	count := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < count; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 0
+		}
+	}
+	return 0
+}
+
+// applyOrientation transforms src so that it displays upright without an EXIF orientation tag
+func applyOrientation(src image.Image, orientation int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	// Orientations 5-8 swap width and height
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirrored horizontally
+				sx, sy = w-1-x, y
+			case 3: // rotated 180°
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				sx, sy = x, h-1-y
+			case 5: // mirrored along the top-left diagonal
+				sx, sy = y, x
+			case 6: // rotated 90° clockwise
+				sx, sy = y, h-1-x
+			case 7: // mirrored along the top-right diagonal
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotated 90° counter-clockwise
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			dst.Set(x, y, src.At(b.Min.X+sx, b.Min.Y+sy))
+		}
+	}
+	return dst
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNGMetadata drops the eXIf and text chunks of a PNG
+func stripPNGMetadata(data []byte) ([]byte, error) {
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	pos := len(pngSignature)
+	for pos+8 <= len(data) {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, fmt.Errorf("malformed PNG: chunk at offset %d overruns the file", pos)
+		}
+
+		switch string(data[pos+4 : pos+8]) {
+		case "eXIf", "tEXt", "iTXt", "zTXt":
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// authenticators log in to each built-in service, prompting for what they need
+var authenticators = map[string]func() error{
+	"bluesky":   func() error { return authenticateBluesky(nil) },
+	"mastodon":  authenticateMastodon,
+	"matrix":    func() error { return authenticateMatrix(nil) },
+	"reddit":    authenticateReddit,
+	"lemmy":     authenticateLemmy,
+	"pixelfed":  authenticatePixelfed,
+	"wordpress": func() error { return authenticateWordPress(nil) },
+	"ghost":     authenticateGhost,
+	"devto":     authenticateDevTo,
+}
+
+// promptDefault asks a question, returning fallback when the answer is empty
+func promptDefault(question, fallback string) (string, error) {
+	if fallback != "" {
+		question += " [" + fallback + "]"
+	}
+	answer, err := promptLine(question + ": ")
+	if answer == "" {
+		answer = fallback
+	}
+	return answer, err
+}
+
+// promptYesNo asks a yes or no question
+func promptYesNo(question string, fallback bool) (bool, error) {
+	options := "y/N"
+	if fallback {
+		options = "Y/n"
+	}
+	answer, err := promptLine(question + " [" + options + "]: ")
+	if err != nil || answer == "" {
+		return fallback, err
+	}
+	answer = strings.ToLower(answer)
+	return answer == "y" || answer == "yes", nil
+}
+
+// initCommand walks through logging in to services and choosing the post
+// defaults, and writes them to the config
+func initCommand(args []string) error {
+	fs := flag.NewFlagSet("init", flag.ExitOnError)
+	parseFlags(fs, args)
+
+	if !stdinIsTerminal() {
+		return withExitCode(exitValidation, fmt.Errorf("shout init asks questions, so it needs a terminal; use 'shout auth <service>' and the config file instead"))
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	fmt.Println("Welcome to shout! This sets up the services you post to and how your posts look.")
+	fmt.Println("Press Enter to take the answer in [brackets].")
+	fmt.Println()
+
+	loggedIn := loggedInServices(config)
+	fallback := strings.Join(slices.Sorted(maps.Keys(loggedIn)), ",")
+	if fallback == "" {
+		fallback = "bluesky"
+	}
+	fmt.Printf("Services: %s\n", strings.Join(slices.Sorted(maps.Keys(authenticators)), ", "))
+	var services []string
+	for {
+		answer, err := promptDefault("Which services do you want to post to? (comma-separated)", fallback)
+		if err != nil {
+			return err
+		}
+		if services, err = parseServices(answer); err == nil {
+			break
+		}
+		fmt.Println(err)
+	}
+
+	// Log in to each service, leaving out those that fail so they aren't posted to by default
+	var ready []string
+	for _, service := range services {
+		name := serviceNames[service]
+		login, ok := authenticators[service]
+		if !ok {
+			// Plugins handle their own logins
+			ready = append(ready, service)
+			continue
+		}
+		fmt.Println()
+		if loggedIn[service] {
+			again, err := promptYesNo(fmt.Sprintf("You're already logged in to %s. Log in again?", name), false)
+			if err != nil {
+				return err
+			}
+			if !again {
+				ready = append(ready, service)
+				continue
+			}
+		}
+		fmt.Printf("Logging in to %s\n", name)
+		if err := login(); err != nil {
+			fmt.Printf("Couldn't log in to %s: %v\n", name, err)
+			fmt.Printf("Run 'shout auth %s' to try again later.\n", service)
+			continue
+		}
+		ready = append(ready, service)
+	}
+	if len(ready) == 0 {
+		return withExitCode(exitAuth, fmt.Errorf("couldn't log in to any service"))
+	}
+
+	// The logins saved their sessions, so pick them up before adding the defaults
+	if config, err = loadConfig(); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	fmt.Println()
+	to, err := promptDefault("Post to which services when --to isn't given?", strings.Join(ready, ","))
+	if err != nil {
+		return err
+	}
+	if _, err := parseServices(to); err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	config.DefaultService = to
+
+	language, err := promptDefault("Language of your posts, like en or de (empty for none)", config.Defaults[ready[0]].Language)
+	if err != nil {
+		return err
+	}
+	signature, err := promptDefault("Signature added to the end of every post, like hashtags (empty for none)", config.Defaults[ready[0]].Signature)
+	if err != nil {
+		return err
+	}
+	if config.Defaults == nil {
+		config.Defaults = make(map[string]ServiceDefaults)
+	}
+	for _, service := range ready {
+		settings := config.Defaults[service]
+		settings.Language, settings.Signature = language, signature
+		config.Defaults[service] = settings
+	}
+
+	if config.ConfirmPosts, err = promptYesNo("Show each post and ask before sending it?", config.ConfirmPosts); err != nil {
+		return err
+	}
+
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	configDir, err := getConfigDir()
+	if err != nil {
+		return err
+	}
+	// Settings in config.toml win over the ones just saved to config.json
+	if _, md, _, err := loadSettingsFile(configDir); err == nil && md != nil {
+		for _, key := range []string{"default_service", "defaults", "confirm_posts"} {
+			if md.IsDefined(key) {
+				fmt.Printf("Note: %s in %s overrides the %s you chose here.\n", settingsFileName, configDir, key)
+			}
+		}
+	}
+
+	fmt.Println()
+	fmt.Printf("All set! Your config is in %s.\n", filepath.Join(configDir, "config.json"))
+	fmt.Println("Try: shout post \"Hello from shout!\"")
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// How long commands get to wind down after Ctrl-C before shout exits anyway
+const interruptGracePeriod = 10 * time.Second
+
+// rootCtx is cancelled on Ctrl-C or SIGTERM. Every HTTP request is tied to
+// it, so in-flight uploads and retries stop and commands unwind, saving
+// their state on the way out.
+var rootCtx, cancelRoot = context.WithCancel(context.Background())
+
+// handleInterrupts cancels rootCtx on the first Ctrl-C or SIGTERM. A second
+// one, or a command that doesn't finish within the grace period, exits at once.
+func handleInterrupts() {
+	http.DefaultTransport = &interruptibleTransport{base: http.DefaultTransport}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		fmt.Fprintln(os.Stderr, "\nInterrupted, stopping. Press Ctrl-C again to quit immediately.")
+		cancelRoot()
+
+		select {
+		case <-signals:
+		case <-time.After(interruptGracePeriod):
+		}
+		os.Exit(exitInterrupted)
+	}()
+}
+
+// interruptibleTransport cancels requests, including reading their response
+// bodies, when rootCtx is cancelled
+type interruptibleTransport struct {
+	base http.RoundTripper
+}
+
+func (t *interruptibleTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	stop := context.AfterFunc(rootCtx, cancel)
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		stop()
+		cancel()
+		return nil, err
+	}
+
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, release: func() {
+		stop()
+		cancel()
+	}}
+	return resp, nil
+}
+
+// cancelOnClose releases a request's context once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
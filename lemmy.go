@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Maximum character count of a Lemmy comment, which threads continue in
+const LemmyCharacterLimit = 10000
+
+// Maximum character count of a Lemmy post's title
+const lemmyTitleLimit = 200
+
+// LemmySession holds the instance and the login token of the account
+type LemmySession struct {
+	InstanceURL string `json:"instance_url"`
+	Username    string `json:"username"`
+	JWT         string `json:"jwt"`
+}
+
+// lemmyRequest sends a JSON request to the instance's API and decodes the
+// JSON response into out
+func lemmyRequest(session LemmySession, method, path string, body interface{}, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, session.InstanceURL+"/api/v3"+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if session.JWT != "" {
+		req.Header.Set("Authorization", "Bearer "+session.JWT)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// loadLemmySession loads the config and checks that a Lemmy session is stored
+func loadLemmySession() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.LemmySession.JWT == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with Lemmy, please run 'shout auth lemmy' first"))
+	}
+
+	return config, nil
+}
+
+// splitLemmyAccount splits user@lemmy.example into the username and the instance URL
+func splitLemmyAccount(account string) (username, instanceURL string, err error) {
+	username, instance, ok := strings.Cut(strings.TrimPrefix(strings.TrimSpace(account), "@"), "@")
+	if !ok || username == "" || instance == "" {
+		return "", "", fmt.Errorf("invalid Lemmy account %q, expected user@instance", account)
+	}
+	instance = strings.TrimSuffix(instance, "/")
+	if !strings.HasPrefix(instance, "https://") && !strings.HasPrefix(instance, "http://") {
+		instance = "https://" + instance
+	}
+	return username, instance, nil
+}
+
+func authenticateLemmy() error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use credentials from the config or environment when available, otherwise prompt
+	account, password, ok, err := configuredCredentials(config, "lemmy", "LEMMY_ACCOUNT", "LEMMY_PASSWORD")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if account, err = promptLine("Enter your Lemmy account (e.g. you@lemmy.world): "); err != nil {
+			return fmt.Errorf("failed to read account: %w", err)
+		}
+		if password, err = promptLine("Enter your Lemmy password: "); err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+	}
+
+	username, instance, err := splitLemmyAccount(account)
+	if err != nil {
+		return withExitCode(exitValidation, err)
+	}
+	session := LemmySession{InstanceURL: instance, Username: username}
+
+	login := map[string]string{"username_or_email": username, "password": password}
+	var response struct {
+		JWT string `json:"jwt"`
+	}
+	err = lemmyRequest(session, "POST", "/user/login", login, &response)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && strings.Contains(statusErr.Body, "missing_totp_token") {
+		if login["totp_2fa_token"], err = promptLine("Enter your two-factor authentication code: "); err != nil {
+			return fmt.Errorf("failed to read code: %w", err)
+		}
+		err = lemmyRequest(session, "POST", "/user/login", login, &response)
+	}
+	if err != nil {
+		return withExitCode(exitAuth, fmt.Errorf("login failed: %w", err))
+	}
+	if response.JWT == "" {
+		return withExitCode(exitAuth, fmt.Errorf("login failed: the instance sent no token, the account may still need to be approved"))
+	}
+	session.JWT = response.JWT
+
+	config.LemmySession = session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with Lemmy as %s@%s!\n", username, strings.TrimPrefix(strings.TrimPrefix(instance, "https://"), "http://"))
+	return nil
+}
+
+// lemmyCommunityID looks up a community like golang@lemmy.ml, or a local one
+// by its name alone
+func lemmyCommunityID(session LemmySession, community string) (int, error) {
+	name := strings.TrimPrefix(strings.TrimPrefix(community, "!"), "c/")
+	var response struct {
+		CommunityView struct {
+			Community struct {
+				ID int `json:"id"`
+			} `json:"community"`
+		} `json:"community_view"`
+	}
+	if err := lemmyRequest(session, "GET", "/community?name="+url.QueryEscape(name), nil, &response); err != nil {
+		return 0, fmt.Errorf("failed to look up the community %s: %w", community, err)
+	}
+	return response.CommunityView.Community.ID, nil
+}
+
+// checkLemmyPost checks a post that would start a new Lemmy post
+func checkLemmyPost(post *Post) error {
+	if post.Community == "" {
+		return withExitCode(exitValidation, fmt.Errorf("posting to Lemmy needs a --community, or a community in the lemmy defaults"))
+	}
+	title, _ := splitTitle(post)
+	if title == "" {
+		return withExitCode(exitValidation, fmt.Errorf("posting to Lemmy needs a --title, or a first line to use as the title"))
+	}
+	if length := utf8.RuneCountInString(title); length > lemmyTitleLimit {
+		return withExitCode(exitValidation, fmt.Errorf("the Lemmy title is %d characters, over the limit of %d. Pass a shorter --title", length, lemmyTitleLimit))
+	}
+	return nil
+}
+
+// lemmySpoiler hides text behind a content warning with Lemmy's spoiler markdown
+func lemmySpoiler(warning, text string) string {
+	if warning == "" || text == "" {
+		return text
+	}
+	return "::: spoiler " + warning + "\n" + text + "\n:::"
+}
+
+// PostToLemmy creates a post in its community, or replies to a post of a
+// thread with a comment. A body that is only a link becomes the post's link.
+func PostToLemmy(post *Post) (*PostResult, error) {
+	config, err := loadLemmySession()
+	if err != nil {
+		return nil, err
+	}
+	session := config.LemmySession
+
+	var result *PostResult
+	if post.ReplyTo != nil {
+		// Comments belong to the thread's post, in reply to the comment before them
+		root := post.ThreadRoot
+		if root == nil {
+			root = post.ReplyTo
+		}
+		_, postID, err := splitPostID(root.ID)
+		if err != nil {
+			return nil, err
+		}
+		comment := map[string]interface{}{"content": lemmySpoiler(post.ContentWarning, post.Text), "post_id": postID}
+		if kind, parentID, err := splitPostID(post.ReplyTo.ID); err == nil && kind == "comment" {
+			comment["parent_id"] = parentID
+		}
+
+		var response struct {
+			CommentView struct {
+				Comment struct {
+					ID   int    `json:"id"`
+					APID string `json:"ap_id"`
+				} `json:"comment"`
+			} `json:"comment_view"`
+		}
+		if err := lemmyRequest(session, "POST", "/comment", comment, &response); err != nil {
+			return nil, fmt.Errorf("commenting failed: %w", err)
+		}
+		c := response.CommentView.Comment
+		result = &PostResult{ID: "comment:" + strconv.Itoa(c.ID), URI: c.APID, URL: session.InstanceURL + "/comment/" + strconv.Itoa(c.ID)}
+	} else {
+		if err := checkLemmyPost(post); err != nil {
+			return nil, err
+		}
+		communityID, err := lemmyCommunityID(session, post.Community)
+		if err != nil {
+			return nil, err
+		}
+
+		title, body := splitTitle(post)
+		created := map[string]interface{}{"name": title, "community_id": communityID}
+		switch {
+		case isOnlyLink(body):
+			created["url"] = body
+		case body != "":
+			created["body"] = lemmySpoiler(post.ContentWarning, body)
+		}
+		if len(post.Labels) > 0 {
+			created["nsfw"] = true
+		}
+
+		var response struct {
+			PostView struct {
+				Post struct {
+					ID   int    `json:"id"`
+					APID string `json:"ap_id"`
+				} `json:"post"`
+			} `json:"post_view"`
+		}
+		if err := lemmyRequest(session, "POST", "/post", created, &response); err != nil {
+			return nil, fmt.Errorf("posting failed: %w", err)
+		}
+		p := response.PostView.Post
+		result = &PostResult{ID: "post:" + strconv.Itoa(p.ID), URI: p.APID, URL: session.InstanceURL + "/post/" + strconv.Itoa(p.ID)}
+	}
+
+	successf("Successfully posted to Lemmy!\n  URL: %s\n", result.URL)
+
+	if err := recordHistory("lemmy", post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// lemmyItemView is a post or comment as Lemmy's API returns it
+type lemmyItemView struct {
+	Post struct {
+		Deleted bool `json:"deleted"`
+	} `json:"post"`
+	Comment struct {
+		Deleted bool `json:"deleted"`
+	} `json:"comment"`
+	Creator struct {
+		ID int `json:"id"`
+	} `json:"creator"`
+}
+
+// deleteLemmyPost deletes a post or comment by the ID PostToLemmy returned,
+// after checking that it's still there and ours
+func deleteLemmyPost(id string) error {
+	config, err := loadLemmySession()
+	if err != nil {
+		return err
+	}
+	kind, number, err := splitPostID(id)
+	if err != nil {
+		return err
+	}
+	session := config.LemmySession
+
+	var current struct {
+		PostView    *lemmyItemView `json:"post_view"`
+		CommentView *lemmyItemView `json:"comment_view"`
+	}
+	err = lemmyRequest(session, "GET", fmt.Sprintf("/%s?id=%d", kind, number), nil, &current)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return err
+	}
+	view, deleted := current.PostView, false
+	if view != nil {
+		deleted = view.Post.Deleted
+	}
+	if kind == "comment" {
+		// A comment comes with its post, which may be deleted without the comment
+		if view = current.CommentView; view != nil {
+			deleted = view.Comment.Deleted
+		}
+	}
+	if view == nil || deleted {
+		return errAlreadyDeleted
+	}
+	// The login may have been an email address, so compare IDs rather than names
+	var site struct {
+		MyUser struct {
+			LocalUserView struct {
+				Person struct {
+					ID int `json:"id"`
+				} `json:"person"`
+			} `json:"local_user_view"`
+		} `json:"my_user"`
+	}
+	if err := lemmyRequest(session, "GET", "/site", nil, &site); err != nil {
+		return err
+	}
+	if view.Creator.ID != site.MyUser.LocalUserView.Person.ID {
+		return errOtherAccount
+	}
+
+	err = lemmyRequest(session, "POST", "/"+kind+"/delete", map[string]interface{}{kind + "_id": number, "deleted": true}, nil)
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}
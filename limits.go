@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// rateLimit is a service's rate limit headroom as its last response reported it
+type rateLimit struct {
+	Service   string     `json:"service"`
+	Remaining *int       `json:"remaining"`
+	Limit     *int       `json:"limit"`
+	Reset     *time.Time `json:"reset"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// headerCapture keeps the headers of the last response, which carry the rate limits
+type headerCapture struct {
+	base   http.RoundTripper
+	mu     sync.Mutex
+	header http.Header
+}
+
+func (t *headerCapture) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err == nil {
+		t.mu.Lock()
+		t.header = resp.Header
+		t.mu.Unlock()
+	}
+	return resp, err
+}
+
+// last returns the headers of the last response and forgets them
+func (t *headerCapture) last() http.Header {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	header := t.header
+	t.header = nil
+	return header
+}
+
+// probeService makes a lightweight authenticated request to a service, so
+// its response reports the rate limit. ok is false for services whose APIs
+// don't report one.
+func probeService(service string) (ok bool, err error) {
+	switch service {
+	case "bluesky":
+		config, err := loadBlueskySession()
+		if err != nil {
+			return true, err
+		}
+		var session map[string]interface{}
+		return true, blueskyGet(config, "com.atproto.server.getSession", url.Values{}, &session)
+	case "mastodon", "pixelfed":
+		config, err := loadMastodonAPISession(service)
+		if err != nil {
+			return true, err
+		}
+		return true, mastodonRequest(*mastodonAPISession(config, service), "GET", "/api/v1/accounts/verify_credentials", "", nil, nil)
+	case "reddit":
+		config, err := loadRedditSession()
+		if err != nil {
+			return true, err
+		}
+		return true, redditRequest(config.RedditSession, "GET", "/api/v1/me", nil, nil)
+	}
+	return false, nil
+}
+
+// headerInt reads the first of the headers that's set as a whole number.
+// Reddit sends its counts as decimals.
+func headerInt(header http.Header, names ...string) *int {
+	for _, name := range names {
+		if value, err := strconv.ParseFloat(header.Get(name), 64); err == nil {
+			n := int(math.Floor(value))
+			return &n
+		}
+	}
+	return nil
+}
+
+// parseRateLimit reads the RateLimit-* headers Bluesky sends and the
+// X-RateLimit-* ones of Mastodon and Reddit. The reset is a Unix time on
+// Bluesky, a timestamp on Mastodon, and seconds from now on Reddit.
+func parseRateLimit(header http.Header, now time.Time) rateLimit {
+	var limit rateLimit
+	limit.Remaining = headerInt(header, "RateLimit-Remaining", "X-RateLimit-Remaining")
+	limit.Limit = headerInt(header, "RateLimit-Limit", "X-RateLimit-Limit")
+	if used := headerInt(header, "X-RateLimit-Used"); limit.Limit == nil && used != nil && limit.Remaining != nil {
+		total := *used + *limit.Remaining
+		limit.Limit = &total
+	}
+
+	reset := header.Get("RateLimit-Reset")
+	if reset == "" {
+		reset = header.Get("X-RateLimit-Reset")
+	}
+	if at, err := time.Parse(time.RFC3339, reset); err == nil {
+		limit.Reset = &at
+	} else if seconds, err := strconv.ParseFloat(reset, 64); err == nil {
+		at := now.Add(time.Duration(seconds * float64(time.Second)))
+		// Small numbers count from now, large ones are Unix times
+		if seconds > 1e9 {
+			at = time.Unix(int64(seconds), 0)
+		}
+		limit.Reset = &at
+	}
+	return limit
+}
+
+// limitsCommand reports the rate limit headroom on each service
+func limitsCommand(args []string) error {
+	fs := flag.NewFlagSet("limits", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "print the limits as JSON")
+	positional := parseFlags(fs, args)
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	services := healthServices(config)
+	if len(positional) > 0 {
+		if services, err = parseServices(strings.Join(positional, ",")); err != nil {
+			return withExitCode(exitValidation, err)
+		}
+	}
+
+	capture := &headerCapture{base: http.DefaultTransport}
+	http.DefaultTransport = capture
+	defer func() { http.DefaultTransport = capture.base }()
+
+	var limits []rateLimit
+	failed := 0
+	for _, service := range services {
+		ok, err := probeService(service)
+		limit := parseRateLimit(capture.last(), time.Now())
+		limit.Service = service
+		if err != nil {
+			limit.Error = err.Error()
+			failed++
+		} else if !ok || limit.Remaining == nil {
+			limit.Error = "not reported"
+		}
+		limits = append(limits, limit)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(limits); err != nil {
+			return err
+		}
+	} else {
+		printRateLimits(limits)
+	}
+	if failed > 0 {
+		return fmt.Errorf("couldn't check %d service(s)", failed)
+	}
+	return nil
+}
+
+func printRateLimits(limits []rateLimit) {
+	if plain {
+		for _, limit := range limits {
+			name := serviceNames[limit.Service]
+			if limit.Error != "" {
+				fmt.Printf("%s: %s\n", name, limit.Error)
+				continue
+			}
+			line := fmt.Sprintf("%s: %d requests left", name, *limit.Remaining)
+			if limit.Limit != nil {
+				line += fmt.Sprintf(" of %d", *limit.Limit)
+			}
+			if limit.Reset != nil {
+				line += fmt.Sprintf(", resets in %s at %s", time.Until(*limit.Reset).Round(time.Second), limit.Reset.Local().Format("15:04"))
+			}
+			fmt.Println(line)
+		}
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tREMAINING\tLIMIT\tRESETS")
+	for _, limit := range limits {
+		name := serviceNames[limit.Service]
+		if limit.Error != "" {
+			fmt.Fprintf(w, "%s\t-\t-\t%s\n", name, limit.Error)
+			continue
+		}
+		total, resets := "-", "-"
+		if limit.Limit != nil {
+			total = strconv.Itoa(*limit.Limit)
+		}
+		if limit.Reset != nil {
+			resets = fmt.Sprintf("in %s (%s)", time.Until(*limit.Reset).Round(time.Second), limit.Reset.Local().Format("15:04"))
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", name, *limit.Remaining, total, resets)
+	}
+	w.Flush()
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Largest amount of a linked page read when looking for its metadata
+const maxLinkPageSize = 1 << 20
+
+var (
+	urlPattern     = regexp.MustCompile(`https?://[^\s<>"]+`)
+	metaTagPattern = regexp.MustCompile(`(?is)<meta\s[^>]*>`)
+	metaAttrs      = regexp.MustCompile(`(?is)(property|name|content)\s*=\s*("[^"]*"|'[^']*')`)
+	titlePattern   = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// firstURL returns the first http(s) link in text, without trailing punctuation
+func firstURL(text string) string {
+	return strings.TrimRight(urlPattern.FindString(text), ".,;:!?)'\"")
+}
+
+// linkMetadata is the OpenGraph preview information of a web page
+type linkMetadata struct {
+	Title       string
+	Description string
+	ImageURL    string
+}
+
+// fetchLinkMetadata reads the OpenGraph (or plain HTML) title, description, and image of a page
+func fetchLinkMetadata(link string) (*linkMetadata, error) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Get(link)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", link, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: status %d", link, resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxLinkPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", link, err)
+	}
+	page := string(body)
+
+	meta := make(map[string]string)
+	for _, tag := range metaTagPattern.FindAllString(page, -1) {
+		var key, content string
+		for _, attr := range metaAttrs.FindAllStringSubmatch(tag, -1) {
+			value := html.UnescapeString(attr[2][1 : len(attr[2])-1])
+			if strings.EqualFold(attr[1], "content") {
+				content = value
+			} else {
+				key = strings.ToLower(value)
+			}
+		}
+		if key != "" && meta[key] == "" {
+			meta[key] = strings.TrimSpace(content)
+		}
+	}
+
+	md := &linkMetadata{
+		Title:       meta["og:title"],
+		Description: meta["og:description"],
+		ImageURL:    meta["og:image"],
+	}
+	if md.Title == "" {
+		if m := titlePattern.FindStringSubmatch(page); m != nil {
+			md.Title = strings.TrimSpace(html.UnescapeString(m[1]))
+		}
+	}
+	if md.Description == "" {
+		md.Description = meta["description"]
+	}
+	if md.ImageURL != "" {
+		if imageURL, err := resp.Request.URL.Parse(md.ImageURL); err == nil {
+			md.ImageURL = imageURL.String()
+		}
+	}
+
+	return md, nil
+}
+
+// downloadImage fetches an image over HTTP
+func downloadImage(imageURL string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(imageURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// linkCardMetadata fetches a page's card details and applies the post's own
+// title and description over them. With a title of its own, a card is made
+// even if the page can't be fetched.
+func linkCardMetadata(post *Post, link string) (*linkMetadata, error) {
+	md, err := fetchLinkMetadata(link)
+	if err != nil {
+		if post.CardTitle == "" {
+			return nil, err
+		}
+		warnf("%v; making the card from --card-title\n", err)
+		md = &linkMetadata{}
+	}
+	if post.CardTitle != "" {
+		md.Title = post.CardTitle
+	}
+	if post.CardDescription != "" {
+		md.Description = post.CardDescription
+	}
+	return md, nil
+}
+
+// buildBlueskyLinkCard creates an app.bsky.embed.external card for link,
+// uploading the page's preview image as the thumbnail when it has one
+func buildBlueskyLinkCard(config *Config, post *Post, link string) (map[string]interface{}, error) {
+	md, err := linkCardMetadata(post, link)
+	if err != nil {
+		return nil, err
+	}
+
+	external := map[string]interface{}{
+		"uri":         link,
+		"title":       md.Title,
+		"description": md.Description,
+	}
+
+	if len(post.CardImage) > 0 {
+		image, err := prepareImage("bluesky", post, Image{Data: post.CardImage})
+		if err == nil {
+			external["thumb"], err = uploadBlueskyBlob(config, image)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to add the card image: %w", err)
+		}
+	} else if md.ImageURL != "" {
+		thumb, err := linkCardThumbnail(config, post, md.ImageURL)
+		if err != nil {
+			warnf("failed to add link card image: %v\n", err)
+		} else {
+			external["thumb"] = thumb
+		}
+	}
+
+	return map[string]interface{}{
+		"$type":    "app.bsky.embed.external",
+		"external": external,
+	}, nil
+}
+
+func linkCardThumbnail(config *Config, post *Post, imageURL string) (interface{}, error) {
+	data, err := downloadImage(imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	image, err := prepareImage("bluesky", post, Image{Data: data})
+	if err != nil {
+		return nil, err
+	}
+
+	return uploadBlueskyBlob(config, image)
+}
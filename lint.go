@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// mentionPattern matches Bluesky (@handle.example.com) and fediverse (@user@example.com) mentions
+var mentionPattern = regexp.MustCompile(`(?:^|[\s(])@([A-Za-z0-9_]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}|[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)+)`)
+
+// lintIssue is a problem found by shout lint
+type lintIssue struct {
+	Severity string `json:"severity"` // "error" if the post would fail, otherwise "warning"
+	Check    string `json:"check"`
+	Service  string `json:"service,omitempty"`
+	Message  string `json:"message"`
+}
+
+// checkLink reports whether a link can be fetched, trying GET for servers that don't allow HEAD
+func checkLink(client *http.Client, link string) error {
+	resp, err := client.Head(link)
+	if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented) {
+		resp.Body.Close()
+		resp, err = client.Get(link)
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// checkMention reports whether a mention refers to an existing account
+func checkMention(client *http.Client, mention string) error {
+	user, host, fediverse := strings.Cut(mention, "@")
+	if !fediverse {
+		_, err := lookupDID(mention)
+		return err
+	}
+
+	webfinger := "https://" + host + "/.well-known/webfinger?resource=" + url.QueryEscape("acct:"+user+"@"+host)
+	resp, err := client.Get(webfinger)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("no such account on %s", host)
+	}
+	return nil
+}
+
+// lintPost checks a message and its images for problems before posting to the given services
+func lintPost(config *Config, base Post, services []string) []lintIssue {
+	var issues []lintIssue
+
+	for _, service := range services {
+		post := postForService(base, config.Defaults[service])
+		if err := checkLengthFor(service, post.Text); err != nil {
+			issues = append(issues, lintIssue{"error", "length", service, err.Error()})
+		}
+		if err := checkImageCount(service, len(post.Images)); err != nil {
+			issues = append(issues, lintIssue{"error", "image-count", service, err.Error()})
+		}
+		if err := checkVisibility(service, post); err != nil {
+			issues = append(issues, lintIssue{"error", "visibility", service, err.Error()})
+		}
+	}
+
+	for i, image := range base.Images {
+		if strings.TrimSpace(image.Alt) == "" {
+			issues = append(issues, lintIssue{"warning", "alt-text", "", fmt.Sprintf("image %d has no alt text", i+1)})
+		}
+	}
+
+	if strings.Contains(base.Text, "  ") {
+		issues = append(issues, lintIssue{"warning", "double-space", "", "message contains double spaces"})
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	for _, match := range urlPattern.FindAllString(base.Text, -1) {
+		link := strings.TrimRight(match, ".,;:!?)'\"")
+		if err := checkLink(client, link); err != nil {
+			issues = append(issues, lintIssue{"error", "dead-link", "", fmt.Sprintf("%s is unreachable: %v", link, err)})
+		}
+	}
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(base.Text, -1) {
+		if err := checkMention(client, match[1]); err != nil {
+			issues = append(issues, lintIssue{"warning", "mention", "", fmt.Sprintf("@%s can't be resolved: %v", match[1], err)})
+		}
+	}
+
+	return issues
+}
+
+func lintCommand(args []string) error {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	to := fs.String("to", "", "comma-separated services to check against (bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto); default_service in the config, or bluesky, if not given")
+	var imagePaths, altTexts stringList
+	fs.Var(&imagePaths, "image", "an image file to attach (repeatable)")
+	fs.Var(&altTexts, "alt", "alt text for the image in the same position (repeatable)")
+	jsonOutput := fs.Bool("json", false, "print the problems as JSON")
+	positional := parseFlags(fs, args)
+
+	if len(positional) == 0 {
+		fmt.Println("Usage: shout lint [--to bluesky,mastodon] [--image <path> [--alt <text>]]... [--json] <message>")
+		os.Exit(1)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	services, err := servicesFor(config, *to)
+	if err != nil {
+		return err
+	}
+
+	post := Post{Text: positional[0]}
+	for i, path := range imagePaths {
+		data, err := readImage(path)
+		if err != nil {
+			return err
+		}
+
+		image := Image{Data: data}
+		if i < len(altTexts) {
+			image.Alt = altTexts[i]
+		}
+		post.Images = append(post.Images, image)
+	}
+
+	issues := lintPost(config, post, services)
+
+	errorCount := 0
+	for _, issue := range issues {
+		if issue.Severity == "error" {
+			errorCount++
+		}
+	}
+
+	if *jsonOutput {
+		if issues == nil {
+			issues = []lintIssue{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			return err
+		}
+		if errorCount > 0 {
+			os.Exit(exitValidation)
+		}
+		return nil
+	}
+
+	for _, issue := range issues {
+		check := issue.Check
+		if issue.Service != "" {
+			check += " (" + serviceNames[issue.Service] + ")"
+		}
+		style := styleWarning
+		if issue.Severity == "error" {
+			style = styleError
+		}
+		fmt.Printf("%s %s: %s\n", colorize(os.Stdout, style, fmt.Sprintf("%-8s", issue.Severity)), check, issue.Message)
+	}
+
+	if errorCount > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("found %d error(s)", errorCount))
+	}
+	if len(issues) == 0 {
+		infof("No problems found.\n")
+	}
+	return nil
+}
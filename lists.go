@@ -0,0 +1,314 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Purposes a Bluesky list can have
+var listPurposes = map[string]string{
+	"curate": "app.bsky.graph.defs#curatelist",
+	"mod":    "app.bsky.graph.defs#modlist",
+}
+
+// blueskyListView is a list as returned by app.bsky.graph.getLists
+type blueskyListView struct {
+	URI           string `json:"uri"`
+	Name          string `json:"name"`
+	Purpose       string `json:"purpose"`
+	Description   string `json:"description"`
+	ListItemCount int    `json:"listItemCount"`
+}
+
+// blueskyListURL builds the bsky.app link for a list record URI
+func blueskyListURL(actor, uri string) string {
+	rkey := uri[strings.LastIndex(uri, "/")+1:]
+	return fmt.Sprintf("https://bsky.app/profile/%s/lists/%s", actor, rkey)
+}
+
+// getOwnLists returns every list of the logged in account
+func getOwnLists(config *Config) ([]blueskyListView, error) {
+	var lists []blueskyListView
+	cursor := ""
+	for {
+		params := url.Values{"actor": {config.BlueskySession.Did}, "limit": {"100"}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		var page struct {
+			Lists  []blueskyListView `json:"lists"`
+			Cursor string            `json:"cursor"`
+		}
+		if err := blueskyGet(config, "app.bsky.graph.getLists", params, &page); err != nil {
+			return nil, err
+		}
+		lists = append(lists, page.Lists...)
+		if page.Cursor == "" || len(page.Lists) == 0 {
+			return lists, nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+// listURIFromReference turns a bsky.app list URL, an at:// URI, or the name
+// of one of your lists into the list's at:// URI
+func listURIFromReference(config *Config, ref string) (string, error) {
+	if strings.HasPrefix(ref, "at://") {
+		return ref, nil
+	}
+
+	// https://bsky.app/profile/<handle or did>/lists/<rkey>
+	if u, err := url.Parse(ref); err == nil && u.Host != "" {
+		parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+		if len(parts) != 4 || parts[0] != "profile" || parts[2] != "lists" {
+			return "", fmt.Errorf("not a Bluesky list URL: %s", ref)
+		}
+		actor := parts[1]
+		if !strings.HasPrefix(actor, "did:") {
+			if actor, err = resolveHandle(config, actor); err != nil {
+				return "", fmt.Errorf("failed to resolve handle %s: %w", parts[1], err)
+			}
+		}
+		return fmt.Sprintf("at://%s/app.bsky.graph.list/%s", actor, parts[3]), nil
+	}
+
+	lists, err := getOwnLists(config)
+	if err != nil {
+		return "", err
+	}
+	var found []string
+	for _, list := range lists {
+		if strings.EqualFold(list.Name, ref) {
+			found = append(found, list.URI)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", withExitCode(exitValidation, fmt.Errorf("you have no list named %q", ref))
+	case 1:
+		return found[0], nil
+	default:
+		return "", withExitCode(exitValidation, fmt.Errorf("you have %d lists named %q; use the list's URL instead", len(found), ref))
+	}
+}
+
+// actorDID returns the DID of a handle, or the DID itself
+func actorDID(config *Config, actor string) (string, error) {
+	if strings.HasPrefix(actor, "did:") {
+		return actor, nil
+	}
+	did, err := resolveHandle(config, actor)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve handle %s: %w", actor, err)
+	}
+	return did, nil
+}
+
+// findOwnRecords returns the record keys of the logged in account's records
+// in a collection whose value matches
+func findOwnRecords(config *Config, collection string, matches func(value map[string]interface{}) bool) ([]string, error) {
+	var rkeys []string
+	cursor := ""
+	for {
+		params := url.Values{"repo": {config.BlueskySession.Did}, "collection": {collection}, "limit": {"100"}}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		var page struct {
+			Records []struct {
+				URI   string                 `json:"uri"`
+				Value map[string]interface{} `json:"value"`
+			} `json:"records"`
+			Cursor string `json:"cursor"`
+		}
+		if err := blueskyGet(config, "com.atproto.repo.listRecords", params, &page); err != nil {
+			return nil, err
+		}
+		for _, record := range page.Records {
+			if matches(record.Value) {
+				_, _, rkey, err := parseATURI(record.URI)
+				if err != nil {
+					return nil, err
+				}
+				rkeys = append(rkeys, rkey)
+			}
+		}
+		if page.Cursor == "" || len(page.Records) == 0 {
+			return rkeys, nil
+		}
+		cursor = page.Cursor
+	}
+}
+
+// findListItems returns the record keys of the list item records that add
+// subject to the list. Normally there is one, but nothing stops duplicates.
+func findListItems(config *Config, listURI, subject string) ([]string, error) {
+	return findOwnRecords(config, "app.bsky.graph.listitem", func(value map[string]interface{}) bool {
+		return value["list"] == listURI && value["subject"] == subject
+	})
+}
+
+func createListCommand(config *Config, args []string) error {
+	fs := flag.NewFlagSet("list create", flag.ExitOnError)
+	description := fs.String("description", "", "what the list is for")
+	purpose := fs.String("purpose", "curate", "curate, for a list people can follow as a feed, or mod, for muting or blocking its members")
+	positional := parseFlags(fs, args)
+
+	if len(positional) != 1 {
+		fmt.Println("Usage: shout list create [--description <text>] [--purpose curate|mod] <name>")
+		os.Exit(1)
+	}
+	purposeType, ok := listPurposes[*purpose]
+	if !ok {
+		return fmt.Errorf("unknown list purpose %q, expected curate or mod", *purpose)
+	}
+
+	record := map[string]interface{}{
+		"$type":     "app.bsky.graph.list",
+		"purpose":   purposeType,
+		"name":      positional[0],
+		"createdAt": time.Now().Format(time.RFC3339),
+	}
+	if *description != "" {
+		record["description"] = *description
+	}
+
+	var result PostResult
+	err := blueskyProcedure(config, "com.atproto.repo.createRecord", map[string]interface{}{
+		"repo":       config.BlueskySession.Did,
+		"collection": "app.bsky.graph.list",
+		"record":     record,
+	}, &result)
+	if err != nil {
+		return fmt.Errorf("creating the list failed: %w", err)
+	}
+
+	listURL := blueskyListURL(config.BlueskySession.Did, result.URI)
+	if quiet {
+		fmt.Println(listURL)
+	}
+	infof("Created the list %q\n  URL: %s\n  URI: %s\n", positional[0], listURL, result.URI)
+	return nil
+}
+
+func addToListCommand(config *Config, listURI, member string) error {
+	subject, err := actorDID(config, member)
+	if err != nil {
+		return err
+	}
+
+	existing, err := findListItems(config, listURI, subject)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		infof("%s is already on the list\n", member)
+		return nil
+	}
+
+	err = blueskyProcedure(config, "com.atproto.repo.createRecord", map[string]interface{}{
+		"repo":       config.BlueskySession.Did,
+		"collection": "app.bsky.graph.listitem",
+		"record": map[string]interface{}{
+			"$type":     "app.bsky.graph.listitem",
+			"subject":   subject,
+			"list":      listURI,
+			"createdAt": time.Now().Format(time.RFC3339),
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("adding %s failed: %w", member, err)
+	}
+	infof("Added %s to the list\n", member)
+	return nil
+}
+
+func removeFromListCommand(config *Config, listURI, member string) error {
+	subject, err := actorDID(config, member)
+	if err != nil {
+		return err
+	}
+
+	rkeys, err := findListItems(config, listURI, subject)
+	if err != nil {
+		return err
+	}
+	if len(rkeys) == 0 {
+		return withExitCode(exitValidation, fmt.Errorf("%s isn't on the list", member))
+	}
+
+	for _, rkey := range rkeys {
+		err := blueskyProcedure(config, "com.atproto.repo.deleteRecord", map[string]interface{}{
+			"repo":       config.BlueskySession.Did,
+			"collection": "app.bsky.graph.listitem",
+			"rkey":       rkey,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("removing %s failed: %w", member, err)
+		}
+	}
+	infof("Removed %s from the list\n", member)
+	return nil
+}
+
+func listCommand(args []string) error {
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		lists, err := getOwnLists(config)
+		if err != nil {
+			return err
+		}
+		if len(lists) == 0 {
+			fmt.Println("You have no lists. Create one with 'shout list create <name>'.")
+			return nil
+		}
+		for _, list := range lists {
+			purpose := "curate"
+			if list.Purpose == listPurposes["mod"] {
+				purpose = "mod"
+			}
+			fmt.Printf("%s\t%s\t%d member(s)\t%s\n", list.Name, purpose, list.ListItemCount, blueskyListURL(config.BlueskySession.Did, list.URI))
+		}
+		return nil
+	}
+
+	switch args[0] {
+	case "create":
+		return createListCommand(config, args[1:])
+
+	case "add", "remove":
+		if len(args) < 3 {
+			fmt.Printf("Usage: shout list %s <list> <handle>...\n", args[0])
+			os.Exit(1)
+		}
+		listURI, err := listURIFromReference(config, args[1])
+		if err != nil {
+			return err
+		}
+		if repo, _, _, err := parseATURI(listURI); err != nil || repo != config.BlueskySession.Did {
+			return withExitCode(exitValidation, fmt.Errorf("%s isn't one of your lists", args[1]))
+		}
+		for _, member := range args[2:] {
+			if args[0] == "add" {
+				err = addToListCommand(config, listURI, member)
+			} else {
+				err = removeFromListCommand(config, listURI, member)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("unknown list command: %s (expected create, add, or remove)", args[0])
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// Log levels, from most to least verbose
+const (
+	logDebug = iota
+	logInfo
+	logWarn
+	logError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+// slogLevels maps the log levels to slog's
+var slogLevels = []slog.Level{slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError}
+
+// Rotation defaults used when the config leaves them out
+const (
+	defaultLogMaxSizeMB = 10
+	defaultLogMaxFiles  = 5
+)
+
+// LogConfig turns on writing a log file. With only a path, info and above is
+// logged as text, and the file is rotated at 10 MB keeping 5 old files.
+type LogConfig struct {
+	Path      string `json:"path,omitempty" toml:"path"`     // "-" logs to stderr
+	Level     string `json:"level,omitempty" toml:"level"`   // debug, info, warn, or error
+	Format    string `json:"format,omitempty" toml:"format"` // text or json
+	MaxSizeMB int    `json:"max_size_mb,omitempty" toml:"max_size_mb"`
+	MaxFiles  int    `json:"max_files,omitempty" toml:"max_files"`
+}
+
+// level returns the configured log level
+func (c LogConfig) level() (int, error) {
+	if c.Level == "" {
+		return logInfo, nil
+	}
+	for level, name := range logLevelNames {
+		if strings.EqualFold(c.Level, name) {
+			return level, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, expected debug, info, warn, or error", c.Level)
+}
+
+// handler returns the slog handler for the configured format, writing to w
+func (c LogConfig) handler(w io.Writer, level int) (slog.Handler, error) {
+	options := &slog.HandlerOptions{Level: slogLevels[level]}
+	switch strings.ToLower(c.Format) {
+	case "", "text":
+		return slog.NewTextHandler(w, options), nil
+	case "json":
+		return slog.NewJSONHandler(w, options), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q, expected text or json", c.Format)
+}
+
+// fileLogger appends to the log file, rotating it when it grows past maxSize.
+// slog writes each record with a single Write.
+type fileLogger struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+}
+
+// logger is set when the config has a log file
+var logger *slog.Logger
+
+// logToStderr is set when the log goes to stderr, which then shows the
+// messages it records in its own format instead of as plain output
+var logToStderr bool
+
+// setupLogging opens the log file named in the config, if any. HTTP requests
+// are logged at the debug level.
+func setupLogging() error {
+	// Commands report a config that can't be loaded themselves
+	config, err := loadConfig()
+	if err != nil || config.Log.Path == "" {
+		return nil
+	}
+
+	level, err := config.Log.level()
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = os.Stderr
+	if config.Log.Path != "-" {
+		path, err := homedir.Expand(config.Log.Path)
+		if err != nil {
+			return err
+		}
+
+		l := &fileLogger{path: path, maxSize: defaultLogMaxSizeMB << 20, maxFiles: defaultLogMaxFiles}
+		if config.Log.MaxSizeMB > 0 {
+			l.maxSize = int64(config.Log.MaxSizeMB) << 20
+		}
+		if config.Log.MaxFiles > 0 {
+			l.maxFiles = config.Log.MaxFiles
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return fmt.Errorf("failed to create log directory: %w", err)
+		}
+		if err := l.open(); err != nil {
+			return err
+		}
+		w = l
+	}
+
+	handler, err := config.Log.handler(w, level)
+	if err != nil {
+		return err
+	}
+	// The process ID tells runs that overlap apart
+	logger = slog.New(handler).With("pid", os.Getpid())
+	logToStderr = config.Log.Path == "-"
+	if level == logDebug {
+		http.DefaultTransport = &loggingTransport{base: http.DefaultTransport}
+	}
+	return nil
+}
+
+func (l *fileLogger) open() error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+	l.file = file
+	return nil
+}
+
+// rotate renames the log to .1, .1 to .2, and so on, dropping the oldest, and starts a new log
+func (l *fileLogger) rotate() error {
+	l.file.Close()
+	os.Remove(fmt.Sprintf("%s.%d", l.path, l.maxFiles))
+	for n := l.maxFiles - 1; n >= 1; n-- {
+		os.Rename(fmt.Sprintf("%s.%d", l.path, n), fmt.Sprintf("%s.%d", l.path, n+1))
+	}
+	if err := os.Rename(l.path, l.path+".1"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return l.open()
+}
+
+func (l *fileLogger) Write(record []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Another shout process may have rotated the log since it was opened
+	info, err := os.Stat(l.path)
+	if opened, openedErr := l.file.Stat(); err != nil || openedErr != nil || !os.SameFile(info, opened) {
+		l.file.Close()
+		if err = l.open(); err == nil {
+			info, err = l.file.Stat()
+		}
+	}
+	if err == nil && info.Size() > 0 && info.Size()+int64(len(record)) > l.maxSize {
+		err = l.rotate()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to write log: %v\n", err)
+		return 0, err
+	}
+	return l.file.Write(record)
+}
+
+// loggedToStderr reports whether the log writes messages at level to
+// stderr, where they shouldn't be printed a second time
+func loggedToStderr(level int) bool {
+	return logToStderr && logger != nil && logger.Enabled(context.Background(), slogLevels[level])
+}
+
+// logf writes a message to the log, if there is one, as a record for each of
+// its lines
+func logf(level int, format string, args ...interface{}) {
+	if logger == nil {
+		return
+	}
+	for _, line := range strings.Split(fmt.Sprintf(format, args...), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			logger.Log(context.Background(), slogLevels[level], line)
+		}
+	}
+}
+
+// logEvent writes a record with attributes, like "status", 200, to the log
+func logEvent(level int, message string, attrs ...interface{}) {
+	if logger != nil {
+		logger.Log(context.Background(), slogLevels[level], message, attrs...)
+	}
+}
+
+// loggingTransport logs each HTTP request with its status and duration
+type loggingTransport struct {
+	base http.RoundTripper
+}
+
+func (t *loggingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	// Query strings can hold tokens, so only the path is logged
+	target := req.URL.Scheme + "://" + req.URL.Host + req.URL.Path
+	duration := time.Since(start).Milliseconds()
+	if err != nil {
+		logEvent(logDebug, "HTTP request failed", "method", req.Method, "url", target, "duration_ms", duration, "error", err)
+		return nil, err
+	}
+	logEvent(logDebug, "HTTP request", "method", req.Method, "url", target, "status", resp.StatusCode, "duration_ms", duration)
+	return resp, nil
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
@@ -20,7 +24,70 @@ const BlueskeyCharacterLimit = 300
 
 // Config holds the authentication tokens
 type Config struct {
-	BlueskySession BlueskySession `json:"bluesky_session"`
+	// Version is the number of config migrations applied to the file
+	Version int `json:"version"`
+
+	BlueskySession   BlueskySession   `json:"bluesky_session"`
+	MastodonSession  MastodonSession  `json:"mastodon_session"`
+	MatrixSession    MatrixSession    `json:"matrix_session"`
+	RedditSession    RedditSession    `json:"reddit_session"`
+	LemmySession     LemmySession     `json:"lemmy_session"`
+	PixelfedSession  MastodonSession  `json:"pixelfed_session"`
+	WordPressSession WordPressSession `json:"wordpress_session"`
+	GhostSession     GhostSession     `json:"ghost_session"`
+	DevToSession     DevToSession     `json:"devto_session"`
+	AI               AIConfig         `json:"ai"`
+
+	// Defaults holds per-service post settings, keyed by service name
+	Defaults map[string]ServiceDefaults `json:"defaults,omitempty"`
+
+	// Hooks are commands run before and after each post
+	Hooks Hooks `json:"hooks"`
+
+	// Credentials holds per-service login details used instead of prompting, keyed by service name
+	Credentials map[string]CredentialSource `json:"credentials,omitempty"`
+
+	// DuplicateWindow is how long (e.g. "24h") identical text can't be posted to
+	// the same service again. Empty means 24h, "0" disables the check.
+	DuplicateWindow string `json:"duplicate_window,omitempty"`
+
+	// PostsPerHour limits how often shout posts to each service, across
+	// invocations, so bots stay clear of the services' rate limits. 0 means no limit.
+	PostsPerHour int `json:"posts_per_hour,omitempty"`
+
+	// Schedules are the jobs run by shout daemon
+	Schedules []Schedule `json:"schedules,omitempty"`
+
+	// Feeds are RSS, Atom, and JSON Feed feeds whose new items shout feeds announces
+	Feeds []Feed `json:"feeds,omitempty"`
+
+	// AutoReply answers mentions while shout daemon runs
+	AutoReply AutoReplyConfig `json:"auto_reply"`
+
+	// Notifications shows a desktop notification when a queued or streamed post is delivered or fails
+	Notifications bool `json:"notifications,omitempty"`
+
+	// ConfirmPosts shows each post and asks before sending it, when shout post
+	// runs in a terminal
+	ConfirmPosts bool `json:"confirm_posts,omitempty"`
+
+	// Log writes what shout does to a file, for runs from cron or the daemon
+	Log LogConfig `json:"log"`
+
+	// DefaultService is the comma-separated services posted to when --to
+	// isn't given. Empty means bluesky.
+	DefaultService string `json:"default_service,omitempty"`
+
+	// Aliases are shortcuts for commands with their flags, keyed by name
+	Aliases map[string]string `json:"aliases,omitempty"`
+
+	// DefaultAccount is the profile used when neither --profile nor
+	// SHOUT_PROFILE picks one. Only the main config's setting counts.
+	DefaultAccount string `json:"default_account,omitempty"`
+
+	// loaded is config.json as this config was read from it or last saved
+	// to it, so saving writes only what changed since
+	loaded *Config
 }
 
 // BlueskySession holds Bluesky session information
@@ -29,6 +96,24 @@ type BlueskySession struct {
 	RefreshJwt string `json:"refresh_jwt"`
 	Handle     string `json:"handle"`
 	Did        string `json:"did"`
+
+	// ServiceURL is the server that XRPC requests go to. Empty means bsky.social.
+	ServiceURL string `json:"service_url,omitempty"`
+
+	// OAuth is set when the session was created with 'auth bluesky --oauth'
+	OAuth *BlueskyOAuth `json:"oauth,omitempty"`
+}
+
+// Server used for accounts that don't record their own
+const defaultBlueskyService = "https://bsky.social"
+
+// xrpcURL returns the URL of an XRPC method on the session's server
+func (s BlueskySession) xrpcURL(method string) string {
+	base := s.ServiceURL
+	if base == "" {
+		base = defaultBlueskyService
+	}
+	return base + "/xrpc/" + method
 }
 
 // BlueskyAuthResponse represents the response from Bluesky authentication
@@ -36,57 +121,138 @@ type BlueskyAuthResponse struct {
 	AccessJwt  string `json:"accessJwt"`
 	RefreshJwt string `json:"refreshJwt"`
 	Did        string `json:"did"`
+	Handle     string `json:"handle"`
+
+	// DidDoc lists the account's PDS, which may differ from the server that was asked
+	DidDoc *didDocument `json:"didDoc"`
+
+	// serviceURL is the server the session was created or refreshed on
+	serviceURL string
 }
 
-func loadConfig() (*Config, error) {
+// pds returns the server the session should send requests to
+func (r *BlueskyAuthResponse) pds() string {
+	if r.DidDoc != nil {
+		if endpoint, err := r.DidDoc.pdsEndpoint(); err == nil {
+			return endpoint
+		}
+	}
+	return r.serviceURL
+}
+
+// getConfigDir returns ~/.config/shout, or ~/.config/shout/profiles/<name>
+// when a profile is active, creating it if necessary
+func getConfigDir() (string, error) {
 	home, err := homedir.Dir()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get home directory: %w", err)
+		return "", fmt.Errorf("failed to get home directory: %w", err)
 	}
 
 	configDir := filepath.Join(home, ".config", "shout")
+	if activeProfile != "" {
+		configDir = filepath.Join(configDir, "profiles", activeProfile)
+	}
 	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create config directory: %w", err)
+		return "", fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	return configDir, nil
+}
+
+func loadConfig() (*Config, error) {
+	if configOverride != nil {
+		return loadConfigOverride()
+	}
+
+	configDir, err := getConfigDir()
+	if err != nil {
+		return nil, err
 	}
 
+	var config Config
 	configFile := filepath.Join(configDir, "config.json")
 	data, err := os.ReadFile(configFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return &Config{}, nil
-		}
+	if err != nil && !os.IsNotExist(err) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
+	if err == nil {
+		migrated, err := migrateConfig(configFile, data)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(migrated, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+	}
+	loaded := config
+	config.loaded = &loaded
 
-	var config Config
-	if err := json.Unmarshal(data, &config); err != nil {
-		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	// Settings in config.toml take precedence over the same ones in config.json
+	settings, md, _, err := loadSettingsFile(configDir)
+	if err != nil {
+		return nil, err
+	}
+	if settings != nil {
+		settings.applyTo(&config, md)
 	}
 
 	return &config, nil
 }
 
 func saveConfig(config *Config) error {
-	home, err := homedir.Dir()
-	if err != nil {
-		return fmt.Errorf("failed to get home directory: %w", err)
+	if configOverride != nil {
+		return saveConfigOverride(config)
 	}
 
-	configDir := filepath.Join(home, ".config", "shout")
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+	configDir, err := getConfigDir()
+	if err != nil {
+		return err
 	}
 
 	configFile := filepath.Join(configDir, "config.json")
-	data, err := json.MarshalIndent(config, "", "  ")
+	config.Version = len(configMigrations)
+
+	saved := *config
+	saved.loaded = nil
+	settings, md, _, err := loadSettingsFile(configDir)
+	if err != nil {
+		return err
+	}
+	if settings != nil {
+		saved = withoutSettings(saved, md)
+	}
+
+	unlock, err := lockConfigFile("config")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// Keep what other shout processes saved since this config was loaded
+	written := saved
+	if config.loaded != nil {
+		onDisk, err := readSavedConfig(configFile)
+		if err != nil {
+			return err
+		}
+		if written, err = mergeConfigChanges(*config.loaded, saved, onDisk); err != nil {
+			return fmt.Errorf("failed to merge config: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(written, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal config: %w", err)
 	}
 
-	if err := os.WriteFile(configFile, data, 0644); err != nil {
+	// The config holds access tokens, so keep it private to its owner
+	if err := writeFileAtomic(configFile, data, 0600); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
+	// Later saves write what changes from here, not the other processes' changes merged in
+	config.loaded = &saved
+
 	return nil
 }
 
@@ -110,13 +276,56 @@ func promptForCredentials() (string, string, error) {
 	return identifier, password, nil
 }
 
+// stdinReader is shared by interactive prompts so buffered input isn't lost between them
+var stdinReader = bufio.NewReader(os.Stdin)
+
+// promptLine prints a prompt and reads a trimmed line of input
+func promptLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+	line, err := stdinReader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("failed to read input: %w", err)
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// errAuthFactorTokenRequired is returned when the account has email 2FA enabled
+// and createSession needs the code that was just emailed
+var errAuthFactorTokenRequired = errors.New("account requires the sign-in code sent to your email; use an app password or run 'shout auth bluesky' to enter it")
+
 func authenticateWithCredentials(identifier, appPassword string) (*BlueskyAuthResponse, error) {
+	return createBlueskySession(loginServiceFor(identifier), identifier, appPassword, "")
+}
+
+// loginServiceFor returns the PDS of a handle or DID, so accounts hosted
+// elsewhere log in to their own server. Emails and handles that can't be
+// resolved use bsky.social.
+func loginServiceFor(identifier string) string {
+	identifier = strings.TrimPrefix(identifier, "@")
+	if strings.Contains(identifier, "@") {
+		return defaultBlueskyService
+	}
+
+	_, pds, err := resolvePDS(identifier)
+	if err != nil {
+		return defaultBlueskyService
+	}
+	return pds
+}
+
+// createBlueskySession logs in with createSession on the given server, passing
+// the emailed 2FA code if one is given
+func createBlueskySession(serviceURL, identifier, appPassword, authFactorToken string) (*BlueskyAuthResponse, error) {
 	// Create session with Bluesky
-	authURL := "https://bsky.social/xrpc/com.atproto.server.createSession"
-	authReqBody, err := json.Marshal(map[string]string{
+	authURL := serviceURL + "/xrpc/com.atproto.server.createSession"
+	body := map[string]string{
 		"identifier": identifier,
 		"password":   appPassword,
-	})
+	}
+	if authFactorToken != "" {
+		body["authFactorToken"] = authFactorToken
+	}
+	authReqBody, err := json.Marshal(body)
 	if err != nil {
 		return nil, fmt.Errorf("failed to encode auth request: %w", err)
 	}
@@ -136,24 +345,31 @@ func authenticateWithCredentials(identifier, appPassword string) (*BlueskyAuthRe
 
 	if authResp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(authResp.Body)
-		return nil, fmt.Errorf("authentication failed: status %d, response: %s", authResp.StatusCode, string(bodyBytes))
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(bodyBytes, &errResp) == nil && errResp.Error == "AuthFactorTokenRequired" {
+			return nil, errAuthFactorTokenRequired
+		}
+		return nil, &statusError{Action: "authentication", Status: authResp.StatusCode, Body: string(bodyBytes)}
 	}
 
 	var authResult BlueskyAuthResponse
 	if err := json.NewDecoder(authResp.Body).Decode(&authResult); err != nil {
 		return nil, fmt.Errorf("failed to decode auth response: %w", err)
 	}
+	authResult.serviceURL = serviceURL
 
 	return &authResult, nil
 }
 
-func refreshBlueskyToken(refreshJwt string) (*BlueskyAuthResponse, error) {
-	refreshURL := "https://bsky.social/xrpc/com.atproto.server.refreshSession"
+func refreshBlueskyToken(session BlueskySession) (*BlueskyAuthResponse, error) {
+	refreshURL := session.xrpcURL("com.atproto.server.refreshSession")
 	refreshReq, err := http.NewRequest("POST", refreshURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create refresh request: %w", err)
 	}
-	refreshReq.Header.Set("Authorization", "Bearer "+refreshJwt)
+	refreshReq.Header.Set("Authorization", "Bearer "+session.RefreshJwt)
 
 	client := &http.Client{}
 	refreshResp, err := client.Do(refreshReq)
@@ -164,206 +380,1101 @@ func refreshBlueskyToken(refreshJwt string) (*BlueskyAuthResponse, error) {
 
 	if refreshResp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(refreshResp.Body)
-		return nil, fmt.Errorf("token refresh failed: status %d, response: %s", refreshResp.StatusCode, string(bodyBytes))
+		return nil, &statusError{Action: "token refresh", Status: refreshResp.StatusCode, Body: string(bodyBytes)}
 	}
 
 	var refreshResult BlueskyAuthResponse
 	if err := json.NewDecoder(refreshResp.Body).Decode(&refreshResult); err != nil {
 		return nil, fmt.Errorf("failed to decode refresh response: %w", err)
 	}
+	refreshResult.serviceURL = session.ServiceURL
 
 	return &refreshResult, nil
 }
 
-func authenticateBluesky() error {
+func authenticateBluesky(args []string) error {
+	fs := flag.NewFlagSet("auth bluesky", flag.ExitOnError)
+	useOAuth := fs.Bool("oauth", false, "Sign in through the browser with OAuth instead of an app password")
+	service := fs.String("service", "", "URL of your PDS, if it can't be found from your handle")
+	parseFlags(fs, args)
+
 	// First check if we have stored tokens
 	config, err := loadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	// If we have a refresh token, try to use it first
-	if config.BlueskySession.RefreshJwt != "" {
-		fmt.Println("Attempting to refresh existing session...")
-		authResult, err := refreshBlueskyToken(config.BlueskySession.RefreshJwt)
+	if *useOAuth {
+		return authenticateBlueskyOAuth(config)
+	}
+
+	// OAuth sessions are refreshed through their authorization server
+	if config.BlueskySession.OAuth != nil {
+		infof("Attempting to refresh existing session...\n")
+		if err := refreshOAuthSession(config); err == nil {
+			successf("Successfully refreshed session for @%s!\n", config.BlueskySession.Handle)
+			return nil
+		}
+	} else if config.BlueskySession.RefreshJwt != "" {
+		// If we have a refresh token, try to use it first
+		infof("Attempting to refresh existing session...\n")
+		authResult, err := refreshBlueskyToken(config.BlueskySession)
 		if err == nil {
 			// Successfully refreshed tokens
 			config.BlueskySession.AccessJwt = authResult.AccessJwt
 			config.BlueskySession.RefreshJwt = authResult.RefreshJwt
+			config.BlueskySession.ServiceURL = authResult.pds()
 
 			if err := saveConfig(config); err != nil {
 				return fmt.Errorf("failed to save refreshed tokens: %w", err)
 			}
 
-			fmt.Printf("Successfully refreshed session for @%s!\n", config.BlueskySession.Handle)
+			successf("Successfully refreshed session for @%s!\n", config.BlueskySession.Handle)
 			return nil
 		}
 	}
 
-	fmt.Println("Will try with credentials instead.")
+	infof("Will try with credentials instead.\n")
 
-	// Always prompt for credentials
+	// Use credentials from the config or environment when available
+	ok, err := loginBlueskyNonInteractive(config)
+	if err != nil {
+		return err
+	}
+	if ok {
+		successf("successfully authenticated with Bluesky as @%s!\n", config.BlueskySession.Handle)
+		return nil
+	}
+
+	// Otherwise prompt for credentials
 	fmt.Println("Please enter your Bluesky credentials:")
 	identifier, appPassword, err := promptForCredentials()
 	if err != nil {
 		return fmt.Errorf("error prompting for credentials: %w", err)
 	}
 
-	// Authenticate with provided credentials
-	authResult, err := authenticateWithCredentials(identifier, appPassword)
+	if err := confirmAppPassword(appPassword); err != nil {
+		return err
+	}
+
+	serviceURL := strings.TrimSuffix(*service, "/")
+	if serviceURL == "" {
+		serviceURL = loginServiceFor(identifier)
+	}
+
+	// Authenticate with provided credentials, asking for the emailed code if the account uses 2FA
+	authResult, err := createBlueskySession(serviceURL, identifier, appPassword, "")
+	if errors.Is(err, errAuthFactorTokenRequired) {
+		code, promptErr := promptLine("Your account has two-factor authentication enabled. Enter the code sent to your email: ")
+		if promptErr != nil {
+			return promptErr
+		}
+		authResult, err = createBlueskySession(serviceURL, identifier, appPassword, code)
+	}
 	if err != nil {
 		return err
 	}
 
-	// Save the session
+	if err := saveBlueskySession(config, identifier, authResult); err != nil {
+		return err
+	}
+
+	successf("successfully authenticated with Bluesky as @%s!\n", config.BlueskySession.Handle)
+	return nil
+}
+
+// saveBlueskySession stores a newly created session in the config
+func saveBlueskySession(config *Config, identifier string, authResult *BlueskyAuthResponse) error {
+	handle := authResult.Handle
+	if handle == "" {
+		handle = strings.TrimPrefix(identifier, "@")
+	}
+
 	config.BlueskySession = BlueskySession{
 		AccessJwt:  authResult.AccessJwt,
 		RefreshJwt: authResult.RefreshJwt,
-		Handle:     identifier,
+		Handle:     handle,
 		Did:        authResult.Did,
+		ServiceURL: authResult.pds(),
 	}
 
 	if err := saveConfig(config); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	fmt.Printf("successfully authenticated with Bluesky as @%s!\n", identifier)
 	return nil
 }
 
-func PostToBluesky(message string) error {
+// Post is a message to publish along with its attachments
+type Post struct {
+	Text   string
+	Images []Image
+
+	// Visibility is public, unlisted, followers, or direct. Services without
+	// an equivalent ignore it.
+	Visibility string
+
+	// Language is the BCP-47 code of the post's language, or a
+	// comma-separated list of them. Mastodon only takes the first.
+	Language string
+
+	// Labels are self-applied content warnings, such as nudity or graphic-media
+	Labels []string
+
+	// ContentWarning hides the text behind a written warning on Mastodon
+	ContentWarning string `json:",omitempty"`
+
+	// LinkCard embeds a preview card for the first link in the text when there are no images
+	LinkCard bool
+
+	// CardImage replaces the linked page's own preview image on the link card
+	CardImage []byte `json:",omitempty"`
+
+	// CardTitle and CardDescription replace the linked page's own on the link card
+	CardTitle       string `json:",omitempty"`
+	CardDescription string `json:",omitempty"`
+
+	// Subreddit and Community are where the post is submitted on Reddit and
+	// Lemmy, and Title its title there. Without a title, the first line of
+	// the text is used.
+	Subreddit string `json:",omitempty"`
+	Community string `json:",omitempty"`
+	Title     string `json:",omitempty"`
+
+	// Article is the markdown of a longer article for dev.to to publish in
+	// place of the text, which the other services post as its announcement
+	Article string `json:",omitempty"`
+
+	// ReplyControl limits who can reply on Bluesky: everyone, mentioned, following, or nobody
+	ReplyControl string
+
+	// NoResize uploads images as-is instead of shrinking them to fit each service's limits
+	NoResize bool
+
+	// KeepExif uploads images with their EXIF metadata, including any GPS location
+	KeepExif bool
+
+	// ReplyTo is the post this one replies to, and ThreadRoot the first post
+	// of that thread. Both are nil for top-level posts.
+	ReplyTo    *PostResult
+	ThreadRoot *PostResult
+
+	// CreatedAt backdates the post on Bluesky, for posts imported from
+	// elsewhere. Zero means now.
+	CreatedAt time.Time
+
+	// TxnID is set by the first attempt at the post, and sent by every retry,
+	// including from the queue, so Matrix drops the events it already has
+	TxnID string `json:",omitempty"`
+}
+
+// postLanguages splits a post's comma-separated language codes
+func postLanguages(language string) []string {
+	var langs []string
+	for _, lang := range strings.Split(language, ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			langs = append(langs, lang)
+		}
+	}
+	return langs
+}
+
+// PostResult identifies a published post
+type PostResult struct {
+	ID  string `json:"id,omitempty"` // service's own ID, where it differs from the URI
+	URI string `json:"uri"`          // at:// URI of the record
+	CID string `json:"cid"`
+	URL string `json:"url"` // web permalink
+}
+
+// blueskyPostURL builds the bsky.app permalink for a post record URI
+func blueskyPostURL(actor, uri string) string {
+	rkey := uri[strings.LastIndex(uri, "/")+1:]
+	return fmt.Sprintf("https://bsky.app/profile/%s/post/%s", actor, rkey)
+}
+
+// Image is an image attachment. Data is base64-encoded when sent as JSON.
+type Image struct {
+	Data []byte `json:"data"`
+	Alt  string `json:"alt"`
+}
+
+// isExpiredTokenResponse reports whether an error response body is Bluesky's expired token error
+func isExpiredTokenResponse(body []byte) bool {
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	return json.Unmarshal(body, &errResp) == nil && errResp.Error == "ExpiredToken"
+}
+
+// refreshStoredSession refreshes the stored Bluesky session and saves the new tokens
+func refreshStoredSession(config *Config) error {
+	if config.BlueskySession.RefreshJwt == "" {
+		return withExitCode(exitAuth, fmt.Errorf("token expired and no refresh token available, please re-authenticate with 'auth bluesky'"))
+	}
+
+	// Refresh tokens work once, so shout processes take turns refreshing, and
+	// use the tokens of one that refreshed while this one waited
+	if configOverride == nil {
+		unlock, err := lockConfigFile("bluesky-refresh")
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		current, err := loadConfig()
+		if err != nil {
+			return fmt.Errorf("failed to load config: %w", err)
+		}
+		if session := current.BlueskySession; session.AccessJwt != "" && session.RefreshJwt != config.BlueskySession.RefreshJwt {
+			config.BlueskySession = session
+			return nil
+		}
+	}
+
+	if config.BlueskySession.OAuth != nil {
+		return refreshOAuthSession(config)
+	}
+
+	authResult, err := refreshBlueskyToken(config.BlueskySession)
+	if err != nil {
+		// Log in again if credentials are configured, e.g. when the refresh token has expired too
+		if ok, loginErr := loginBlueskyNonInteractive(config); ok {
+			if loginErr != nil {
+				return fmt.Errorf("failed to refresh token (%v) and to log in again: %w", err, loginErr)
+			}
+			return nil
+		}
+		return withExitCode(exitAuth, fmt.Errorf("failed to refresh token: %w, please re-authenticate with 'auth bluesky'", err))
+	}
+
+	// Update the tokens in config, following the account if it moved to another PDS
+	config.BlueskySession.AccessJwt = authResult.AccessJwt
+	config.BlueskySession.RefreshJwt = authResult.RefreshJwt
+	config.BlueskySession.ServiceURL = authResult.pds()
+
+	// Save the updated tokens
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save refreshed tokens: %w", err)
+	}
+
+	return nil
+}
+
+// doBlueskyRequest sends an authenticated request created by newRequest. If the
+// access token has expired, the session is refreshed and the request is retried once.
+// OAuth requests are also retried once when the server asks for a new DPoP nonce.
+func doBlueskyRequest(config *Config, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	client := &http.Client{}
+	refreshed, retriedNonce := false, false
+	for {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		session := config.BlueskySession
+		if session.OAuth != nil {
+			if err := authorizeDPoP(session, req); err != nil {
+				return nil, err
+			}
+		} else {
+			req.Header.Set("Authorization", "Bearer "+session.AccessJwt)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if session.OAuth != nil {
+			if nonce := resp.Header.Get("DPoP-Nonce"); nonce != "" {
+				session.OAuth.pdsNonce = nonce
+			}
+
+			challenge := resp.Header.Get("WWW-Authenticate")
+			if resp.StatusCode == http.StatusUnauthorized && strings.Contains(challenge, "use_dpop_nonce") && !retriedNonce {
+				resp.Body.Close()
+				retriedNonce = true
+				continue
+			}
+
+			// Expired OAuth tokens are rejected with a 401 invalid_token challenge
+			if resp.StatusCode != http.StatusUnauthorized || !strings.Contains(challenge, "invalid_token") || refreshed {
+				return resp, nil
+			}
+			resp.Body.Close()
+		} else {
+			// Blue sky sends a 400 for an expired token.
+			if resp.StatusCode != http.StatusBadRequest || refreshed {
+				return resp, nil
+			}
+
+			bodyBytes, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !isExpiredTokenResponse(bodyBytes) {
+				resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+				return resp, nil
+			}
+		}
+
+		infof("Access token expired. Attempting to refresh...\n")
+		if err := refreshStoredSession(config); err != nil {
+			return nil, err
+		}
+		refreshed = true
+	}
+}
+
+// blueskyGet calls an authenticated XRPC query and decodes the JSON response into out
+func blueskyGet(config *Config, method string, params url.Values, out interface{}) error {
+	queryURL := config.BlueskySession.xrpcURL(method) + "?" + params.Encode()
+	resp, err := doBlueskyRequest(config, func() (*http.Request, error) {
+		return http.NewRequest("GET", queryURL, nil)
+	})
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	return nil
+}
+
+// blueskyProcedure calls an authenticated XRPC procedure with a JSON body and
+// decodes the JSON response into out, if out is not nil
+func blueskyProcedure(config *Config, method string, body interface{}, out interface{}) error {
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	procedureURL := config.BlueskySession.xrpcURL(method)
+	resp, err := doBlueskyRequest(config, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", procedureURL, bytes.NewReader(reqBody))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s request: %w", method, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s request failed: %w", method, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", method, err)
+	}
+	return nil
+}
 
+// loadBlueskySession loads the config and checks that a Bluesky session is stored
+func loadBlueskySession() (*Config, error) {
 	config, err := loadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to load config: %w", err)
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
 	if config.BlueskySession.AccessJwt == "" {
-		return fmt.Errorf("not authenticated with Bluesky, please run 'shout auth bluesky' first")
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with Bluesky, please run 'shout auth bluesky' first"))
+	}
+
+	return config, nil
+}
+
+// uploadBlueskyBlob uploads an image and returns the blob reference to embed in a record
+func uploadBlueskyBlob(config *Config, image Image) (json.RawMessage, error) {
+	uploadURL := config.BlueskySession.xrpcURL("com.atproto.repo.uploadBlob")
+	uploadResp, err := doBlueskyRequest(config, func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", uploadURL, newProgressReader("Bluesky", image.Data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create upload request: %w", err)
+		}
+		req.ContentLength = int64(len(image.Data))
+		req.Header.Set("Content-Type", http.DetectContentType(image.Data))
+		return req, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("upload request failed: %w", err)
+	}
+	defer uploadResp.Body.Close()
+
+	if uploadResp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(uploadResp.Body)
+		return nil, &statusError{Action: "image upload", Status: uploadResp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	var uploadResult struct {
+		Blob json.RawMessage `json:"blob"`
+	}
+	if err := json.NewDecoder(uploadResp.Body).Decode(&uploadResult); err != nil {
+		return nil, fmt.Errorf("failed to decode upload response: %w", err)
+	}
+
+	return uploadResult.Blob, nil
+}
+
+// PostToBluesky publishes a post and returns its at:// URI, CID, and bsky.app permalink
+func PostToBluesky(post *Post) (*PostResult, error) {
+
+	config, err := loadBlueskySession()
+	if err != nil {
+		return nil, err
+	}
+
+	createdAt := time.Now()
+	if !post.CreatedAt.IsZero() {
+		createdAt = post.CreatedAt
+	}
+	record := map[string]interface{}{
+		"text":      post.Text,
+		"createdAt": createdAt.Format(time.RFC3339),
+	}
+	if facets := blueskyFacets(config, post.Text); len(facets) > 0 {
+		record["facets"] = facets
+	}
+	if langs := postLanguages(post.Language); len(langs) > 0 {
+		record["langs"] = langs
+	}
+	if len(post.Labels) > 0 {
+		var values []map[string]string
+		for _, label := range post.Labels {
+			values = append(values, map[string]string{"val": label})
+		}
+		record["labels"] = map[string]interface{}{
+			"$type":  "com.atproto.label.defs#selfLabels",
+			"values": values,
+		}
+	}
+	if post.ReplyTo != nil {
+		root := post.ThreadRoot
+		if root == nil {
+			root = post.ReplyTo
+		}
+		record["reply"] = map[string]interface{}{
+			"root":   strongRef{URI: root.URI, CID: root.CID},
+			"parent": strongRef{URI: post.ReplyTo.URI, CID: post.ReplyTo.CID},
+		}
+	}
+
+	// Upload any attached images and embed them in the post
+	if len(post.Images) > 0 {
+		var images []map[string]interface{}
+		for i, image := range post.Images {
+			if image, err = prepareImage("bluesky", post, image); err != nil {
+				return nil, fmt.Errorf("image %d: %w", i+1, err)
+			}
+
+			blob, err := uploadBlueskyBlob(config, image)
+			if err != nil {
+				return nil, fmt.Errorf("failed to upload image %d: %w", i+1, err)
+			}
+			images = append(images, map[string]interface{}{
+				"image": blob,
+				"alt":   image.Alt,
+			})
+		}
+		record["embed"] = map[string]interface{}{
+			"$type":  "app.bsky.embed.images",
+			"images": images,
+		}
+	} else if post.LinkCard {
+		// Embed a preview card for the first link
+		if link := firstURL(post.Text); link != "" {
+			card, err := buildBlueskyLinkCard(config, post, link)
+			if err != nil {
+				warnf("failed to create link card: %v\n", err)
+			} else {
+				record["embed"] = card
+			}
+		}
 	}
 
 	// Create post with Bluesky
-	postURL := "https://bsky.social/xrpc/com.atproto.repo.createRecord"
-	postReqBody, err := json.Marshal(map[string]interface{}{
+	var result PostResult
+	err = blueskyProcedure(config, "com.atproto.repo.createRecord", map[string]interface{}{
 		"repo":       config.BlueskySession.Did,
 		"collection": "app.bsky.feed.post",
+		"record":     record,
+	}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("posting failed: %w", err)
+	}
+
+	if post.ReplyControl != "" && post.ReplyControl != "everyone" {
+		if err := createThreadgate(config, result.URI, post.ReplyControl); err != nil {
+			warnf("failed to restrict replies: %v\n", err)
+		}
+	}
+
+	// Older sessions may have stored the login email instead of the handle
+	actor := strings.TrimPrefix(config.BlueskySession.Handle, "@")
+	if actor == "" || strings.Contains(actor, "@") {
+		actor = config.BlueskySession.Did
+	}
+	result.URL = blueskyPostURL(actor, result.URI)
+
+	successf("Successfully posted to Bluesky!\n  URL: %s\n  URI: %s\n", result.URL, result.URI)
+
+	if err := recordHistory("bluesky", post.Text, &result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return &result, nil
+}
+
+// createThreadgate limits who can reply to a post. mentioned and following
+// allow those groups to reply; nobody allows no one.
+func createThreadgate(config *Config, postURI, control string) error {
+	_, _, rkey, err := parseATURI(postURI)
+	if err != nil {
+		return err
+	}
+
+	allow := []map[string]string{}
+	switch control {
+	case "mentioned":
+		allow = append(allow, map[string]string{"$type": "app.bsky.feed.threadgate#mentionRule"})
+	case "following":
+		allow = append(allow, map[string]string{"$type": "app.bsky.feed.threadgate#followingRule"})
+	}
+
+	// The threadgate must share the post's record key
+	return blueskyProcedure(config, "com.atproto.repo.createRecord", map[string]interface{}{
+		"repo":       config.BlueskySession.Did,
+		"collection": "app.bsky.feed.threadgate",
+		"rkey":       rkey,
 		"record": map[string]interface{}{
-			"text":      message,
+			"post":      postURI,
+			"allow":     allow,
 			"createdAt": time.Now().Format(time.RFC3339),
 		},
-	})
+	}, nil)
+}
+
+// publish runs the configured hooks around sending a post to the named service
+func publish(service string, post *Post) (*PostResult, error) {
+	config, err := loadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to encode post request: %w", err)
+		return nil, fmt.Errorf("failed to load config: %w", err)
 	}
 
-	postReq, err := http.NewRequest("POST", postURL, bytes.NewBuffer(postReqBody))
-	if err != nil {
-		return fmt.Errorf("failed to create post request: %w", err)
+	if config.Hooks.PrePost != "" {
+		if err := runPrePostHook(config.Hooks.PrePost, service, post); err != nil {
+			return nil, err
+		}
 	}
-	postReq.Header.Set("Content-Type", "application/json")
-	postReq.Header.Set("Authorization", "Bearer "+config.BlueskySession.AccessJwt)
 
-	client := &http.Client{}
-	postResp, err := client.Do(postReq)
+	if err := takeRateLimitToken(config, service); err != nil {
+		return nil, err
+	}
+
+	result, err := publishTo(service, post)
+	recordPostOutcome(service, err)
 	if err != nil {
-		return fmt.Errorf("post request failed: %w", err)
+		return nil, err
 	}
-	defer postResp.Body.Close()
 
-	// Check if the token is expired (status 400). Blue sky sends a 400 for an expired token.
-	if postResp.StatusCode == http.StatusBadRequest {
-		fmt.Println("Access token expired. Attempting to refresh...")
+	if config.Hooks.PostSuccess != "" {
+		runPostSuccessHook(config.Hooks.PostSuccess, service, post, result)
+	}
+	if config.Hooks.Webhook != "" {
+		callWebhook(config.Hooks, service, post, result)
+	}
+	return result, nil
+}
 
-		// Try to refresh the token
-		if config.BlueskySession.RefreshJwt != "" {
-			authResult, err := refreshBlueskyToken(config.BlueskySession.RefreshJwt)
-			if err != nil {
-				return fmt.Errorf("failed to refresh token: %w, please re-authenticate with 'auth bluesky'", err)
-			}
+// publishTo sends a post to the named service
+func publishTo(service string, post *Post) (*PostResult, error) {
+	switch service {
+	case "", "bluesky":
+		return PostToBluesky(post)
+	case "mastodon":
+		return PostToMastodon(post)
+	case "matrix":
+		return PostToMatrix(post)
+	case "reddit":
+		return PostToReddit(post)
+	case "lemmy":
+		return PostToLemmy(post)
+	case "pixelfed":
+		return PostToPixelfed(post)
+	case "wordpress":
+		return PostToWordPress(post)
+	case "ghost":
+		return PostToGhost(post)
+	case "devto":
+		return PostToDevTo(post)
+	default:
+		return PostToPlugin(service, post)
+	}
+}
 
-			// Update the tokens in config
-			config.BlueskySession.AccessJwt = authResult.AccessJwt
-			config.BlueskySession.RefreshJwt = authResult.RefreshJwt
+// serviceNames holds the display name of each supported service
+var serviceNames = map[string]string{
+	"bluesky":   "Bluesky",
+	"mastodon":  "Mastodon",
+	"matrix":    "Matrix",
+	"reddit":    "Reddit",
+	"lemmy":     "Lemmy",
+	"pixelfed":  "Pixelfed",
+	"wordpress": "WordPress",
+	"ghost":     "Ghost",
+	"devto":     "dev.to",
+}
 
-			// Save the updated tokens
-			if err := saveConfig(config); err != nil {
-				return fmt.Errorf("failed to save refreshed tokens: %w", err)
-			}
+// characterLimits holds the maximum post length of each service
+var characterLimits = map[string]int{
+	"bluesky":   BlueskeyCharacterLimit,
+	"mastodon":  MastodonCharacterLimit,
+	"matrix":    MatrixCharacterLimit,
+	"reddit":    RedditCharacterLimit,
+	"lemmy":     LemmyCharacterLimit,
+	"pixelfed":  PixelfedCharacterLimit,
+	"wordpress": WordPressCharacterLimit,
+	"ghost":     GhostCharacterLimit,
+	"devto":     DevToCharacterLimit,
+}
 
-			// Try posting again with the new token
-			return PostToBluesky(message)
+// linkLengths holds the length that services which shorten links count
+// every link as, however long it really is. Mastodon counts each one as 23
+// characters, the length of a t.co link.
+var linkLengths = map[string]int{
+	"mastodon": 23,
+}
+
+// postLength returns a message's length as a service counts it: Unicode
+// characters, with links weighted as linkLengths says
+func postLength(service, message string) int {
+	length := utf8.RuneCountInString(message)
+	weight, ok := linkLengths[service]
+	if !ok {
+		return length
+	}
+	for _, loc := range urlPattern.FindAllStringIndex(message, -1) {
+		link := strings.TrimRight(message[loc[0]:loc[1]], ".,;:!?)'\"")
+		length += weight - utf8.RuneCountInString(link)
+	}
+	return length
+}
+
+// servicesFor returns the services named with --to or, when it's empty, the
+// config's default_service, falling back to Bluesky
+func servicesFor(config *Config, to string) ([]string, error) {
+	if to == "" {
+		to = config.DefaultService
+	}
+	if to == "" {
+		to = "bluesky"
+	}
+	return parseServices(to)
+}
+
+// parseServices splits a comma-separated list of service names and checks they are supported
+func parseServices(list string) ([]string, error) {
+	var services []string
+	for _, service := range strings.Split(list, ",") {
+		service = strings.ToLower(strings.TrimSpace(service))
+		if service == "" {
+			continue
 		}
+		if _, ok := serviceNames[service]; !ok && !registerPlugin(service) {
+			return nil, fmt.Errorf("unknown service: %s (and no %s%s plugin on the PATH)", service, pluginPrefix, service)
+		}
+		services = append(services, service)
+	}
 
-		return fmt.Errorf("token expired and no refresh token available, please re-authenticate with 'auth bluesky'")
+	if len(services) == 0 {
+		return nil, fmt.Errorf("no services given")
 	}
+	return services, nil
+}
 
-	if postResp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(postResp.Body)
-		return fmt.Errorf("posting failed: status %d, response: %s", postResp.StatusCode, string(bodyBytes))
+// maxImages holds the maximum number of images per post on each service
+var maxImages = map[string]int{
+	"bluesky":   4,
+	"mastodon":  4,
+	"matrix":    4,
+	"reddit":    0, // image posts need Reddit's own media upload flow
+	"lemmy":     0,
+	"pixelfed":  4, // the default max_album_length
+	"wordpress": 4,
+	"ghost":     4,
+	"devto":     0, // the API has no image uploads
+}
+
+// checkImageCount validates the number of attached images against a service's limit
+func checkImageCount(service string, count int) error {
+	limit := maxImages[service]
+	if limit == 0 && count > 0 {
+		return withExitCode(exitValidation, fmt.Errorf("shout can't attach images to %s posts", serviceNames[service]))
+	}
+	if count > limit {
+		return withExitCode(exitValidation, fmt.Errorf("%s allows at most %d images per post, got %d", serviceNames[service], limit, count))
+	}
+	return nil
+}
+
+// stringList is a flag.Value collecting every use of a repeatable flag
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// checkLength validates a message against Bluesky's character limit
+func checkLength(message string) error {
+	return checkLengthFor("bluesky", message)
+}
+
+// checkLengthFor validates a message against a service's character limit, counting it as postLength does
+func checkLengthFor(service, message string) error {
+	limit, ok := characterLimits[service]
+	if !ok {
+		return fmt.Errorf("unknown service: %s", service)
 	}
 
-	fmt.Println("Successfully posted to Bluesky!")
+	messageLength := postLength(service, message)
+	if messageLength > limit {
+		remainingCount := messageLength - limit
+		return withExitCode(exitValidation, fmt.Errorf("message exceeds %s's %d character limit by %d characters. Your message has %d characters. Please shorten your message", serviceNames[service], limit, remainingCount, messageLength))
+	}
 	return nil
 }
 
+// parseFlags parses flags that may appear before, after, or between positional
+// arguments and returns the positional arguments. Everything after "--" is positional.
+func parseFlags(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		fs.Parse(args)
+		consumed := len(args) - len(fs.Args())
+		if consumed > 0 && args[consumed-1] == "--" {
+			return append(positional, fs.Args()...)
+		}
+
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
 func main() {
+	handleInterrupts()
+	http.DefaultTransport = &userAgentTransport{base: http.DefaultTransport}
+
+	if err := loadEnvFile(); err != nil {
+		fail("Error", err)
+	}
+
+	args, err := extractGlobalFlags(os.Args[1:])
+	if err != nil {
+		fail("Error", err)
+	}
+	if err := setupRecording(); err != nil {
+		fail("Error", err)
+	}
+	if err := readConfigOverride(); err != nil {
+		fail("Error", err)
+	}
+	if err := useDefaultAccount(); err != nil {
+		fail("Error", err)
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	if len(os.Args) < 2 {
-		fmt.Println("Usage: shout <command> [args...]")
+		fmt.Println("Usage: shout [--profile <name>] [--config <file>|-] [-q|--quiet] [--no-color] [--plain] [--record <dir>|--replay <dir>] <command> [args...]")
 		fmt.Println("Commands:")
-		fmt.Println("  auth bluesky - Authenticate with Bluesky")
-		fmt.Println("  post <message> - Post a message to Bluesky")
+		fmt.Println("  auth <bluesky [--oauth] [--service <url>]|mastodon|matrix [--room <room>]|reddit|lemmy|pixelfed|wordpress [--user <name>]|ghost|devto> - Authenticate with a service")
+		fmt.Println("  auth status - Show authenticated accounts and when their tokens expire")
+		fmt.Println("  auth refresh [bluesky|mastodon|matrix|reddit|lemmy|pixelfed|wordpress|ghost|devto] - Refresh tokens now instead of when they expire")
+		fmt.Println("  post [--to bluesky,mastodon] [--lang <code>] [--visibility <v>] [--signature <text>] [--no-card | --card-image <path> --card-title <text> --card-description <text>] [--reply-control <who>] [--subreddit <name>] [--community <name>] [--title <text>] [--overflow fail|truncate|thread [--number]] [--force] [--preview] [--yes] [--open] [--copy-url] [--image <path> [--alt <text>]]... [--image-clipboard] [--stdin | --file <post.md>] [--template <tmpl>] <message> - Post a message")
+		fmt.Println("  lint [--to bluesky,mastodon] [--image <path> [--alt <text>]]... [--json] <message> - Check a message for problems before posting")
+		fmt.Println("  thread --file <thread.md> [--number] [--force] [--preview] [--open] [--copy-url] [--to bluesky,mastodon] - Post a markdown file as a thread, split at --- lines")
+		fmt.Println("  batch [--to bluesky,mastodon] [--dry-run] [--force] <posts.json|posts.csv> - Check and post many entries, each optionally scheduled")
+		fmt.Println("  import twitter-archive [--since <date>] [--until <date>] [--limit N] [--dry-run] <archive.zip> - Replay old tweets to Bluesky")
+		fmt.Println("  list [create [--description <text>] [--purpose curate|mod] <name>|add <list> <handle>...|remove <list> <handle>...] - Show or change your Bluesky lists")
+		fmt.Println("  mute|unmute|block|unblock <handle>... - Mute or block Bluesky accounts, or undo it")
+		fmt.Println("  dm [--stdin] <handle> <message> - Send a Bluesky direct message")
+		fmt.Println("  posts [--limit N] [--replies] - List your recent Bluesky posts with their at:// URIs")
+		fmt.Println("  oops [--to <services>] [--dry-run] [--yes] - Delete the last post made through shout")
+		fmt.Println("  draft [list|save [--stdin] <message>|show <id>|drop <id>] - Keep messages to post later with 'shout post --draft <id>'")
+		fmt.Println("  queue [list|flush|retry <id>|drop <id>] - Show or deliver posts queued while offline or scheduled")
+		fmt.Println("  schedule [list|show <id>|cancel <id>|edit <id> [--at <time> [--tz <zone>]] [--text <text>]] - Review and change scheduled posts")
+		fmt.Println("  serve --token <secret> [--listen :8080] [--metrics] - Accept posts over HTTP")
+		fmt.Println("  api [--listen 127.0.0.1:7777] [--token <secret>] - Serve a local REST API for GUIs and editor plugins")
+		fmt.Println("  stream [--interval 30s] - Post each line read from stdin")
+		fmt.Println("  announce-release [--template <tmpl>] [--dry-run] - Announce the latest git tag")
+		fmt.Println("  action - Post from a GitHub Actions step using INPUT_* variables")
+		fmt.Println("  stats [post-url...|--recent N] - Show likes, reposts, and replies for your posts")
+		fmt.Println("  limits [--json] [service...] - Show how many requests each service's rate limit has left")
+		fmt.Println("  edit <post-url> <new text> - Change the text of one of your posts")
+		fmt.Println("  resolve <post-url>... - Print the at:// URI and CID of Bluesky posts")
+		fmt.Println("  feeds [--name <feed>] [--dry-run] - Announce new items from the feeds in the config")
+		fmt.Println("  daemon [--listen <addr> [--metrics]] - Run the schedules from the config until stopped; SIGHUP reloads them")
+		fmt.Println("  daemon history [--limit N] [--schedule <name>] [--missed] - Show when the schedules ran, failed, or were missed")
+		fmt.Println("  plugins - List the service plugins found on the PATH")
+		fmt.Println("  config validate - Check the config file for mistakes")
+		fmt.Println("  config export [--no-secrets] [--output <file>] - Export the config, encrypted unless secrets are left out")
+		fmt.Println("  config import <file> - Import a config exported with 'config export'")
+		fmt.Println("  version - Show the version, commit, and build date of shout")
+		fmt.Println("  self-update [--check] [--force] - Replace shout with its latest release")
+		fmt.Println("  init - Set up shout step by step: log in to services and choose post defaults")
+		if config, err := loadConfig(); err == nil && len(config.Aliases) > 0 {
+			fmt.Println("\nAliases:")
+			for _, name := range aliasNames(config) {
+				fmt.Printf("  %s = %s\n", name, config.Aliases[name])
+			}
+		}
 		os.Exit(1)
 	}
 
+	if err := setupLogging(); err != nil {
+		warnf("%v\n", err)
+	}
+
+	args, err = expandAlias(os.Args[1:])
+	if err != nil {
+		fail("Error", err)
+	}
+	os.Args = append(os.Args[:1], args...)
+
 	command := os.Args[1]
+	logf(logInfo, "Running %s", command)
 	switch command {
 	case "auth":
 		if len(os.Args) < 3 {
-			fmt.Println("Usage: shout auth <service>")
-			fmt.Println("Services: bluesky")
+			fmt.Println("Usage: shout auth <service|status|refresh [service]>")
+			fmt.Println("Services: bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto")
 			os.Exit(1)
 		}
 
 		service := os.Args[2]
 		switch service {
 		case "bluesky":
-			if err := authenticateBluesky(); err != nil {
-				fmt.Printf("Error authenticating with Bluesky: %v\n", err)
-				os.Exit(1)
+			if err := authenticateBluesky(os.Args[3:]); err != nil {
+				fail("Error authenticating with Bluesky", err)
+			}
+		case "mastodon":
+			if err := authenticateMastodon(); err != nil {
+				fail("Error authenticating with Mastodon", err)
+			}
+		case "matrix":
+			if err := authenticateMatrix(os.Args[3:]); err != nil {
+				fail("Error authenticating with Matrix", err)
+			}
+		case "reddit":
+			if err := authenticateReddit(); err != nil {
+				fail("Error authenticating with Reddit", err)
+			}
+		case "lemmy":
+			if err := authenticateLemmy(); err != nil {
+				fail("Error authenticating with Lemmy", err)
+			}
+		case "pixelfed":
+			if err := authenticatePixelfed(); err != nil {
+				fail("Error authenticating with Pixelfed", err)
+			}
+		case "wordpress":
+			if err := authenticateWordPress(os.Args[3:]); err != nil {
+				fail("Error authenticating with WordPress", err)
+			}
+		case "ghost":
+			if err := authenticateGhost(); err != nil {
+				fail("Error authenticating with Ghost", err)
+			}
+		case "devto":
+			if err := authenticateDevTo(); err != nil {
+				fail("Error authenticating with dev.to", err)
+			}
+		case "status":
+			if err := authStatus(); err != nil {
+				fail("Error reading auth status", err)
+			}
+		case "refresh":
+			services := os.Args[3:]
+			if len(services) == 0 {
+				services = []string{"bluesky"}
+			}
+			if err := authRefresh(services); err != nil {
+				fail("Error refreshing tokens", err)
 			}
 		default:
 			fmt.Printf("Unknown service: %s\n", service)
-			fmt.Println("Supported services: bluesky")
+			fmt.Println("Supported services: bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto")
 			os.Exit(1)
 		}
 
 	case "post":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: shout post <message>")
-			os.Exit(1)
+		if err := postCommand(os.Args[2:]); err != nil {
+			fail("Error posting", err)
 		}
 
-		message := os.Args[2]
+	case "lint":
+		if err := lintCommand(os.Args[2:]); err != nil {
+			fail("Error linting message", err)
+		}
 
-		// Check message length against the character limit using Unicode character count
-		messageLength := utf8.RuneCountInString(message)
-		fmt.Printf("Your message contains %d characters (limit: %d)\n", messageLength, BlueskeyCharacterLimit)
+	case "thread":
+		if err := threadCommand(os.Args[2:]); err != nil {
+			fail("Error posting thread", err)
+		}
 
-		// Is it too long?
-		if messageLength > BlueskeyCharacterLimit {
-			remainingCount := messageLength - BlueskeyCharacterLimit
-			fmt.Println(fmt.Errorf("message exceeds Bluesky's %d character limit by %d characters. Your message has %d characters. Please shorten your message", BlueskeyCharacterLimit, remainingCount, messageLength))
-			os.Exit(1)
+	case "batch":
+		if err := batchCommand(os.Args[2:]); err != nil {
+			fail("Error posting batch", err)
 		}
 
-		if err := PostToBluesky(message); err != nil {
-			fmt.Printf("Error posting to Bluesky: %v\n", err)
-			os.Exit(1)
+	case "import":
+		if err := importCommand(os.Args[2:]); err != nil {
+			fail("Error importing", err)
+		}
+
+	case "list":
+		if err := listCommand(os.Args[2:]); err != nil {
+			fail("Error managing list", err)
+		}
+
+	case "mute", "unmute", "block", "unblock":
+		if err := moderationCommand(command, os.Args[2:]); err != nil {
+			fail("Error", err)
+		}
+
+	case "dm":
+		if err := dmCommand(os.Args[2:]); err != nil {
+			fail("Error sending direct message", err)
+		}
+
+	case "posts":
+		if err := postsCommand(os.Args[2:]); err != nil {
+			fail("Error listing posts", err)
+		}
+
+	case "oops":
+		if err := oopsCommand(os.Args[2:]); err != nil {
+			fail("Error deleting post", err)
+		}
+
+	case "draft":
+		if err := draftCommand(os.Args[2:]); err != nil {
+			fail("Error", err)
+		}
+
+	case "queue":
+		if err := queueCommand(os.Args[2:]); err != nil {
+			fail("Error", err)
+		}
+
+	case "schedule":
+		if err := scheduleCommand(os.Args[2:]); err != nil {
+			fail("Error", err)
+		}
+
+	case "serve":
+		if err := serve(os.Args[2:]); err != nil {
+			fail("Error running server", err)
+		}
+
+	case "api":
+		if err := apiCommand(os.Args[2:]); err != nil {
+			fail("Error running the API", err)
+		}
+
+	case "stream":
+		if err := stream(os.Args[2:]); err != nil {
+			fail("Error streaming posts", err)
+		}
+
+	case "announce-release":
+		if err := announceRelease(os.Args[2:]); err != nil {
+			fail("Error announcing release", err)
+		}
+
+	case "action":
+		if err := runGitHubAction(); err != nil {
+			fmt.Printf("::error::%s\n", escapeWorkflowCommand(err.Error()))
+			os.Exit(exitCode(err))
+		}
+
+	case "stats":
+		if err := statsCommand(os.Args[2:]); err != nil {
+			fail("Error fetching stats", err)
+		}
+
+	case "edit":
+		if err := editCommand(os.Args[2:]); err != nil {
+			fail("Error editing post", err)
+		}
+
+	case "resolve":
+		if err := resolveCommand(os.Args[2:]); err != nil {
+			fail("Error resolving post", err)
+		}
+
+	case "feeds":
+		if err := feedsCommand(os.Args[2:]); err != nil {
+			fail("Error announcing feeds", err)
+		}
+
+	case "daemon":
+		if err := daemonCommand(os.Args[2:]); err != nil {
+			fail("Error running daemon", err)
+		}
+
+	case "plugins":
+		for _, service := range findPlugins() {
+			fmt.Println(service)
+		}
+
+	case "config":
+		if err := configCommand(os.Args[2:]); err != nil {
+			fail("Error", err)
+		}
+
+	case "limits":
+		if err := limitsCommand(os.Args[2:]); err != nil {
+			fail("Error checking rate limits", err)
+		}
+
+	case "version", "--version":
+		versionCommand()
+
+	case "init":
+		if err := initCommand(os.Args[2:]); err != nil {
+			fail("Error setting up shout", err)
+		}
+
+	case "self-update":
+		if err := selfUpdateCommand(os.Args[2:]); err != nil {
+			fail("Error updating shout", err)
 		}
 
 	default:
 		fmt.Printf("Unknown command: %s\n", command)
-		fmt.Println("Supported commands: auth, post")
+		fmt.Printf("Supported commands: %s\n", strings.Join(builtinCommands, ", "))
 		os.Exit(1)
 	}
 }
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maximum character count allowed for Mastodon posts on a default instance
+const MastodonCharacterLimit = 500
+
+// MastodonSession holds the Mastodon instance and access token
+type MastodonSession struct {
+	InstanceURL string `json:"instance_url"`
+	AccessToken string `json:"access_token"`
+	Username    string `json:"username"`
+}
+
+// mastodonVisibilities maps shout's --visibility values to Mastodon's API values
+var mastodonVisibilities = map[string]string{
+	"public":    "public",
+	"unlisted":  "unlisted",
+	"followers": "private",
+	"direct":    "direct",
+}
+
+// mastodonStatus is the subset of a Mastodon Status entity that shout uses
+type mastodonStatus struct {
+	ID  string `json:"id"`
+	URI string `json:"uri"`
+	URL string `json:"url"`
+}
+
+// mastodonRequest sends an authenticated request to the configured instance and decodes the JSON response into out
+func mastodonRequest(session MastodonSession, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, session.InstanceURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if upload, ok := body.(*progressReader); ok {
+		req.ContentLength = upload.total
+	}
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusAccepted {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// mastodonAPISession returns the stored session of a service that speaks
+// Mastodon's API: Mastodon itself, or Pixelfed
+func mastodonAPISession(config *Config, service string) *MastodonSession {
+	if service == "pixelfed" {
+		return &config.PixelfedSession
+	}
+	return &config.MastodonSession
+}
+
+// loadMastodonSession loads the config and checks that a Mastodon session is stored
+func loadMastodonSession() (*Config, error) {
+	return loadMastodonAPISession("mastodon")
+}
+
+// loadMastodonAPISession loads the config and checks that the service has a session stored
+func loadMastodonAPISession(service string) (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if mastodonAPISession(config, service).AccessToken == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with %s, please run 'shout auth %s' first", serviceNames[service], service))
+	}
+
+	return config, nil
+}
+
+func authenticateMastodon() error {
+	return authenticateMastodonAPI("mastodon", "mastodon.social", "Create an access token with the write:statuses and write:media scopes under Preferences > Development.")
+}
+
+// authenticateMastodonAPI logs in to a service that speaks Mastodon's API
+// with an access token, after explaining where to create one
+func authenticateMastodonAPI(service, exampleInstance, tokenHelp string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use credentials from the config or environment when available, otherwise prompt
+	env := strings.ToUpper(service)
+	instance, token, ok, err := configuredCredentials(config, service, env+"_INSTANCE", env+"_ACCESS_TOKEN")
+	if err != nil {
+		return err
+	}
+
+	name := serviceNames[service]
+	if !ok {
+		fmt.Printf("Enter your %s instance (e.g. %s): ", name, exampleInstance)
+		if _, err := fmt.Scanln(&instance); err != nil {
+			return fmt.Errorf("failed to read instance: %w", err)
+		}
+
+		fmt.Println(tokenHelp)
+		fmt.Printf("Enter your %s access token: ", name)
+		if _, err := fmt.Scanln(&token); err != nil {
+			return fmt.Errorf("failed to read access token: %w", err)
+		}
+	}
+
+	instance = strings.TrimSuffix(strings.TrimSpace(instance), "/")
+	if !strings.HasPrefix(instance, "https://") && !strings.HasPrefix(instance, "http://") {
+		instance = "https://" + instance
+	}
+
+	session := MastodonSession{InstanceURL: instance, AccessToken: strings.TrimSpace(token)}
+
+	// Check the token works before saving it
+	var account struct {
+		Username string `json:"username"`
+	}
+	if err := mastodonRequest(session, "GET", "/api/v1/accounts/verify_credentials", "", nil, &account); err != nil {
+		return fmt.Errorf("failed to verify access token: %w", err)
+	}
+	session.Username = account.Username
+
+	*mastodonAPISession(config, service) = session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with %s as @%s@%s!\n", name, account.Username, strings.TrimPrefix(strings.TrimPrefix(instance, "https://"), "http://"))
+	return nil
+}
+
+// uploadMastodonMedia uploads an image attachment and returns its media ID
+func uploadMastodonMedia(service string, session MastodonSession, image Image) (string, error) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", `form-data; name="file"; filename="image"`)
+	header.Set("Content-Type", http.DetectContentType(image.Data))
+	part, err := form.CreatePart(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode image: %w", err)
+	}
+	part.Write(image.Data)
+
+	if image.Alt != "" {
+		form.WriteField("description", image.Alt)
+	}
+	form.Close()
+
+	var media struct {
+		ID string `json:"id"`
+	}
+	upload := newProgressReader(serviceNames[service], body.Bytes())
+	if err := mastodonRequest(session, "POST", "/api/v2/media", form.FormDataContentType(), upload, &media); err != nil {
+		return "", fmt.Errorf("image upload failed: %w", err)
+	}
+	return media.ID, nil
+}
+
+func PostToMastodon(post *Post) (*PostResult, error) {
+	return postStatus("mastodon", post)
+}
+
+// postStatus posts a status to a service that speaks Mastodon's API
+func postStatus(service string, post *Post) (*PostResult, error) {
+	config, err := loadMastodonAPISession(service)
+	if err != nil {
+		return nil, err
+	}
+	session := *mastodonAPISession(config, service)
+
+	form := url.Values{"status": {post.Text}}
+	if post.Visibility != "" {
+		visibility, ok := mastodonVisibilities[post.Visibility]
+		if !ok {
+			return nil, fmt.Errorf("unknown visibility: %s", post.Visibility)
+		}
+		form.Set("visibility", visibility)
+	}
+	if langs := postLanguages(post.Language); len(langs) > 0 {
+		form.Set("language", langs[0])
+	}
+	if len(post.Labels) > 0 {
+		form.Set("sensitive", "true")
+	}
+	if post.ContentWarning != "" {
+		form.Set("spoiler_text", post.ContentWarning)
+	}
+	if post.ReplyTo != nil {
+		form.Set("in_reply_to_id", post.ReplyTo.ID)
+	}
+
+	for i, image := range post.Images {
+		if image, err = prepareImage(service, post, image); err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+
+		mediaID, err := uploadMastodonMedia(service, session, image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload image %d: %w", i+1, err)
+		}
+		form.Add("media_ids[]", mediaID)
+	}
+
+	var status mastodonStatus
+	if err := mastodonRequest(session, "POST", "/api/v1/statuses", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &status); err != nil {
+		return nil, fmt.Errorf("posting failed: %w", err)
+	}
+
+	successf("Successfully posted to %s!\n  URL: %s\n", serviceNames[service], status.URL)
+
+	result := &PostResult{ID: status.ID, URI: status.URI, URL: status.URL}
+	if err := recordHistory(service, post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// editMastodonPost replaces the text of a status on the configured instance,
+// returning the text it had. Mastodon replaces the whole status with what an
+// edit sends, so its media, content warning, sensitive flag, language, and poll
+// are sent back unchanged.
+func editMastodonPost(ref, text string) (*PostResult, string, error) {
+	config, err := loadMastodonSession()
+	if err != nil {
+		return nil, "", err
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid post URL: %w", err)
+	}
+	id := u.Path[strings.LastIndex(u.Path, "/")+1:]
+
+	// The source is the text as it was written, rather than the HTML the status shows
+	var source struct {
+		Text        string `json:"text"`
+		SpoilerText string `json:"spoiler_text"`
+	}
+	path := "/api/v1/statuses/" + url.PathEscape(id)
+	if err := mastodonRequest(config.MastodonSession, "GET", path+"/source", "", nil, &source); err != nil {
+		return nil, "", fmt.Errorf("failed to fetch the post: %w", err)
+	}
+	var current struct {
+		Sensitive        bool   `json:"sensitive"`
+		Language         string `json:"language"`
+		MediaAttachments []struct {
+			ID string `json:"id"`
+		} `json:"media_attachments"`
+		Poll *struct {
+			ExpiresAt *time.Time `json:"expires_at"`
+			Expired   bool       `json:"expired"`
+			Multiple  bool       `json:"multiple"`
+			Options   []struct {
+				Title string `json:"title"`
+			} `json:"options"`
+		} `json:"poll"`
+	}
+	if err := mastodonRequest(config.MastodonSession, "GET", path, "", nil, &current); err != nil {
+		return nil, "", fmt.Errorf("failed to fetch the post: %w", err)
+	}
+
+	// The content warning counts towards the length, as in a new post
+	if err := checkLengthFor("mastodon", source.SpoilerText+text); err != nil {
+		return nil, "", err
+	}
+
+	form := url.Values{
+		"status":       {text},
+		"spoiler_text": {source.SpoilerText},
+		"sensitive":    {strconv.FormatBool(current.Sensitive)},
+	}
+	if current.Language != "" {
+		form.Set("language", current.Language)
+	}
+	for _, media := range current.MediaAttachments {
+		form.Add("media_ids[]", media.ID)
+	}
+	if poll := current.Poll; poll != nil {
+		// A poll is kept with its votes as long as its options stay the same,
+		// but an edit can only give it an end at least 5 minutes away
+		var remaining time.Duration
+		if poll.ExpiresAt != nil {
+			remaining = time.Until(*poll.ExpiresAt)
+		}
+		if poll.Expired || (poll.ExpiresAt != nil && remaining < 5*time.Minute) {
+			return nil, "", withExitCode(exitValidation, fmt.Errorf("the post's poll has ended or is about to, and Mastodon can't keep it in an edit"))
+		}
+		for _, option := range poll.Options {
+			form.Add("poll[options][]", option.Title)
+		}
+		if poll.ExpiresAt != nil {
+			form.Set("poll[expires_in]", strconv.Itoa(int(remaining.Seconds())))
+		}
+		form.Set("poll[multiple]", strconv.FormatBool(poll.Multiple))
+	}
+
+	var status mastodonStatus
+	if err := mastodonRequest(config.MastodonSession, "PUT", path, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &status); err != nil {
+		return nil, "", fmt.Errorf("editing failed: %w", err)
+	}
+
+	return &PostResult{ID: status.ID, URI: status.URI, URL: status.URL}, source.Text, nil
+}
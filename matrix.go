@@ -0,0 +1,332 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Maximum character count shout sends in one Matrix message. Events are
+// capped at 64 KiB, and the text is sent twice when it has a content warning.
+const MatrixCharacterLimit = 8000
+
+// MatrixSession holds the homeserver, access token, and room that posts go to
+type MatrixSession struct {
+	HomeserverURL string `json:"homeserver_url"`
+	AccessToken   string `json:"access_token"`
+	UserID        string `json:"user_id"`
+	RoomID        string `json:"room_id"`
+}
+
+// matrixRequest sends an authenticated request to the homeserver and decodes
+// the JSON response into out
+func matrixRequest(session MatrixSession, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, session.HomeserverURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if upload, ok := body.(*progressReader); ok {
+		req.ContentLength = upload.total
+	}
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// sendMatrixEvent sends a message event to the session's room and returns its
+// event ID. The homeserver answers a transaction ID it has seen with the event
+// it sent then, instead of sending it again.
+func sendMatrixEvent(session MatrixSession, txnID string, content map[string]interface{}) (string, error) {
+	body, err := json.Marshal(content)
+	if err != nil {
+		return "", err
+	}
+	path := "/_matrix/client/v3/rooms/" + url.PathEscape(session.RoomID) + "/send/m.room.message/" + txnID
+
+	var sent struct {
+		EventID string `json:"event_id"`
+	}
+	if err := matrixRequest(session, "PUT", path, "application/json", bytes.NewReader(body), &sent); err != nil {
+		return "", err
+	}
+	return sent.EventID, nil
+}
+
+// loadMatrixSession loads the config and checks that a Matrix session is stored
+func loadMatrixSession() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.MatrixSession.AccessToken == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with Matrix, please run 'shout auth matrix' first"))
+	}
+
+	return config, nil
+}
+
+// resolveMatrixRoom turns a room alias like #announcements:example.org into
+// its room ID, and checks that the account has joined the room
+func resolveMatrixRoom(session MatrixSession, room string) (string, error) {
+	if strings.HasPrefix(room, "#") {
+		var resolved struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := matrixRequest(session, "GET", "/_matrix/client/v3/directory/room/"+url.PathEscape(room), "", nil, &resolved); err != nil {
+			return "", fmt.Errorf("failed to look up %s: %w", room, err)
+		}
+		room = resolved.RoomID
+	}
+	if !strings.HasPrefix(room, "!") {
+		return "", fmt.Errorf("invalid room %q, expected an ID like !abc:example.org or an alias like #room:example.org", room)
+	}
+
+	var joined struct {
+		JoinedRooms []string `json:"joined_rooms"`
+	}
+	if err := matrixRequest(session, "GET", "/_matrix/client/v3/joined_rooms", "", nil, &joined); err != nil {
+		return "", fmt.Errorf("failed to list joined rooms: %w", err)
+	}
+	if !slices.Contains(joined.JoinedRooms, room) {
+		return "", fmt.Errorf("%s hasn't joined %s, join it first", session.UserID, room)
+	}
+	return room, nil
+}
+
+func authenticateMatrix(args []string) error {
+	fs := flag.NewFlagSet("auth matrix", flag.ExitOnError)
+	room := fs.String("room", os.Getenv("MATRIX_ROOM"), "room to post to, as an ID (!abc:example.org) or an alias (#room:example.org)")
+	parseFlags(fs, args)
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use credentials from the config or environment when available, otherwise prompt
+	homeserver, token, ok, err := configuredCredentials(config, "matrix", "MATRIX_HOMESERVER", "MATRIX_ACCESS_TOKEN")
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		if homeserver, err = promptLine("Enter your Matrix homeserver (e.g. matrix.org): "); err != nil {
+			return fmt.Errorf("failed to read homeserver: %w", err)
+		}
+		fmt.Println("Copy an access token from your client, e.g. Element's Settings > Help & About > Advanced, or use a bot account's token.")
+		if token, err = promptLine("Enter your Matrix access token: "); err != nil {
+			return fmt.Errorf("failed to read access token: %w", err)
+		}
+	}
+	if *room == "" {
+		if !ok {
+			if *room, err = promptLine("Enter the room to post to (!id:server or #alias:server): "); err != nil {
+				return fmt.Errorf("failed to read room: %w", err)
+			}
+		}
+		if *room == "" {
+			return withExitCode(exitValidation, fmt.Errorf("a room is required, pass --room or set MATRIX_ROOM"))
+		}
+	}
+
+	homeserver = strings.TrimSuffix(strings.TrimSpace(homeserver), "/")
+	if !strings.HasPrefix(homeserver, "https://") && !strings.HasPrefix(homeserver, "http://") {
+		homeserver = "https://" + homeserver
+	}
+
+	session := MatrixSession{HomeserverURL: homeserver, AccessToken: strings.TrimSpace(token)}
+
+	// Check the token works before saving it
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := matrixRequest(session, "GET", "/_matrix/client/v3/account/whoami", "", nil, &whoami); err != nil {
+		return fmt.Errorf("failed to verify access token: %w", err)
+	}
+	session.UserID = whoami.UserID
+
+	if session.RoomID, err = resolveMatrixRoom(session, strings.TrimSpace(*room)); err != nil {
+		return err
+	}
+
+	config.MatrixSession = session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with Matrix as %s, posting to %s!\n", session.UserID, session.RoomID)
+	return nil
+}
+
+// uploadMatrixMedia uploads an image to the homeserver and returns its mxc:// URI
+func uploadMatrixMedia(session MatrixSession, image Image) (string, error) {
+	var media struct {
+		ContentURI string `json:"content_uri"`
+	}
+	upload := newProgressReader("Matrix", image.Data)
+	if err := matrixRequest(session, "POST", "/_matrix/media/v3/upload?filename=image", http.DetectContentType(image.Data), upload, &media); err != nil {
+		return "", fmt.Errorf("image upload failed: %w", err)
+	}
+	return media.ContentURI, nil
+}
+
+// matrixPostURI is the matrix: URI of an event, which deleting it needs to find its room
+func matrixPostURI(roomID, eventID string) string {
+	return "matrix:roomid/" + url.PathEscape(strings.TrimPrefix(roomID, "!")) + "/e/" + url.PathEscape(strings.TrimPrefix(eventID, "$"))
+}
+
+// PostToMatrix sends the post's text to the room as a message, followed by
+// one message per image
+func PostToMatrix(post *Post) (*PostResult, error) {
+	config, err := loadMatrixSession()
+	if err != nil {
+		return nil, err
+	}
+	session := config.MatrixSession
+	if post.TxnID == "" {
+		post.TxnID = "shout-" + randomToken(12)
+	}
+
+	// Upload every image before sending anything, so a failed upload doesn't
+	// leave the text in the room without them
+	var images []Image
+	var imageURIs []string
+	for i, image := range post.Images {
+		if image, err = prepareImage("matrix", post, image); err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+
+		contentURI, err := uploadMatrixMedia(session, image)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upload image %d: %w", i+1, err)
+		}
+		images = append(images, image)
+		imageURIs = append(imageURIs, contentURI)
+	}
+
+	content := map[string]interface{}{"msgtype": "m.text", "body": post.Text}
+	if post.ContentWarning != "" {
+		// Clients that support spoilers hide the text until it's clicked
+		content["format"] = "org.matrix.custom.html"
+		content["formatted_body"] = fmt.Sprintf("<strong>CW: %s</strong><br><span data-mx-spoiler=\"%s\">%s</span>",
+			html.EscapeString(post.ContentWarning), html.EscapeString(post.ContentWarning), strings.ReplaceAll(html.EscapeString(post.Text), "\n", "<br>"))
+		content["body"] = "CW: " + post.ContentWarning + "\n\n" + post.Text
+	}
+	if post.ReplyTo != nil {
+		content["m.relates_to"] = map[string]interface{}{"m.in_reply_to": map[string]string{"event_id": post.ReplyTo.ID}}
+	}
+
+	eventID, err := sendMatrixEvent(session, post.TxnID, content)
+	if err != nil {
+		return nil, fmt.Errorf("posting failed: %w", err)
+	}
+	for i, contentURI := range imageURIs {
+		image := images[i]
+		body := image.Alt
+		if body == "" {
+			body = "image"
+		}
+		_, err := sendMatrixEvent(session, fmt.Sprintf("%s-image-%d", post.TxnID, i+1), map[string]interface{}{
+			"msgtype": "m.image",
+			"body":    body,
+			"url":     contentURI,
+			"info":    map[string]interface{}{"mimetype": http.DetectContentType(image.Data), "size": len(image.Data)},
+		})
+		if err != nil {
+			warnf("failed to send image %d to Matrix: %v\n", i+1, err)
+		}
+	}
+
+	result := &PostResult{
+		ID:  eventID,
+		URI: matrixPostURI(session.RoomID, eventID),
+		URL: "https://matrix.to/#/" + url.PathEscape(session.RoomID) + "/" + url.PathEscape(eventID),
+	}
+	successf("Successfully posted to Matrix!\n  URL: %s\n", result.URL)
+
+	if err := recordHistory("matrix", post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// deleteMatrixPost redacts the message with a matrix: URI, after checking that
+// it's still there and ours. Its images are separate messages, which are left
+// in the room.
+func deleteMatrixPost(uri string) error {
+	config, err := loadMatrixSession()
+	if err != nil {
+		return err
+	}
+
+	room, event, ok := strings.Cut(strings.TrimPrefix(uri, "matrix:roomid/"), "/e/")
+	if !ok {
+		return fmt.Errorf("invalid Matrix post URI: %s", uri)
+	}
+	room, _ = url.PathUnescape(room)
+	event, _ = url.PathUnescape(event)
+	roomPath := "/_matrix/client/v3/rooms/" + url.PathEscape("!"+room)
+
+	// Redacted events keep their sender but lose their content
+	var current struct {
+		Sender  string                 `json:"sender"`
+		Content map[string]interface{} `json:"content"`
+	}
+	err = matrixRequest(config.MatrixSession, "GET", roomPath+"/event/"+url.PathEscape("$"+event), "", nil, &current)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return err
+	}
+	if current.Sender != config.MatrixSession.UserID {
+		return errOtherAccount
+	}
+	if len(current.Content) == 0 {
+		return errAlreadyDeleted
+	}
+
+	// Redacting an event twice changes nothing, so the event names the transaction
+	path := roomPath + "/redact/" + url.PathEscape("$"+event) + "/" + url.PathEscape("shout-redact-"+event)
+	err = matrixRequest(config.MatrixSession, "PUT", path, "application/json", strings.NewReader("{}"), nil)
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// apiLatencyBuckets are the upper bounds, in seconds, of the API latency histogram
+var apiLatencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// latencyHistogram counts requests to one host by how long they took
+type latencyHistogram struct {
+	buckets []uint64 // cumulative counts, one per apiLatencyBuckets bound
+	count   uint64
+	sum     float64
+}
+
+// metricsRegistry holds the counters that /metrics exposes in the Prometheus
+// text format. It's nil unless metrics were turned on.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	posts    map[string]uint64
+	failures map[string]uint64
+	latency  map[string]*latencyHistogram
+}
+
+var metrics *metricsRegistry
+
+// enableMetrics starts counting posts and timing API requests
+func enableMetrics() {
+	if metrics != nil {
+		return
+	}
+	metrics = &metricsRegistry{
+		posts:    make(map[string]uint64),
+		failures: make(map[string]uint64),
+		latency:  make(map[string]*latencyHistogram),
+	}
+	http.DefaultTransport = &metricsTransport{base: http.DefaultTransport}
+}
+
+// recordPostOutcome counts a post sent to service, or a failure to send it
+func recordPostOutcome(service string, err error) {
+	if metrics == nil {
+		return
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	if err != nil {
+		metrics.failures[service]++
+	} else {
+		metrics.posts[service]++
+	}
+}
+
+// metricsTransport times each HTTP request, by host
+type metricsTransport struct {
+	base http.RoundTripper
+}
+
+func (t *metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+	seconds := time.Since(start).Seconds()
+
+	metrics.mu.Lock()
+	h := metrics.latency[req.URL.Host]
+	if h == nil {
+		h = &latencyHistogram{buckets: make([]uint64, len(apiLatencyBuckets))}
+		metrics.latency[req.URL.Host] = h
+	}
+	for i, bound := range apiLatencyBuckets {
+		if seconds <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+	metrics.mu.Unlock()
+
+	return resp, err
+}
+
+// queueDepth returns how many posts are waiting in the queue, including scheduled ones
+func queueDepth() (int, error) {
+	store, err := openStore()
+	if err != nil {
+		return 0, err
+	}
+	defer store.Close()
+	queue, err := store.Queue()
+	return len(queue), err
+}
+
+// sortedKeys returns a map's keys in order, so the output is stable
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeMetrics writes the metrics in the Prometheus text exposition format
+func writeMetrics(w io.Writer) {
+	depth, depthErr := queueDepth()
+
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP shout_posts_total Posts published, by service.")
+	fmt.Fprintln(w, "# TYPE shout_posts_total counter")
+	for _, service := range sortedKeys(metrics.posts) {
+		fmt.Fprintf(w, "shout_posts_total{service=%q} %d\n", service, metrics.posts[service])
+	}
+
+	fmt.Fprintln(w, "# HELP shout_post_failures_total Posts that failed to publish, by service.")
+	fmt.Fprintln(w, "# TYPE shout_post_failures_total counter")
+	for _, service := range sortedKeys(metrics.failures) {
+		fmt.Fprintf(w, "shout_post_failures_total{service=%q} %d\n", service, metrics.failures[service])
+	}
+
+	// A queue that can't be read leaves the gauge out rather than reporting 0
+	if depthErr == nil {
+		fmt.Fprintln(w, "# HELP shout_queue_depth Posts waiting in the queue, including scheduled ones.")
+		fmt.Fprintln(w, "# TYPE shout_queue_depth gauge")
+		fmt.Fprintf(w, "shout_queue_depth %d\n", depth)
+	} else {
+		logf(logWarn, "Failed to read the queue for metrics: %v", depthErr)
+	}
+
+	fmt.Fprintln(w, "# HELP shout_api_request_duration_seconds How long requests to the services' APIs took, by host.")
+	fmt.Fprintln(w, "# TYPE shout_api_request_duration_seconds histogram")
+	for _, host := range sortedKeys(metrics.latency) {
+		h := metrics.latency[host]
+		for i, bound := range apiLatencyBuckets {
+			fmt.Fprintf(w, "shout_api_request_duration_seconds_bucket{host=%q,le=%q} %d\n", host, strconv.FormatFloat(bound, 'g', -1, 64), h.buckets[i])
+		}
+		fmt.Fprintf(w, "shout_api_request_duration_seconds_bucket{host=%q,le=\"+Inf\"} %d\n", host, h.count)
+		fmt.Fprintf(w, "shout_api_request_duration_seconds_sum{host=%q} %s\n", host, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "shout_api_request_duration_seconds_count{host=%q} %d\n", host, h.count)
+	}
+}
+
+// metricsHandler serves GET /metrics
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	writeMetrics(w)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// findBlocks returns the record keys of the block records for subject
+func findBlocks(config *Config, subject string) ([]string, error) {
+	return findOwnRecords(config, "app.bsky.graph.block", func(value map[string]interface{}) bool {
+		return value["subject"] == subject
+	})
+}
+
+// blockActor blocks an account by creating a block record, unless it's already blocked
+func blockActor(config *Config, actor string) error {
+	subject, err := actorDID(config, actor)
+	if err != nil {
+		return err
+	}
+
+	existing, err := findBlocks(config, subject)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		infof("%s is already blocked\n", actor)
+		return nil
+	}
+
+	err = blueskyProcedure(config, "com.atproto.repo.createRecord", map[string]interface{}{
+		"repo":       config.BlueskySession.Did,
+		"collection": "app.bsky.graph.block",
+		"record": map[string]interface{}{
+			"$type":     "app.bsky.graph.block",
+			"subject":   subject,
+			"createdAt": time.Now().Format(time.RFC3339),
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("blocking %s failed: %w", actor, err)
+	}
+	infof("Blocked %s\n", actor)
+	return nil
+}
+
+// unblockActor deletes the block records for an account
+func unblockActor(config *Config, actor string) error {
+	subject, err := actorDID(config, actor)
+	if err != nil {
+		return err
+	}
+
+	rkeys, err := findBlocks(config, subject)
+	if err != nil {
+		return err
+	}
+	if len(rkeys) == 0 {
+		infof("%s isn't blocked\n", actor)
+		return nil
+	}
+
+	for _, rkey := range rkeys {
+		err := blueskyProcedure(config, "com.atproto.repo.deleteRecord", map[string]interface{}{
+			"repo":       config.BlueskySession.Did,
+			"collection": "app.bsky.graph.block",
+			"rkey":       rkey,
+		}, nil)
+		if err != nil {
+			return fmt.Errorf("unblocking %s failed: %w", actor, err)
+		}
+	}
+	infof("Unblocked %s\n", actor)
+	return nil
+}
+
+// muteActor mutes or unmutes an account. Mutes are private, so they're kept
+// by the service rather than as records in the repository.
+func muteActor(config *Config, actor string, mute bool) error {
+	subject, err := actorDID(config, actor)
+	if err != nil {
+		return err
+	}
+
+	method, action, done := "app.bsky.graph.muteActor", "muting", "Muted"
+	if !mute {
+		method, action, done = "app.bsky.graph.unmuteActor", "unmuting", "Unmuted"
+	}
+	if err := blueskyProcedure(config, method, map[string]string{"actor": subject}, nil); err != nil {
+		return fmt.Errorf("%s %s failed: %w", action, actor, err)
+	}
+	infof("%s %s\n", done, actor)
+	return nil
+}
+
+// moderationCommand runs mute, unmute, block, and unblock for each handle given
+func moderationCommand(command string, args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("Usage: shout %s <handle>...\n", command)
+		os.Exit(1)
+	}
+
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+
+	for _, actor := range args {
+		switch command {
+		case "mute":
+			err = muteActor(config, actor, true)
+		case "unmute":
+			err = muteActor(config, actor, false)
+		case "block":
+			err = blockActor(config, actor)
+		case "unblock":
+			err = unblockActor(config, actor)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
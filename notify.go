@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// notify shows a desktop notification if notifications are turned on in the
+// config, so posts sent in the background don't succeed or fail unnoticed
+func notify(title, message string) {
+	config, err := loadConfig()
+	if err != nil || !config.Notifications {
+		return
+	}
+
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		script := fmt.Sprintf("display notification %s with title %s", appleScriptString(message), appleScriptString(title))
+		cmd = exec.Command("osascript", "-e", script)
+	case "windows":
+		script := fmt.Sprintf(`[void][Reflection.Assembly]::LoadWithPartialName('System.Windows.Forms'); `+
+			`$n = New-Object System.Windows.Forms.NotifyIcon; $n.Icon = [System.Drawing.SystemIcons]::Information; $n.Visible = $true; `+
+			`$n.ShowBalloonTip(10000, '%s', '%s', 'None'); Start-Sleep -Seconds 10; $n.Dispose()`, strings.ReplaceAll(title, "'", "''"), strings.ReplaceAll(message, "'", "''"))
+		cmd = exec.Command("powershell", "-NoProfile", "-Command", script)
+	default:
+		cmd = exec.Command("notify-send", "--app-name=shout", title, message)
+	}
+
+	// Notifications are best-effort; a missing notifier shouldn't fail a post
+	if err := cmd.Start(); err != nil {
+		warnf("failed to show notification: %v\n", err)
+		return
+	}
+	go cmd.Wait()
+}
+
+// appleScriptString quotes text as an AppleScript string literal
+func appleScriptString(text string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(text) + `"`
+}
@@ -0,0 +1,421 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Scope requested for OAuth sessions: full account access like an app password
+const oauthScope = "atproto transition:generic"
+
+// How long to wait for the browser to come back to the local redirect
+const oauthCallbackTimeout = 5 * time.Minute
+
+// BlueskyOAuth holds what's needed to use and refresh an OAuth session. Its
+// tokens are bound to the DPoP key, so they are useless without it.
+type BlueskyOAuth struct {
+	Issuer        string `json:"issuer"`
+	TokenEndpoint string `json:"token_endpoint"`
+	ClientID      string `json:"client_id"`
+
+	// DPoPKey is the base64 encoded DER form of the session's P-256 private key
+	DPoPKey string `json:"dpop_key"`
+
+	// Servers hand out DPoP nonces that must be echoed back; they are kept for the current run only
+	authServerNonce string
+	pdsNonce        string
+}
+
+// authServerMetadata is the subset of the OAuth authorization server metadata that shout uses
+type authServerMetadata struct {
+	Issuer                             string `json:"issuer"`
+	AuthorizationEndpoint              string `json:"authorization_endpoint"`
+	TokenEndpoint                      string `json:"token_endpoint"`
+	PushedAuthorizationRequestEndpoint string `json:"pushed_authorization_request_endpoint"`
+}
+
+// oauthTokenResponse is the token endpoint's response
+type oauthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	Sub          string `json:"sub"`
+	Scope        string `json:"scope"`
+}
+
+// randomToken returns n random bytes encoded as unpadded base64url
+func randomToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func (o *BlueskyOAuth) key() (*ecdsa.PrivateKey, error) {
+	der, err := base64.StdEncoding.DecodeString(o.DPoPKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	key, err := x509.ParseECPrivateKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	return key, nil
+}
+
+// dpopProof signs a DPoP proof JWT for a request. accessToken is empty for
+// requests to the authorization server.
+func dpopProof(key *ecdsa.PrivateKey, method, target, nonce, accessToken string) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("invalid request URL: %w", err)
+	}
+	u.RawQuery, u.Fragment = "", ""
+
+	ecdhKey, err := key.ECDH()
+	if err != nil {
+		return "", fmt.Errorf("invalid DPoP key: %w", err)
+	}
+	point := ecdhKey.PublicKey().Bytes() // 0x04 || X || Y
+
+	header := map[string]interface{}{
+		"typ": "dpop+jwt",
+		"alg": "ES256",
+		"jwk": map[string]string{
+			"kty": "EC",
+			"crv": "P-256",
+			"x":   base64.RawURLEncoding.EncodeToString(point[1:33]),
+			"y":   base64.RawURLEncoding.EncodeToString(point[33:]),
+		},
+	}
+	claims := map[string]interface{}{
+		"jti": randomToken(16),
+		"htm": method,
+		"htu": u.String(),
+		"iat": time.Now().Unix(),
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	if accessToken != "" {
+		hash := sha256.Sum256([]byte(accessToken))
+		claims["ath"] = base64.RawURLEncoding.EncodeToString(hash[:])
+	}
+
+	headerJSON, _ := json.Marshal(header)
+	claimsJSON, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign DPoP proof: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// oauthPost sends a form to an authorization server endpoint with a DPoP proof,
+// retrying once if the server asks for a fresh nonce, and decodes the JSON response into out
+func oauthPost(o *BlueskyOAuth, key *ecdsa.PrivateKey, endpoint string, form url.Values, out interface{}) error {
+	client := &http.Client{}
+	for attempt := 0; ; attempt++ {
+		proof, err := dpopProof(key, "POST", endpoint, o.authServerNonce, "")
+		if err != nil {
+			return err
+		}
+
+		req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("DPoP", proof)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return fmt.Errorf("request failed: %w", err)
+		}
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if nonce := resp.Header.Get("DPoP-Nonce"); nonce != "" {
+			o.authServerNonce = nonce
+		}
+
+		if resp.StatusCode == http.StatusOK || resp.StatusCode == http.StatusCreated {
+			if err := json.Unmarshal(bodyBytes, out); err != nil {
+				return fmt.Errorf("failed to decode response: %w", err)
+			}
+			return nil
+		}
+
+		var errResp struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(bodyBytes, &errResp) == nil && errResp.Error == "use_dpop_nonce" && attempt == 0 {
+			continue
+		}
+		return &statusError{Action: endpoint, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+}
+
+// getJSON fetches a public JSON document
+func getJSON(target string, out interface{}) error {
+	resp, err := http.Get(target)
+	if err != nil {
+		return fmt.Errorf("failed to fetch %s: %w", target, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to fetch %s: status %d", target, resp.StatusCode)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", target, err)
+	}
+	return nil
+}
+
+// discoverAuthServer finds the authorization server that issues tokens for a PDS
+func discoverAuthServer(pds string) (*authServerMetadata, error) {
+	var resource struct {
+		AuthorizationServers []string `json:"authorization_servers"`
+	}
+	if err := getJSON(pds+"/.well-known/oauth-protected-resource", &resource); err != nil {
+		return nil, err
+	}
+	if len(resource.AuthorizationServers) == 0 {
+		return nil, fmt.Errorf("%s lists no authorization server", pds)
+	}
+
+	issuer := strings.TrimSuffix(resource.AuthorizationServers[0], "/")
+	var meta authServerMetadata
+	if err := getJSON(issuer+"/.well-known/oauth-authorization-server", &meta); err != nil {
+		return nil, err
+	}
+	if meta.Issuer != issuer {
+		return nil, fmt.Errorf("authorization server metadata is for %s, expected %s", meta.Issuer, issuer)
+	}
+	if meta.PushedAuthorizationRequestEndpoint == "" {
+		return nil, fmt.Errorf("authorization server %s doesn't support pushed authorization requests", issuer)
+	}
+	return &meta, nil
+}
+
+// openBrowser opens a URL in the default browser, ignoring failures since the URL is also printed
+func openBrowser(target string) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("open", target)
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	cmd.Start()
+}
+
+// waitForOAuthCallback serves the local redirect URI until the browser
+// returns, and returns the query parameters it was called with
+func waitForOAuthCallback(listener net.Listener) (url.Values, error) {
+	result := make(chan url.Values, 1)
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/callback" {
+				http.NotFound(w, r)
+				return
+			}
+			fmt.Fprintln(w, "shout is now signed in to Bluesky. You can close this window.")
+			select {
+			case result <- r.URL.Query():
+			default:
+			}
+		}),
+	}
+	go server.Serve(listener)
+	defer server.Shutdown(context.Background())
+
+	select {
+	case query := <-result:
+		return query, nil
+	case <-time.After(oauthCallbackTimeout):
+		return nil, fmt.Errorf("timed out waiting for the browser sign-in")
+	}
+}
+
+// authenticateBlueskyOAuth signs in through the account's authorization server
+// in a browser, using PKCE and DPoP-bound tokens, as a native app with a
+// loopback redirect URI
+func authenticateBlueskyOAuth(config *Config) error {
+	handle := config.Credentials["bluesky"].Identifier
+	if handle == "" {
+		var err error
+		if handle, err = promptLine("Enter your Bluesky handle: "); err != nil {
+			return err
+		}
+	}
+	handle = strings.TrimPrefix(handle, "@")
+
+	did, pds, err := resolvePDS(handle)
+	if err != nil {
+		return err
+	}
+
+	meta, err := discoverAuthServer(pds)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return fmt.Errorf("failed to listen for the OAuth redirect: %w", err)
+	}
+	defer listener.Close()
+
+	redirectURI := fmt.Sprintf("http://127.0.0.1:%d/callback", listener.Addr().(*net.TCPAddr).Port)
+	clientID := "http://localhost?" + url.Values{"redirect_uri": {redirectURI}, "scope": {oauthScope}}.Encode()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("failed to generate DPoP key: %w", err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("failed to encode DPoP key: %w", err)
+	}
+	oauth := &BlueskyOAuth{
+		Issuer:        meta.Issuer,
+		TokenEndpoint: meta.TokenEndpoint,
+		ClientID:      clientID,
+		DPoPKey:       base64.StdEncoding.EncodeToString(der),
+	}
+
+	verifier := randomToken(32)
+	challenge := sha256.Sum256([]byte(verifier))
+	state := randomToken(16)
+
+	var par struct {
+		RequestURI string `json:"request_uri"`
+	}
+	err = oauthPost(oauth, key, meta.PushedAuthorizationRequestEndpoint, url.Values{
+		"client_id":             {clientID},
+		"response_type":         {"code"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+		"redirect_uri":          {redirectURI},
+		"scope":                 {oauthScope},
+		"state":                 {state},
+		"login_hint":            {handle},
+	}, &par)
+	if err != nil {
+		return fmt.Errorf("failed to start authorization: %w", err)
+	}
+
+	authURL := meta.AuthorizationEndpoint + "?" + url.Values{"client_id": {clientID}, "request_uri": {par.RequestURI}}.Encode()
+	fmt.Printf("Opening your browser to sign in. If it doesn't open, visit:\n  %s\n", authURL)
+	openBrowser(authURL)
+
+	query, err := waitForOAuthCallback(listener)
+	if err != nil {
+		return err
+	}
+	if query.Get("error") != "" {
+		return fmt.Errorf("authorization failed: %s %s", query.Get("error"), query.Get("error_description"))
+	}
+	if query.Get("state") != state {
+		return fmt.Errorf("authorization failed: state mismatch")
+	}
+	if query.Get("iss") != meta.Issuer {
+		return fmt.Errorf("authorization failed: unexpected issuer %s", query.Get("iss"))
+	}
+
+	var tokens oauthTokenResponse
+	err = oauthPost(oauth, key, meta.TokenEndpoint, url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {query.Get("code")},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {clientID},
+		"code_verifier": {verifier},
+	}, &tokens)
+	if err != nil {
+		return fmt.Errorf("failed to get tokens: %w", err)
+	}
+	if tokens.Sub != did {
+		return fmt.Errorf("signed in as %s, expected %s", tokens.Sub, did)
+	}
+
+	config.BlueskySession = BlueskySession{
+		AccessJwt:  tokens.AccessToken,
+		RefreshJwt: tokens.RefreshToken,
+		Handle:     handle,
+		Did:        did,
+		ServiceURL: pds,
+		OAuth:      oauth,
+	}
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with Bluesky as @%s using OAuth!\n", handle)
+	return nil
+}
+
+// refreshOAuthSession exchanges the stored refresh token for new tokens and saves them
+func refreshOAuthSession(config *Config) error {
+	oauth := config.BlueskySession.OAuth
+	key, err := oauth.key()
+	if err != nil {
+		return err
+	}
+
+	var tokens oauthTokenResponse
+	err = oauthPost(oauth, key, oauth.TokenEndpoint, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {config.BlueskySession.RefreshJwt},
+		"client_id":     {oauth.ClientID},
+	}, &tokens)
+	if err != nil {
+		return withExitCode(exitAuth, fmt.Errorf("failed to refresh OAuth session: %w, please re-authenticate with 'auth bluesky --oauth'", err))
+	}
+
+	config.BlueskySession.AccessJwt = tokens.AccessToken
+	config.BlueskySession.RefreshJwt = tokens.RefreshToken
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save refreshed tokens: %w", err)
+	}
+	return nil
+}
+
+// authorizeDPoP adds the DPoP-bound access token and a proof for it to a request to the PDS
+func authorizeDPoP(session BlueskySession, req *http.Request) error {
+	key, err := session.OAuth.key()
+	if err != nil {
+		return err
+	}
+
+	proof, err := dpopProof(key, req.Method, req.URL.String(), session.OAuth.pdsNonce, session.AccessJwt)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "DPoP "+session.AccessJwt)
+	req.Header.Set("DPoP", proof)
+	return nil
+}
@@ -0,0 +1,268 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Posts of the same text to several services this close together are taken
+// to be one crosspost, and deleted together
+const crosspostWindow = 2 * time.Minute
+
+// errAlreadyDeleted means a post in the history no longer exists on its service
+var errAlreadyDeleted = errors.New("it no longer exists, it may have been deleted already")
+
+// errOtherAccount means a post in the history belongs to another account than
+// the one logged in to now, which oops leaves alone
+var errOtherAccount = errors.New("it was posted from another account than the one you're logged in to")
+
+// lastPosts returns the most recent post in the history, along with the
+// same message crossposted to other services
+func lastPosts(services []string) ([]HistoryEntry, error) {
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	entries, err := store.RecentHistory(100)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read post history: %w", err)
+	}
+
+	wanted := make(map[string]bool)
+	for _, service := range services {
+		wanted[service] = true
+	}
+
+	var found []HistoryEntry
+	for _, entry := range entries {
+		if len(wanted) > 0 && !wanted[entry.Service] {
+			continue
+		}
+		if len(found) == 0 {
+			found = append(found, entry)
+			continue
+		}
+		newest := found[0]
+		if newest.PostedAt.Sub(entry.PostedAt) > crosspostWindow {
+			break
+		}
+		if entry.Text == newest.Text && !postedTo(found, entry.Service) {
+			found = append(found, entry)
+		}
+	}
+	return found, nil
+}
+
+// postedTo reports whether any of the entries is for service
+func postedTo(entries []HistoryEntry, service string) bool {
+	for _, entry := range entries {
+		if entry.Service == service {
+			return true
+		}
+	}
+	return false
+}
+
+// deleteBlueskyPost deletes one of our posts after checking that it is still
+// on the account's feed
+func deleteBlueskyPost(uri string) error {
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+	repo, collection, rkey, err := parseATURI(uri)
+	if err != nil {
+		return err
+	}
+	if repo != config.BlueskySession.Did {
+		return errOtherAccount
+	}
+
+	posts, err := getAuthorPosts(config, repo, 50, true)
+	if err != nil {
+		return err
+	}
+	onFeed := false
+	for _, post := range posts {
+		if post.URI == uri {
+			onFeed = true
+			break
+		}
+	}
+	// A post made seconds ago may not be on the feed yet, so ask the repo directly
+	if !onFeed {
+		params := url.Values{"repo": {repo}, "collection": {collection}, "rkey": {rkey}}
+		var record struct{}
+		err := blueskyGet(config, "com.atproto.repo.getRecord", params, &record)
+		var statusErr *statusError
+		if errors.As(err, &statusErr) && (statusErr.Status == http.StatusBadRequest || statusErr.Status == http.StatusNotFound) {
+			return errAlreadyDeleted
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err = blueskyProcedure(config, "com.atproto.repo.deleteRecord", map[string]interface{}{
+		"repo":       repo,
+		"collection": collection,
+		"rkey":       rkey,
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}
+
+// deleteMastodonPost deletes a status on the instance of a service that
+// speaks Mastodon's API, after checking that it's still there and ours
+func deleteMastodonPost(service, id string) error {
+	config, err := loadMastodonAPISession(service)
+	if err != nil {
+		return err
+	}
+	session := *mastodonAPISession(config, service)
+
+	var status struct {
+		Account struct {
+			ID string `json:"id"`
+		} `json:"account"`
+	}
+	err = mastodonRequest(session, "GET", "/api/v1/statuses/"+url.PathEscape(id), "", nil, &status)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return err
+	}
+	var me struct {
+		ID string `json:"id"`
+	}
+	if err := mastodonRequest(session, "GET", "/api/v1/accounts/verify_credentials", "", nil, &me); err != nil {
+		return err
+	}
+	if status.Account.ID != me.ID {
+		return errOtherAccount
+	}
+
+	err = mastodonRequest(session, "DELETE", "/api/v1/statuses/"+url.PathEscape(id), "", nil, nil)
+	if errors.As(err, &statusErr) && statusErr.Status == http.StatusNotFound {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}
+
+// oopsSummary describes a post in the history for oops's messages
+func oopsSummary(entry HistoryEntry) string {
+	name := serviceNames[entry.Service]
+	if name == "" {
+		name = entry.Service
+	}
+	return fmt.Sprintf("%s post from %s: %q", name, entry.PostedAt.Local().Format("2006-01-02 15:04"), truncateText(entry.Text, 50))
+}
+
+func oopsCommand(args []string) error {
+	fs := flag.NewFlagSet("oops", flag.ExitOnError)
+	to := fs.String("to", "", "only look at posts to these comma-separated services")
+	dryRun := fs.Bool("dry-run", false, "show the post that would be deleted without deleting it")
+	yes := fs.Bool("yes", false, "delete without asking first")
+	parseFlags(fs, args)
+
+	var services []string
+	if *to != "" {
+		var err error
+		if services, err = parseServices(*to); err != nil {
+			return err
+		}
+	}
+
+	entries, err := lastPosts(services)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return withExitCode(exitValidation, fmt.Errorf("there are no posts made through shout to delete"))
+	}
+
+	if !*dryRun && !*yes && stdinIsTerminal() {
+		fmt.Println("This deletes:")
+		for _, entry := range entries {
+			fmt.Printf("  the %s\n", oopsSummary(entry))
+		}
+		ok, err := promptYesNo("Delete it?", false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return withExitCode(exitValidation, fmt.Errorf("cancelled, nothing was deleted"))
+		}
+	}
+
+	var failures []error
+	for _, entry := range entries {
+		name := serviceNames[entry.Service]
+		if name == "" {
+			name = entry.Service
+		}
+		summary := oopsSummary(entry)
+		if entry.Post == nil {
+			failures = append(failures, fmt.Errorf("%s was posted by an older version of shout that didn't record where, so delete it by hand", summary))
+			continue
+		}
+		if *dryRun {
+			fmt.Printf("Would delete the %s\n  URL: %s\n", summary, entry.Post.URL)
+			continue
+		}
+
+		switch entry.Service {
+		case "bluesky":
+			err = deleteBlueskyPost(entry.Post.URI)
+		case "mastodon", "pixelfed":
+			err = deleteMastodonPost(entry.Service, entry.Post.ID)
+		case "matrix":
+			err = deleteMatrixPost(entry.Post.URI)
+		case "reddit":
+			err = deleteRedditPost(entry.Post.ID)
+		case "lemmy":
+			err = deleteLemmyPost(entry.Post.ID)
+		case "wordpress":
+			err = deleteWordPressPost(entry.Post.ID)
+		case "ghost":
+			err = deleteGhostPost(entry.Post.ID)
+		case "devto":
+			err = deleteDevToPost(entry.Post.ID)
+		default:
+			err = fmt.Errorf("deleting isn't supported for %s", name)
+		}
+
+		// A post that's already gone is dropped from the history too, so the
+		// next oops moves on to the post before it
+		if err == nil || errors.Is(err, errAlreadyDeleted) {
+			store, storeErr := openStore()
+			if storeErr == nil {
+				storeErr = store.DeleteHistory(entry.ID)
+				store.Close()
+			}
+			if storeErr != nil {
+				warnf("failed to update post history: %v\n", storeErr)
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Errorf("%s: %w", summary, err))
+			continue
+		}
+		infof("Deleted the %s\n", summary)
+	}
+
+	return errors.Join(failures...)
+}
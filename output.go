@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// quiet suppresses informational messages, so that commands print only their
+// result (such as the post URL) or an error. Set with -q/--quiet or SHOUT_QUIET=1.
+var quiet bool
+
+// noColor turns off ANSI colors, set with --no-color
+var noColor bool
+
+// plain turns off colors, progress bars, and the boxes drawn around
+// previews, and words status lines out in full, for screen readers and logs.
+// Set with --plain or SHOUT_PLAIN=1.
+var plain bool
+
+// ANSI styles for terminal output
+const (
+	styleReset     = "\033[0m"
+	styleUnderline = "\033[4m"
+	styleHighlight = "\033[1;36m"
+	styleDim       = "\033[2m"
+	styleSuccess   = "\033[32m"
+	styleWarning   = "\033[33m"
+	styleError     = "\033[31m"
+)
+
+// colorEnabled reports whether output to f gets ANSI styles: only when it's
+// a terminal, and none of NO_COLOR, --no-color, or --plain is set
+func colorEnabled(f *os.File) bool {
+	if noColor || plain || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorize wraps s in style if output to f gets colors
+func colorize(f *os.File, style, s string) string {
+	if !colorEnabled(f) {
+		return s
+	}
+	return style + s + styleReset
+}
+
+// infof prints an informational message unless quiet mode is on, or the log
+// already writes it to stderr
+func infof(format string, args ...interface{}) {
+	logf(logInfo, format, args...)
+	if !quiet && !loggedToStderr(logInfo) {
+		fmt.Printf(format, args...)
+	}
+}
+
+// successf prints an informational message in green, for things that worked
+func successf(format string, args ...interface{}) {
+	logf(logInfo, format, args...)
+	if !quiet && !loggedToStderr(logInfo) {
+		message := fmt.Sprintf(format, args...)
+		text := strings.TrimRight(message, "\n")
+		fmt.Print(colorize(os.Stdout, styleSuccess, text) + message[len(text):])
+	}
+}
+
+// errorf prints an error to stderr, for failures a long-running command
+// reports and carries on from
+func errorf(format string, args ...interface{}) {
+	logf(logError, format, args...)
+	if !loggedToStderr(logError) {
+		fmt.Fprint(os.Stderr, colorize(os.Stderr, styleError, "Error: ")+fmt.Sprintf(format, args...))
+	}
+}
+
+// warnf prints a warning to stderr, where it doesn't get mixed up with a
+// command's result, unless the log already writes it there
+func warnf(format string, args ...interface{}) {
+	logf(logWarn, format, args...)
+	if !loggedToStderr(logWarn) {
+		fmt.Fprint(os.Stderr, colorize(os.Stderr, styleWarning, "Warning: ")+fmt.Sprintf(format, args...))
+	}
+}
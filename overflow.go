@@ -0,0 +1,79 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// overflowStrategies lists the accepted --overflow values
+var overflowStrategies = map[string]bool{
+	"fail":     true,
+	"truncate": true,
+	"thread":   true,
+}
+
+// cutAtWord splits text after at most limit characters as the service counts
+// them, at the last whitespace in the second half of that span if there is
+// one, otherwise mid-word
+func cutAtWord(service, text string, limit int) (head, rest string) {
+	if postLength(service, text) <= limit {
+		return text, ""
+	}
+	runes := []rune(text)
+
+	// Find the longest prefix within the limit. Links count as a fixed length
+	// on some services, so the length only grows as the prefix does, but not
+	// by one character at a time.
+	fits := sort.Search(len(runes)+1, func(n int) bool {
+		return postLength(service, string(runes[:n])) > limit
+	}) - 1
+	if fits < 1 {
+		fits = 1
+	}
+
+	cut := fits
+	for i := fits; i > fits/2; i-- {
+		if unicode.IsSpace(runes[i]) {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRightFunc(string(runes[:cut]), unicode.IsSpace), strings.TrimLeftFunc(string(runes[cut:]), unicode.IsSpace)
+}
+
+// truncateMessage shortens text to at most limit characters as the service
+// counts them, ending with an ellipsis
+func truncateMessage(service, text string, limit int) string {
+	if postLength(service, text) <= limit {
+		return text
+	}
+	head, _ := cutAtWord(service, text, limit-1)
+	return head + "…"
+}
+
+// splitMessage breaks text into segments of at most limit characters, as the
+// service counts them, at word boundaries. With number set, room is left in
+// each segment for its (i/n) counter.
+func splitMessage(service, text string, limit int, number bool) []string {
+	reserve := 0
+	for {
+		var segments []string
+		for rest := text; rest != ""; {
+			var head string
+			head, rest = cutAtWord(service, rest, limit-reserve)
+			segments = append(segments, head)
+		}
+
+		// The counter's width depends on the number of segments, so split again if it grew
+		if !number {
+			return segments
+		}
+		if needed := utf8.RuneCountInString(threadCounter(len(segments), len(segments))); needed > reserve {
+			reserve = needed
+			continue
+		}
+		return segments
+	}
+}
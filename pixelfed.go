@@ -0,0 +1,32 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Maximum caption length on a default Pixelfed instance
+const PixelfedCharacterLimit = 500
+
+// checkPixelfedPost checks that a post that isn't a reply has an image, since
+// Pixelfed posts are photos with the text as their caption
+func checkPixelfedPost(post *Post) error {
+	if len(post.Images) == 0 {
+		return withExitCode(exitValidation, fmt.Errorf("posting to Pixelfed needs at least one image, attach one with --image"))
+	}
+	return nil
+}
+
+func authenticatePixelfed() error {
+	return authenticateMastodonAPI("pixelfed", "pixelfed.social", "Create a personal access token with the read and write scopes under Settings > Applications.")
+}
+
+// PostToPixelfed posts the images with the text as their caption, through
+// Pixelfed's Mastodon-compatible API. Replies in a thread are comments.
+func PostToPixelfed(post *Post) (*PostResult, error) {
+	if post.ReplyTo == nil {
+		if err := checkPixelfedPost(post); err != nil {
+			return nil, err
+		}
+	}
+	return postStatus("pixelfed", post)
+}
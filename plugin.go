@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// pluginPrefix starts the name of every service plugin executable
+const pluginPrefix = "shout-post-"
+
+// Limits assumed for plugins that don't describe their own
+const (
+	defaultPluginCharacterLimit = 500
+	defaultPluginMaxImages      = 4
+)
+
+// pluginInfo is what a plugin prints when run with --describe. Every field is optional.
+type pluginInfo struct {
+	Name           string `json:"name"`
+	CharacterLimit int    `json:"character_limit"`
+	MaxImages      int    `json:"max_images"`
+	MaxImageBytes  int    `json:"max_image_bytes"`
+}
+
+// pluginRequest is the JSON a plugin receives on stdin for each post
+type pluginRequest struct {
+	Service        string      `json:"service"`
+	Text           string      `json:"text"`
+	Images         []Image     `json:"images,omitempty"`
+	Language       string      `json:"language,omitempty"`
+	Labels         []string    `json:"labels,omitempty"`
+	ContentWarning string      `json:"content_warning,omitempty"`
+	Visibility     string      `json:"visibility,omitempty"`
+	ReplyTo        *PostResult `json:"reply_to,omitempty"`
+	ThreadRoot     *PostResult `json:"thread_root,omitempty"`
+}
+
+// plugins maps the services provided by plugins to their executables
+var plugins = map[string]string{}
+
+// registerPlugin looks for a shout-post-<service> executable on the PATH and,
+// if there is one, adds the service with the limits the plugin describes
+func registerPlugin(service string) bool {
+	if _, ok := plugins[service]; ok {
+		return true
+	}
+
+	path, err := exec.LookPath(pluginPrefix + service)
+	if err != nil {
+		return false
+	}
+
+	info := pluginInfo{Name: service, CharacterLimit: defaultPluginCharacterLimit, MaxImages: defaultPluginMaxImages}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, path, "--describe").Output(); err == nil {
+		if err := json.Unmarshal(out, &info); err != nil {
+			warnf("%s --describe printed invalid JSON: %v\n", filepath.Base(path), err)
+		}
+	}
+
+	plugins[service] = path
+	serviceNames[service] = info.Name
+	characterLimits[service] = info.CharacterLimit
+	maxImages[service] = info.MaxImages
+	imageLimits[service] = imageLimit{MaxBytes: info.MaxImageBytes}
+	return true
+}
+
+// findPlugins lists the services of the plugin executables on the PATH
+func findPlugins() []string {
+	seen := make(map[string]bool)
+	var services []string
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+			service, ok := strings.CutPrefix(name, pluginPrefix)
+			if !ok || service == "" || seen[service] {
+				continue
+			}
+			seen[service] = true
+			services = append(services, service)
+		}
+	}
+	sort.Strings(services)
+	return services
+}
+
+// PostToPlugin publishes a post by running the service's plugin with the post
+// as JSON on stdin. The plugin prints the new post's id, uri, cid, and url as
+// JSON on stdout; a failing plugin's exit code (3-7) sets shout's.
+func PostToPlugin(service string, post *Post) (*PostResult, error) {
+	path, ok := plugins[service]
+	if !ok {
+		return nil, fmt.Errorf("unknown service: %s", service)
+	}
+
+	var images []Image
+	for i, image := range post.Images {
+		image, err := prepareImage(service, post, image)
+		if err != nil {
+			return nil, fmt.Errorf("image %d: %w", i+1, err)
+		}
+		images = append(images, image)
+	}
+
+	request, err := json.Marshal(pluginRequest{
+		Service:        service,
+		Text:           post.Text,
+		Images:         images,
+		Language:       post.Language,
+		Labels:         post.Labels,
+		ContentWarning: post.ContentWarning,
+		Visibility:     post.Visibility,
+		ReplyTo:        post.ReplyTo,
+		ThreadRoot:     post.ThreadRoot,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plugin request: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(rootCtx, path)
+	cmd.Stdin = bytes.NewReader(request)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		failure := fmt.Errorf("%s failed: %s", filepath.Base(path), message)
+
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() >= exitAuth && exitErr.ExitCode() <= exitServer {
+			return nil, withExitCode(exitErr.ExitCode(), failure)
+		}
+		return nil, failure
+	}
+
+	var result PostResult
+	if err := json.Unmarshal(stdout.Bytes(), &result); err != nil {
+		return nil, fmt.Errorf("%s printed an invalid result: %w", filepath.Base(path), err)
+	}
+
+	successf("Successfully posted to %s!\n", serviceNames[service])
+	if result.URL != "" {
+		infof("  URL: %s\n", result.URL)
+	}
+
+	if err := recordHistory(service, post.Text, &result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return &result, nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+)
+
+var templateFuncs = template.FuncMap{
+	"now": func() string { return time.Now().Format("2006-01-02 15:04 MST") },
+	"env": os.Getenv,
+
+	// truncate shortens text to at most n characters, ending it with "…"
+	"truncate": func(n int, text string) string { return truncateText(text, n) },
+}
+
+// applyTemplate wraps text in the given text/template
+func applyTemplate(tmpl, text string) (string, error) {
+	// .text is the whole message or piped input, .line its last nonempty line
+	return renderTemplate(tmpl, map[string]string{"text": text, "line": lastLine(text)})
+}
+
+// renderTemplate executes a post template against data, with templateFuncs available
+func renderTemplate(tmpl string, data map[string]string) (string, error) {
+	t, err := template.New("post").Funcs(templateFuncs).Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", fmt.Errorf("invalid template: %w", err)
+	}
+
+	var out strings.Builder
+	if err := t.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+
+	return out.String(), nil
+}
+
+// lastLine returns the last nonempty line of text
+func lastLine(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+func postCommand(args []string) error {
+	fs := flag.NewFlagSet("post", flag.ExitOnError)
+	to := fs.String("to", "", "comma-separated services to post to (bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto); default_service in the config, or bluesky, if not given")
+	overrides := newPostFlags(fs)
+	warnings := newContentWarningFlags(fs)
+	when := newAtFlags(fs)
+	fromStdin := fs.Bool("stdin", false, "read the message from stdin")
+	draftID := fs.String("draft", "", "post the saved draft with this ID, deleting it once it's sent")
+	postFile := fs.String("file", "", "read the message from a file, attaching local images written as ![alt](path); frontmatter can set its langs, labels, cw, images, services, time, and text_<service> variants")
+	var imagePaths, altTexts stringList
+	fs.Var(&imagePaths, "image", "attach an image file, or download one from an http(s) URL (repeatable)")
+	fs.Var(&altTexts, "alt", "alt text for the image in the same position (repeatable)")
+	imageClipboard := fs.Bool("image-clipboard", false, "attach the image on the clipboard, such as a screenshot, after any --image")
+	article := fs.String("article", "", "markdown file to publish as the article on dev.to, while the other services post the message")
+	title := fs.String("title", "", "title of the post on Reddit, Lemmy, Ghost, dev.to, and WordPress; all but WordPress use the message's first line without one")
+	cardImage := fs.String("card-image", "", "image file to use on the link card instead of the linked page's own")
+	cardTitle := fs.String("card-title", "", "title for the link card instead of the linked page's own")
+	cardDescription := fs.String("card-description", "", "description for the link card instead of the linked page's own")
+	noResize := fs.Bool("no-resize", false, "upload images as-is instead of shrinking them to fit each service's limits")
+	keepExif := fs.Bool("keep-exif", false, "keep EXIF metadata, including GPS location, in uploaded images")
+	aiAlt := fs.Bool("ai-alt", false, "suggest alt text for images without it using the AI endpoint from the config")
+	aiShorten := fs.Bool("ai-shorten", false, "offer an AI-shortened version of messages that are over the limit")
+	overflow := fs.String("overflow", "", "what to do when the message is over a service's limit: fail, truncate, or thread (default fail)")
+	number := fs.Bool("number", false, "append a (1/n) counter to each post when --overflow thread splits a message")
+	open := fs.Bool("open", false, "open the new post in the default browser")
+	copyURL := fs.Bool("copy-url", false, "copy the new post's URL to the clipboard")
+	force := fs.Bool("force", false, "post even if the same text was recently posted to the service")
+	yes := fs.Bool("yes", false, "post without asking first, even with confirm_posts set in the config")
+	preview := fs.Bool("preview", false, "show how the post will appear, with links, mentions, hashtags, and link cards, without posting it")
+	tmpl := fs.String("template", "", "text/template wrapping the message: {{.text}} is the message, {{.line}} its last line, {{now}} the current time, {{env \"NAME\"}} an environment variable")
+	for _, service := range slices.Sorted(maps.Keys(serviceNames)) {
+		fs.String("text-"+service, "", "text to post on "+serviceNames[service]+" instead of the message")
+	}
+	positional := parseFlags(fs, args)
+
+	// Variants of the message for single services, from --text-<service>
+	variants := make(map[string]string)
+	fs.Visit(func(fl *flag.Flag) {
+		if service, ok := strings.CutPrefix(fl.Name, "text-"); ok {
+			variants[service] = fl.Value.String()
+		}
+	})
+
+	meta := &postMetadata{}
+	var message string
+	var fileImages []Image
+	var draft *Draft
+	switch {
+	case *draftID != "":
+		var err error
+		if draft, err = loadDraft(*draftID); err != nil {
+			return err
+		}
+		message = draft.Text
+	case *postFile != "":
+		var err error
+		if meta, message, fileImages, err = readPostFile(*postFile); err != nil {
+			return err
+		}
+	case *fromStdin:
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read stdin: %w", err)
+		}
+		message = strings.TrimSpace(string(input))
+	case len(positional) > 0:
+		message = positional[0]
+	case len(variants) > 0:
+		// Every service posts a variant, which is checked once the services are known
+	default:
+		fmt.Println("Usage: shout post [--to bluesky,mastodon] [--lang <code>] [--visibility <v>] [--signature <text>] [--no-card | --card-image <path> --card-title <text> --card-description <text>] [--reply-control <who>] [--subreddit <name>] [--community <name>] [--title <text>] [--article <article.md>] [--cw <text>] [--label <label>]... [--at <time> [--tz <zone>]] [--overflow fail|truncate|thread [--number]] [--force] [--preview] [--yes] [--open] [--copy-url] [--image <path> [--alt <text>]]... [--image-clipboard [--alt <text>]] [--stdin | --file <post.md> | --draft <id>] [--template <tmpl>] [--text-<service> <text>]... <message>")
+		os.Exit(1)
+	}
+
+	// The file's variants are overridden by the flags
+	for service, text := range meta.Texts {
+		if _, ok := variants[service]; !ok {
+			variants[service] = text
+		}
+	}
+
+	if *tmpl != "" {
+		var err error
+		if message, err = applyTemplate(*tmpl, message); err != nil {
+			return err
+		}
+		for service, text := range variants {
+			if variants[service], err = applyTemplate(*tmpl, text); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := warnings.applyTo(meta); err != nil {
+		return err
+	}
+	at, err := when.time()
+	if err != nil {
+		return err
+	}
+	if !at.IsZero() {
+		meta.At = at
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	services, err := servicesFor(config, meta.services(*to))
+	if err != nil {
+		return err
+	}
+	meta.warnUnlabelled(services)
+	for service := range variants {
+		if !slices.Contains(services, service) {
+			warnf("there's a %s variant of the message, but %s isn't one of the services posted to\n", serviceNames[service], service)
+		}
+	}
+	for _, service := range services {
+		if _, ok := variants[service]; !ok && message == "" {
+			return withExitCode(exitValidation, fmt.Errorf("there's no message to post on %s, give one or --text-%s", serviceNames[service], service))
+		}
+	}
+
+	if *aiShorten {
+		// Measure the message as each service will post it, like the checks below.
+		// Services with their own variant don't post it at all.
+		over := func(text string) int {
+			most := math.MinInt
+			for _, service := range services {
+				if _, ok := variants[service]; ok {
+					continue
+				}
+				post := postForService(Post{Text: text}, overrides.apply(meta.applyTo(config.Defaults[service])))
+				most = max(most, postLength(service, post.Text)-characterLimits[service])
+			}
+			return most
+		}
+		if message, err = offerShorterMessage(config.AI, message, over, *fromStdin); err != nil {
+			return err
+		}
+	}
+
+	imageCount := len(imagePaths)
+	if *imageClipboard {
+		imageCount++
+	}
+	if len(altTexts) > imageCount {
+		return fmt.Errorf("got %d --alt texts for %d images", len(altTexts), imageCount)
+	}
+
+	base := Post{Text: message, Images: fileImages, Labels: meta.Labels, ContentWarning: meta.ContentWarning, NoResize: *noResize, KeepExif: *keepExif}
+	base.CardTitle, base.CardDescription = *cardTitle, *cardDescription
+	base.Title = *title
+	if *article != "" {
+		if !slices.Contains(services, "devto") {
+			return withExitCode(exitValidation, fmt.Errorf("--article is only published on dev.to, add devto to --to"))
+		}
+		data, err := os.ReadFile(*article)
+		if err != nil {
+			return fmt.Errorf("failed to read article: %w", err)
+		}
+		base.Article = string(data)
+	}
+	customCard := *cardImage != "" || *cardTitle != "" || *cardDescription != ""
+	if customCard {
+		if imageCount > 0 || len(base.Images) > 0 {
+			return withExitCode(exitValidation, fmt.Errorf("the --card-* flags can't be combined with images, since posts with images don't get a link card"))
+		}
+		if firstURL(message) == "" {
+			return withExitCode(exitValidation, fmt.Errorf("the --card-* flags need a link in the message to make a card for"))
+		}
+	}
+	if *cardImage != "" {
+		if base.CardImage, err = os.ReadFile(*cardImage); err != nil {
+			return fmt.Errorf("failed to read card image: %w", err)
+		}
+	}
+	for i, path := range imagePaths {
+		data, err := readImage(path)
+		if err != nil {
+			return err
+		}
+
+		image := Image{Data: data}
+		if i < len(altTexts) {
+			image.Alt = altTexts[i]
+		}
+		base.Images = append(base.Images, image)
+	}
+	if *imageClipboard {
+		data, err := pasteImageFromClipboard()
+		if err != nil {
+			return err
+		}
+		image := Image{Data: data}
+		if len(imagePaths) < len(altTexts) {
+			image.Alt = altTexts[len(imagePaths)]
+		} else if !*fromStdin && !*aiAlt {
+			// Screenshots have no file name to go by, so ask what it shows while it's still in mind
+			if image.Alt, err = promptLine("Alt text for the clipboard image (empty for none): "); err != nil {
+				return err
+			}
+		}
+		base.Images = append(base.Images, image)
+	}
+
+	// Apply each service's config defaults and the flags overriding them, then
+	// check every service's limits before posting anywhere
+	threads := make(map[string][]*Post)
+	for _, service := range services {
+		settings := overrides.apply(meta.applyTo(config.Defaults[service]))
+		if *overflow != "" {
+			settings.Overflow = *overflow
+		}
+		if err := settings.validate(); err != nil {
+			return err
+		}
+
+		serviceBase := base
+		if text, ok := variants[service]; ok {
+			serviceBase.Text = text
+		}
+		post := postForService(serviceBase, settings)
+		if service == "bluesky" && customCard && !post.LinkCard {
+			return withExitCode(exitValidation, fmt.Errorf("the --card-* flags have no effect with link cards turned off"))
+		}
+		messageLength := postLength(service, post.Text)
+		infof("Your message contains %d characters (%s limit: %d)\n", messageLength, serviceNames[service], characterLimits[service])
+
+		// Is it too long?
+		thread := []*Post{post}
+		if messageLength > characterLimits[service] {
+			if thread, err = overflowPost(service, serviceBase, settings, *number); err != nil {
+				return fmt.Errorf("%s: %w", serviceNames[service], err)
+			}
+		}
+
+		if err := checkThread(service, thread); err != nil {
+			return err
+		}
+
+		if !*force && !*preview {
+			if err := checkDuplicate(config, service, thread[0].Text); err != nil {
+				return err
+			}
+		}
+
+		threads[service] = thread
+	}
+
+	if *preview {
+		previewThreads(services, threads)
+		return nil
+	}
+
+	if *aiAlt {
+		if *fromStdin {
+			return fmt.Errorf("--ai-alt needs to ask for confirmation, so it can't be combined with --stdin")
+		}
+
+		// The services' posts share the images slice, so this fills in alt text for all of them
+		if err := generateMissingAltText(config.AI, base.Images); err != nil {
+			return err
+		}
+	}
+
+	if config.ConfirmPosts && !*yes && !*fromStdin {
+		if err := confirmPosts(services, threads); err != nil {
+			return err
+		}
+	}
+
+	if meta.At.After(time.Now()) {
+		if err := schedulePosts(services, threads, meta.At); err != nil {
+			return err
+		}
+		dropPostedDraft(draft)
+		return nil
+	}
+
+	flushQueueBeforePosting()
+
+	// Post to every service at once; a failure on one doesn't stop the others
+	deliveries := deliverAll(services, threads)
+
+	var copied bool
+	for _, d := range deliveries {
+		if d.Err != nil {
+			continue
+		}
+		if quiet && d.Queued {
+			fmt.Println("queued")
+		} else if quiet {
+			fmt.Println(d.Results[0].URL)
+		}
+		if *open && !d.Queued {
+			openBrowser(d.Results[0].URL)
+		}
+
+		// When cross-posting, copy the URL of the first service's post
+		if *copyURL && !d.Queued && !copied {
+			if err := copyToClipboard(d.Results[0].URL); err != nil {
+				warnf("%v\n", err)
+			}
+			copied = true
+		}
+	}
+
+	if len(deliveries) > 1 && !quiet {
+		printDeliverySummary(deliveries)
+	}
+	if err := deliveryErrors(deliveries); err != nil {
+		return err
+	}
+	dropPostedDraft(draft)
+	return nil
+}
+
+// dropPostedDraft deletes the draft a post came from, once it's sent or
+// queued everywhere. A draft that failed anywhere is kept for another try.
+func dropPostedDraft(draft *Draft) {
+	if draft == nil {
+		return
+	}
+	if err := deleteDraft(draft.ID); err != nil {
+		warnf("failed to delete draft %d: %v\n", draft.ID, err)
+	}
+}
+
+// schedulePosts queues each service's post or thread until at, for a post
+// file whose frontmatter sets a time in the future
+func schedulePosts(services []string, threads map[string][]*Post, at time.Time) error {
+	for _, service := range services {
+		if err := scheduleThread(service, threads[service], at); err != nil {
+			return fmt.Errorf("failed to schedule the %s post: %w", serviceNames[service], err)
+		}
+	}
+	if quiet {
+		fmt.Println("scheduled")
+		return nil
+	}
+	fmt.Printf("Scheduled for %s. It's sent by the first 'shout queue flush' or post after that.\n", at.Local().Format("2006-01-02 15:04"))
+	return nil
+}
+
+// overflowPost applies the service's overflow strategy to a message that is
+// over its limit once settings are applied. With "fail" the post is returned
+// as-is for the length check to reject.
+func overflowPost(service string, base Post, settings ServiceDefaults, number bool) ([]*Post, error) {
+	limit := characterLimits[service]
+	post := postForService(base, settings)
+	// Mastodon counts a content warning towards the post's length
+	if service == "mastodon" || service == "pixelfed" {
+		limit -= utf8.RuneCountInString(post.ContentWarning)
+		if limit < 1 && settings.Overflow != "" && settings.Overflow != "fail" {
+			return nil, withExitCode(exitValidation, fmt.Errorf("the content warning leaves no room for the message"))
+		}
+	}
+
+	switch settings.Overflow {
+	case "truncate":
+		// Keep the signature intact and shorten the message before it. A link
+		// cut short can count differently, so shorten further if it's still over.
+		room := limit - (postLength(service, post.Text) - postLength(service, base.Text))
+		if room < 1 {
+			return nil, withExitCode(exitValidation, fmt.Errorf("the signature leaves no room for the message"))
+		}
+		text := base.Text
+		var truncated *Post
+		for {
+			base.Text = truncateMessage(service, text, room)
+			truncated = postForService(base, settings)
+			if postLength(service, truncated.Text) <= limit || room <= 1 {
+				break
+			}
+			room--
+		}
+		infof("Truncated the message to %d characters for %s\n", postLength(service, truncated.Text), serviceNames[service])
+		return []*Post{truncated}, nil
+
+	case "thread":
+		// The signature is already part of the text, so it ends up in the last post
+		var segments []Post
+		for _, text := range splitMessage(service, post.Text, limit, number) {
+			segments = append(segments, Post{Text: text, Labels: post.Labels, ContentWarning: post.ContentWarning, NoResize: post.NoResize, KeepExif: post.KeepExif})
+		}
+		segments[0].Images = post.Images
+		segments[0].CardImage = post.CardImage
+		segments[0].CardTitle, segments[0].CardDescription = post.CardTitle, post.CardDescription
+		if number {
+			numberThread(segments)
+		}
+
+		settings.Signature = ""
+		infof("Splitting the message into a thread of %d posts for %s\n", len(segments), serviceNames[service])
+		return threadForService(segments, settings), nil
+
+	default:
+		return []*Post{post}, nil
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// useColor reports whether stdout is a terminal that should get ANSI styles
+func useColor() bool {
+	return colorEnabled(os.Stdout)
+}
+
+// renderRichText styles the links, mentions, and hashtags in text as the
+// service will show them. Without color, links are wrapped in <> and mentions
+// and hashtags in [].
+func renderRichText(service, text string, color bool) string {
+	var out strings.Builder
+	last := 0
+	for _, span := range detectRichText(text) {
+		// Bluesky shows fediverse mentions as plain text
+		if service == "bluesky" && span.Kind == "mention" && strings.Contains(span.Value, "@") {
+			continue
+		}
+		out.WriteString(text[last:span.Start])
+
+		open, close := styleHighlight, styleReset
+		switch {
+		case span.Kind == "link" && color:
+			open = styleUnderline
+		case span.Kind == "link":
+			open, close = "<", ">"
+		case !color:
+			open, close = "[", "]"
+		}
+		out.WriteString(open + text[span.Start:span.End] + close)
+		last = span.End
+	}
+	out.WriteString(text[last:])
+	return out.String()
+}
+
+// describeRichText lists the links, mentions, and hashtags that the service
+// makes clickable, for plain mode, where they aren't styled
+func describeRichText(service, text string) {
+	found := make(map[string][]string)
+	for _, span := range detectRichText(text) {
+		if service == "bluesky" && span.Kind == "mention" && strings.Contains(span.Value, "@") {
+			continue
+		}
+		found[span.Kind] = append(found[span.Kind], text[span.Start:span.End])
+	}
+	for _, kind := range []struct{ key, label string }{{"link", "Links"}, {"mention", "Mentions"}, {"tag", "Hashtags"}} {
+		if len(found[kind.key]) > 0 {
+			fmt.Printf("  %s: %s\n", kind.label, strings.Join(found[kind.key], ", "))
+		}
+	}
+}
+
+// previewPost prints how a post will appear: its styled text, images, and link card
+func previewPost(service string, post *Post, color bool) {
+	dim := func(s string) string {
+		if color {
+			return styleDim + s + styleReset
+		}
+		return s
+	}
+
+	if plain {
+		for _, line := range strings.Split(post.Text, "\n") {
+			fmt.Println("  " + line)
+		}
+		describeRichText(service, post.Text)
+	} else {
+		for _, line := range strings.Split(renderRichText(service, post.Text, color), "\n") {
+			fmt.Println("  " + line)
+		}
+	}
+
+	for i, image := range post.Images {
+		alt := image.Alt
+		if alt == "" {
+			alt = "no alt text"
+		}
+		if plain {
+			fmt.Printf("  Image %d, alt text: %s\n", i+1, alt)
+		} else {
+			fmt.Println(dim(fmt.Sprintf("  [image %d: %s]", i+1, alt)))
+		}
+	}
+
+	// Cards are only embedded when there are no images, as when posting
+	if !post.LinkCard || len(post.Images) > 0 {
+		return
+	}
+	link := firstURL(post.Text)
+	if link == "" {
+		return
+	}
+	md, err := linkCardMetadata(post, link)
+	if err != nil {
+		warnf("failed to fetch link card: %v\n", err)
+		return
+	}
+
+	host := link
+	if u, err := url.Parse(link); err == nil {
+		host = u.Host
+	}
+	if plain {
+		fmt.Printf("  Link card from %s, titled: %s\n", host, md.Title)
+		if md.Description != "" {
+			fmt.Printf("  Card description: %s\n", truncateText(md.Description, 100))
+		}
+		if len(post.CardImage) > 0 {
+			fmt.Printf("  Card image: your own, %s\n", formatBytes(int64(len(post.CardImage))))
+		}
+		return
+	}
+	fmt.Println(dim("  ┌ " + host))
+	fmt.Println("  │ " + md.Title)
+	if md.Description != "" {
+		fmt.Println(dim("  │ " + truncateText(md.Description, 100)))
+	}
+	if len(post.CardImage) > 0 {
+		fmt.Println(dim(fmt.Sprintf("  │ [your card image, %s]", formatBytes(int64(len(post.CardImage))))))
+	}
+	fmt.Println(dim("  └"))
+}
+
+// previewThreads prints each service's posts as they will appear, without posting
+func previewThreads(services []string, threads map[string][]*Post) {
+	color := useColor()
+	for _, service := range services {
+		thread := threads[service]
+		for i, post := range thread {
+			header := serviceNames[service]
+			if len(thread) > 1 {
+				header += fmt.Sprintf(", post %d of %d", i+1, len(thread))
+			}
+			if post.Visibility != "" && (service == "mastodon" || service == "pixelfed") {
+				header += ", " + post.Visibility
+			}
+			if plain {
+				fmt.Printf("%s:\n", header)
+			} else {
+				fmt.Printf("── %s ──\n", header)
+			}
+			previewPost(service, post, color)
+			fmt.Println()
+		}
+	}
+}
+
+// stdinIsTerminal reports whether shout can ask the user questions
+func stdinIsTerminal() bool {
+	info, err := os.Stdin.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// confirmPosts previews the posts and asks before they're sent. Without a
+// terminal to ask on, as under cron, they're sent without asking.
+func confirmPosts(services []string, threads map[string][]*Post) error {
+	if !stdinIsTerminal() {
+		return nil
+	}
+	previewThreads(services, threads)
+	answer, err := promptLine("Post this? [y/N]: ")
+	if err != nil {
+		return err
+	}
+	if a := strings.ToLower(answer); a != "y" && a != "yes" {
+		return withExitCode(exitValidation, fmt.Errorf("cancelled, nothing was posted"))
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+)
+
+// activeProfile is the name of the configuration profile selected with
+// --profile or SHOUT_PROFILE. The empty string is the default profile.
+var activeProfile string
+
+// profileChosen is set when --profile or SHOUT_PROFILE picked the profile,
+// including --profile= for the main config, so default_account is ignored
+var profileChosen bool
+
+var profileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// extractGlobalFlags removes --profile, --config, --record, --replay, -q/--quiet, --no-color, and --plain
+// from anywhere in the arguments (up to a "--" terminator), applies them, and returns the remaining arguments
+func extractGlobalFlags(args []string) ([]string, error) {
+	activeProfile = os.Getenv("SHOUT_PROFILE")
+	profileChosen = activeProfile != ""
+	quiet, _ = strconv.ParseBool(os.Getenv("SHOUT_QUIET"))
+	plain, _ = strconv.ParseBool(os.Getenv("SHOUT_PLAIN"))
+
+	// Switches, which take an optional =value
+	switches := map[string]*bool{"q": &quiet, "quiet": &quiet, "no-color": &noColor, "plain": &plain}
+
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			rest = append(rest, args[i:]...)
+			break
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if target, ok := switches[name]; ok && strings.HasPrefix(arg, "-") {
+			*target = true
+			if hasValue {
+				var err error
+				if *target, err = strconv.ParseBool(value); err != nil {
+					if name == "q" {
+						name = "quiet"
+					}
+					return nil, fmt.Errorf("invalid value %q for --%s", value, name)
+				}
+			}
+			continue
+		}
+		if !strings.HasPrefix(arg, "-") || (name != "profile" && name != "config" && name != "record" && name != "replay") {
+			rest = append(rest, arg)
+			continue
+		}
+
+		if !hasValue {
+			if i+1 >= len(args) {
+				switch name {
+				case "config":
+					return nil, fmt.Errorf("--config requires a file, or - for stdin")
+				case "record", "replay":
+					return nil, fmt.Errorf("--%s requires a directory", name)
+				}
+				return nil, fmt.Errorf("--profile requires a name")
+			}
+			i++
+			value = args[i]
+		}
+		switch name {
+		case "config":
+			configPath = value
+		case "record":
+			recordDir = value
+		case "replay":
+			replayDir = value
+		default:
+			activeProfile = value
+			profileChosen = true
+		}
+	}
+
+	if activeProfile != "" && !profileNamePattern.MatchString(activeProfile) {
+		return nil, fmt.Errorf("invalid profile name %q: use letters, digits, '-' and '_'", activeProfile)
+	}
+
+	return rest, nil
+}
+
+// useDefaultAccount switches to the profile named by default_account in the
+// main config, unless --profile or SHOUT_PROFILE chose one
+func useDefaultAccount() error {
+	if profileChosen {
+		return nil
+	}
+
+	// Commands report a config that can't be loaded themselves
+	config, err := loadConfig()
+	if err != nil || config.DefaultAccount == "" {
+		return nil
+	}
+
+	name := config.DefaultAccount
+	if !profileNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid default_account %q: use letters, digits, '-' and '_'", name)
+	}
+	if configOverride == nil {
+		home, err := homedir.Dir()
+		if err != nil {
+			return fmt.Errorf("failed to get home directory: %w", err)
+		}
+		if _, err := os.Stat(filepath.Join(home, ".config", "shout", "profiles", name)); os.IsNotExist(err) {
+			return fmt.Errorf("default_account %q isn't a profile; set one up with 'shout --profile %s auth bluesky'", name, name)
+		}
+	}
+
+	activeProfile = name
+	return nil
+}
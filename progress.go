@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long an upload runs before its progress is shown, and how often it's redrawn
+const (
+	progressDelay    = 300 * time.Millisecond
+	progressInterval = 100 * time.Millisecond
+)
+
+// progressReader reports how much of an upload has been sent. Uploads to
+// several services at once share one status line on stderr.
+type progressReader struct {
+	r       io.Reader
+	label   string
+	total   int64
+	sent    int64
+	started time.Time
+}
+
+var (
+	progressMu     sync.Mutex
+	activeUploads  = map[*progressReader]bool{}
+	progressDrawn  time.Time
+	progressLength int
+)
+
+// showProgress reports whether progress bars are drawn: only on a terminal,
+// and not in quiet or plain mode
+func showProgress() bool {
+	if quiet || plain {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// newProgressReader wraps the data of an upload. The status line is cleared
+// once every upload has been read to the end or closed.
+func newProgressReader(label string, data []byte) io.ReadCloser {
+	p := &progressReader{r: bytes.NewReader(data), label: label, total: int64(len(data)), started: time.Now()}
+	if showProgress() {
+		progressMu.Lock()
+		activeUploads[p] = true
+		progressMu.Unlock()
+	}
+	return p
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	p.sent += int64(n)
+	if err == io.EOF {
+		p.finish()
+	} else if activeUploads[p] && time.Since(p.started) >= progressDelay && time.Since(progressDrawn) >= progressInterval {
+		drawProgress()
+	}
+	return n, err
+}
+
+func (p *progressReader) Close() error {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	p.finish()
+	return nil
+}
+
+// finish removes the upload from the status line; progressMu must be held
+func (p *progressReader) finish() {
+	if !activeUploads[p] {
+		return
+	}
+	delete(activeUploads, p)
+	if progressLength == 0 {
+		return
+	}
+	if len(activeUploads) == 0 {
+		fmt.Fprintf(os.Stderr, "\r%s\r", strings.Repeat(" ", progressLength))
+		progressLength = 0
+		return
+	}
+	drawProgress()
+}
+
+// drawProgress redraws the status line with every active upload; progressMu must be held
+func drawProgress() {
+	var uploads []*progressReader
+	for p := range activeUploads {
+		uploads = append(uploads, p)
+	}
+	sort.Slice(uploads, func(i, j int) bool { return uploads[i].label < uploads[j].label })
+
+	var parts []string
+	for _, p := range uploads {
+		parts = append(parts, p.status(len(uploads) == 1))
+	}
+	line := strings.Join(parts, "  |  ")
+
+	padding := ""
+	if len(line) < progressLength {
+		padding = strings.Repeat(" ", progressLength-len(line))
+	}
+	fmt.Fprintf(os.Stderr, "\r%s%s", line, padding)
+	progressLength = len(line)
+	progressDrawn = time.Now()
+}
+
+// status describes an upload's progress, with a bar if it's the only one
+func (p *progressReader) status(bar bool) string {
+	percent := 100
+	if p.total > 0 {
+		percent = int(p.sent * 100 / p.total)
+	}
+
+	speed := ""
+	if elapsed := time.Since(p.started).Seconds(); elapsed > 0 {
+		speed = fmt.Sprintf(", %s/s", formatBytes(int64(float64(p.sent)/elapsed)))
+	}
+
+	if !bar {
+		return fmt.Sprintf("%s %d%%%s", p.label, percent, speed)
+	}
+	const width = 30
+	filled := percent * width / 100
+	return fmt.Sprintf("%s [%s%s] %s / %s%s", p.label, strings.Repeat("=", filled), strings.Repeat(" ", width-filled),
+		formatBytes(p.sent), formatBytes(p.total), speed)
+}
+
+// formatBytes formats a byte count for display, such as 1.5 MB
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// isNetworkError reports whether err was caused by failing to reach a server,
+// as opposed to the server rejecting the request. Requests cut short by
+// Ctrl-C don't count, so interrupted posts aren't queued.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && !errors.Is(err, context.Canceled)
+}
+
+// deliverThread publishes a thread, or queues whatever couldn't be posted if
+// the service can't be reached
+func deliverThread(service string, thread []*Post) (results []*PostResult, queued bool, err error) {
+	results, err = publishThread(service, thread)
+	if err == nil || !isNetworkError(err) {
+		return results, false, err
+	}
+
+	// publishThread has already pointed the first unposted post at its parent
+	rest := thread[len(results):]
+	if err := queueThread(service, rest); err != nil {
+		return results, false, err
+	}
+
+	infof("Couldn't reach %s, so the post was queued. It will be sent the next time shout posts, or with 'shout queue flush'.\n", serviceNames[service])
+	return results, true, nil
+}
+
+// queueThread stores posts in the outbox for later delivery
+func queueThread(service string, thread []*Post) error {
+	return scheduleThread(service, thread, time.Time{})
+}
+
+// scheduleThread stores posts in the outbox to be delivered by the first
+// flush at or after notBefore
+func scheduleThread(service string, thread []*Post, notBefore time.Time) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.Enqueue(&QueuedPost{
+		Service:   service,
+		Text:      thread[0].Text,
+		Posts:     thread,
+		CreatedAt: time.Now(),
+		NotBefore: notBefore,
+	})
+}
+
+// errQueueBusy is returned by flushQueue while another process is flushing
+var errQueueBusy = errors.New("another shout process is already delivering the queue")
+
+// flushQueue delivers queued posts in the order they were queued, skipping
+// scheduled posts that aren't due yet. It stops at the first post that can't
+// reach its service, leaving it and the ones after it queued. Posts the
+// service rejects are marked as failed and held until they're retried, so
+// they don't block the rest.
+func flushQueue() (delivered int, err error) {
+	// One flush at a time, so the daemon and a post flushing together don't
+	// both deliver the same entries
+	dir, err := storeDir()
+	if err != nil {
+		return 0, err
+	}
+	unlock, err := lockPath(filepath.Join(dir, "queue.lock"), 0)
+	if err != nil {
+		return 0, err
+	}
+	if unlock == nil {
+		return 0, errQueueBusy
+	}
+	defer unlock()
+
+	store, err := openStore()
+	if err != nil {
+		return 0, err
+	}
+	queue, err := store.Queue()
+	store.Close()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read queue: %w", err)
+	}
+
+	failed := 0
+	for _, queued := range queue {
+		if queued.NotBefore.After(time.Now()) || queued.Error != "" {
+			continue
+		}
+
+		// Posts queued by older versions only have their text
+		thread := queued.Posts
+		if len(thread) == 0 {
+			thread = []*Post{{Text: queued.Text}}
+		}
+
+		results, err := publishThread(queued.Service, thread)
+		if len(results) > 0 {
+			// Keep only what's left of a partly delivered thread
+			if err := requeueRemainder(&queued, len(results)); err != nil {
+				return delivered, err
+			}
+		}
+		if err != nil {
+			// Network errors and Ctrl-C are retried on the next flush
+			if isNetworkError(err) || rootCtx.Err() != nil {
+				return delivered, fmt.Errorf("queued post %d to %s: %w", queued.ID, serviceNames[queued.Service], err)
+			}
+			// Anything else needs attention, and won't go better by trying again
+			if err := holdQueued(queued, err); err != nil {
+				return delivered, err
+			}
+			warnf("queued post %d to %s failed: %v\n", queued.ID, serviceNames[queued.Service], err)
+			notify("shout: queued post failed", fmt.Sprintf("%s: %v", serviceNames[queued.Service], err))
+			failed++
+			continue
+		}
+		notify("shout: queued post delivered", fmt.Sprintf("%s: %s", serviceNames[queued.Service], results[0].URL))
+		delivered++
+	}
+
+	if failed > 0 {
+		return delivered, fmt.Errorf("%d queued post(s) failed; fix them and run 'shout queue retry <id>', or drop them", failed)
+	}
+	return delivered, nil
+}
+
+// holdQueued records why a queued post failed, which keeps flushes from
+// sending it until it's retried
+func holdQueued(queued QueuedPost, cause error) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	queued.Error = cause.Error()
+	return store.UpdateQueued(&queued)
+}
+
+// requeueRemainder removes the first posted posts of a queued thread, dropping
+// the queue entry once all of them are delivered
+func requeueRemainder(queued *QueuedPost, posted int) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if posted >= len(queued.Posts) {
+		return store.Dequeue(queued.ID)
+	}
+
+	queued.Posts = queued.Posts[posted:]
+	queued.Text = queued.Posts[0].Text
+	return store.UpdateQueued(queued)
+}
+
+// flushQueueBeforePosting sends anything left in the outbox ahead of a new post
+func flushQueueBeforePosting() {
+	delivered, err := flushQueue()
+	if delivered > 0 {
+		infof("Delivered %d queued post(s)\n", delivered)
+	}
+	switch {
+	case errors.Is(err, errQueueBusy):
+		infof("Another shout process is delivering the queue.\n")
+	case err != nil && isNetworkError(err):
+		infof("Queued posts are still waiting for a connection.\n")
+	case err != nil:
+		warnf("couldn't deliver queued posts: %v\n", err)
+	}
+}
+
+func queueCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		queue, err := store.Queue()
+		if err != nil {
+			return fmt.Errorf("failed to read queue: %w", err)
+		}
+		if len(queue) == 0 {
+			fmt.Println("The queue is empty.")
+			return nil
+		}
+		for _, queued := range queue {
+			fmt.Printf("%d\t%s\t%s\t%s", queued.ID, queued.CreatedAt.Local().Format("2006-01-02 15:04"), serviceNames[queued.Service], truncateText(queued.Text, 50))
+			if !queued.NotBefore.IsZero() {
+				fmt.Printf("\tscheduled for %s", queued.NotBefore.Local().Format("2006-01-02 15:04"))
+			}
+			if queued.Error != "" {
+				fmt.Printf("\tfailed: %s", queued.Error)
+			}
+			fmt.Println()
+		}
+		return nil
+
+	case "flush":
+		delivered, err := flushQueue()
+		fmt.Printf("Delivered %d queued post(s)\n", delivered)
+		return err
+
+	case "retry":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: shout queue retry <id>")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid queue ID: %s", args[1])
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		queued, err := store.Queued(id)
+		if err == nil && queued == nil {
+			err = fmt.Errorf("no queued post with ID %d", id)
+		}
+		if err == nil {
+			queued.Error = ""
+			err = store.UpdateQueued(queued)
+		}
+		store.Close()
+		if err != nil {
+			return err
+		}
+
+		delivered, err := flushQueue()
+		fmt.Printf("Delivered %d queued post(s)\n", delivered)
+		return err
+
+	case "drop":
+		if len(args) < 2 {
+			return fmt.Errorf("usage: shout queue drop <id>")
+		}
+		id, err := strconv.ParseUint(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid queue ID: %s", args[1])
+		}
+
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+		return store.Dequeue(id)
+
+	default:
+		fmt.Println("Usage: shout queue [list|flush|retry <id>|drop <id>]")
+		os.Exit(1)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// rateLimitState is a service's token bucket, kept in the store so the limit
+// holds across invocations
+type rateLimitState struct {
+	Tokens    float64   `json:"tokens"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// refill adds the tokens earned since the bucket was last updated, up to perHour
+func (s *rateLimitState) refill(perHour int, now time.Time) {
+	if elapsed := now.Sub(s.UpdatedAt); elapsed > 0 {
+		s.Tokens += elapsed.Hours() * float64(perHour)
+	}
+	s.Tokens = min(s.Tokens, float64(perHour))
+	s.UpdatedAt = now
+}
+
+// takeRateLimitToken enforces the configured posts_per_hour for service
+func takeRateLimitToken(config *Config, service string) error {
+	if config.PostsPerHour <= 0 {
+		return nil
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	wait, err := store.TakeToken(service, config.PostsPerHour, time.Now())
+	if err != nil {
+		return fmt.Errorf("failed to check the local rate limit: %w", err)
+	}
+	if wait > 0 {
+		return withExitCode(exitRateLimit, fmt.Errorf("reached the limit of %d posts per hour to %s set in the config; the next post is allowed in %s", config.PostsPerHour, serviceNames[service], wait.Round(time.Second)))
+	}
+	return nil
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// recordDir and replayDir are set by --record and --replay
+var recordDir, replayDir string
+
+// secretNamePattern matches the names of headers, query parameters, and
+// JSON or form fields whose values are credentials, including the
+// signatures on webhook requests and signed download links
+var secretNamePattern = regexp.MustCompile(`(?i)password|passphrase|secret|token|jwt|api[-_]?key|private[-_]?key|authorization|^auth$|cookie|dpop|code_verifier|^code$|signature|credential|^sig$`)
+
+// recordedExchange is one request and its response, as written to a file
+type recordedExchange struct {
+	Request  recordedMessage `json:"request"`
+	Response recordedMessage `json:"response"`
+	Error    string          `json:"error,omitempty"` // the request failed without a response
+}
+
+type recordedMessage struct {
+	Method     string            `json:"method,omitempty"`
+	URL        string            `json:"url,omitempty"`
+	Status     int               `json:"status,omitempty"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body,omitempty"`
+	BodyBase64 string            `json:"body_base64,omitempty"` // bodies that aren't text, like images
+}
+
+// setupRecording routes HTTP requests through a recorder or a replayer when
+// --record or --replay was given
+func setupRecording() error {
+	switch {
+	case recordDir != "" && replayDir != "":
+		return fmt.Errorf("--record and --replay can't be used together")
+	case recordDir != "":
+		if err := os.MkdirAll(recordDir, 0700); err != nil {
+			return fmt.Errorf("failed to create recording directory: %w", err)
+		}
+		// Number on from recordings already there, so several commands can be recorded in turn
+		existing, _ := filepath.Glob(filepath.Join(recordDir, "*.json"))
+		http.DefaultTransport = &recordingTransport{base: http.DefaultTransport, dir: recordDir, count: len(existing)}
+	case replayDir != "":
+		replayer, err := loadRecordings(replayDir)
+		if err != nil {
+			return err
+		}
+		http.DefaultTransport = replayer
+	}
+	return nil
+}
+
+// sanitizeHeader copies a header, hiding the values of credentials
+func sanitizeHeader(header http.Header) map[string]string {
+	if len(header) == 0 {
+		return nil
+	}
+	sanitized := make(map[string]string)
+	for name, values := range header {
+		value := strings.Join(values, ", ")
+		if secretNamePattern.MatchString(name) {
+			value = "REDACTED"
+		}
+		sanitized[name] = value
+	}
+	return sanitized
+}
+
+// sanitizeURL hides the values of query parameters that are credentials
+func sanitizeURL(u *url.URL) string {
+	sanitized := *u
+	query := sanitized.Query()
+	for name := range query {
+		if secretNamePattern.MatchString(name) {
+			query.Set(name, "REDACTED")
+		}
+	}
+	if len(query) > 0 {
+		sanitized.RawQuery = query.Encode()
+	}
+	sanitized.User = nil
+	return sanitized.String()
+}
+
+// sanitizeJSON hides the values of fields that are credentials, at any depth
+func sanitizeJSON(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		for name, field := range value {
+			if secretNamePattern.MatchString(name) {
+				value[name] = "REDACTED"
+			} else {
+				value[name] = sanitizeJSON(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = sanitizeJSON(item)
+		}
+	}
+	return value
+}
+
+// sanitizeBody stores a JSON or form body with its credentials hidden, other
+// text as it is, and anything else in base64
+func sanitizeBody(message *recordedMessage, contentType string, body []byte) {
+	var parsed interface{}
+	switch {
+	case len(body) == 0:
+		return
+	case json.Unmarshal(body, &parsed) == nil:
+		sanitized, _ := json.Marshal(sanitizeJSON(parsed))
+		message.Body = string(sanitized)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			message.Body = "REDACTED"
+			return
+		}
+		for name := range form {
+			if secretNamePattern.MatchString(name) {
+				form.Set(name, "REDACTED")
+			}
+		}
+		message.Body = form.Encode()
+	case utf8.Valid(body):
+		message.Body = string(body)
+	default:
+		message.BodyBase64 = base64.StdEncoding.EncodeToString(body)
+	}
+}
+
+// recordingTransport writes every request and its response to a numbered
+// file in dir, with credentials hidden
+type recordingTransport struct {
+	base  http.RoundTripper
+	dir   string
+	mu    sync.Mutex
+	count int
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := recordedExchange{Request: recordedMessage{Method: req.Method, URL: sanitizeURL(req.URL), Header: sanitizeHeader(req.Header)}}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		sanitizeBody(&exchange.Request, req.Header.Get("Content-Type"), body)
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		exchange.Error = err.Error()
+		t.save(req, exchange)
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	exchange.Response = recordedMessage{Status: resp.StatusCode, Header: sanitizeHeader(resp.Header)}
+	sanitizeBody(&exchange.Response, resp.Header.Get("Content-Type"), body)
+	t.save(req, exchange)
+	return resp, nil
+}
+
+// save writes an exchange to the next file, like 0003-POST-bsky.social.json
+func (t *recordingTransport) save(req *http.Request, exchange recordedExchange) {
+	data, err := json.MarshalIndent(exchange, "", "  ")
+	if err != nil {
+		warnf("failed to record %s %s: %v\n", req.Method, req.URL.Host, err)
+		return
+	}
+
+	t.mu.Lock()
+	t.count++
+	name := fmt.Sprintf("%04d-%s-%s.json", t.count, req.Method, strings.ReplaceAll(req.URL.Host, ":", "_"))
+	t.mu.Unlock()
+
+	if err := os.WriteFile(filepath.Join(t.dir, name), append(data, '\n'), 0600); err != nil {
+		warnf("failed to record %s %s: %v\n", req.Method, req.URL.Host, err)
+	}
+}
+
+// replayTransport answers requests with recorded responses instead of
+// sending them: each request gets the first unused recording with the same
+// method, host, and path
+type replayTransport struct {
+	dir        string
+	mu         sync.Mutex
+	recordings []recordedExchange
+	used       []bool
+}
+
+// loadRecordings reads the recordings in dir, in the order they were made
+func loadRecordings(dir string) (*replayTransport, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no recordings in %s", dir)
+	}
+	sort.Strings(paths)
+
+	t := &replayTransport{dir: dir}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recording: %w", err)
+		}
+		var exchange recordedExchange
+		if err := json.Unmarshal(data, &exchange); err != nil {
+			return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+		}
+		t.recordings = append(t.recordings, exchange)
+	}
+	t.used = make([]bool, len(t.recordings))
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	t.mu.Lock()
+	var exchange *recordedExchange
+	for i := range t.recordings {
+		recorded, err := url.Parse(t.recordings[i].Request.URL)
+		if t.used[i] || err != nil || t.recordings[i].Request.Method != req.Method || recorded.Host != req.URL.Host || recorded.Path != req.URL.Path {
+			continue
+		}
+		t.used[i] = true
+		exchange = &t.recordings[i]
+		break
+	}
+	t.mu.Unlock()
+
+	if exchange == nil {
+		return nil, fmt.Errorf("no recording left in %s for %s %s", t.dir, req.Method, req.URL.Scheme+"://"+req.URL.Host+req.URL.Path)
+	}
+	if exchange.Error != "" {
+		return nil, errors.New(exchange.Error)
+	}
+
+	body := []byte(exchange.Response.Body)
+	if exchange.Response.BodyBase64 != "" {
+		var err error
+		if body, err = base64.StdEncoding.DecodeString(exchange.Response.BodyBase64); err != nil {
+			return nil, fmt.Errorf("invalid recorded body for %s %s: %w", req.Method, req.URL.Path, err)
+		}
+	}
+	header := make(http.Header)
+	for name, value := range exchange.Response.Header {
+		header.Set(name, value)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", exchange.Response.Status, http.StatusText(exchange.Response.Status)),
+		StatusCode:    exchange.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
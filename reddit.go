@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Maximum character count of a Reddit comment, which threads continue in.
+// Self posts can be longer, up to 40,000.
+const RedditCharacterLimit = 10000
+
+// Maximum character count of a Reddit post's title
+const redditTitleLimit = 300
+
+// Reddit's login and API endpoints
+var (
+	redditAuthURL = "https://www.reddit.com"
+	redditAPIURL  = "https://oauth.reddit.com"
+)
+
+// RedditSession holds a script app's client and the access token it got for
+// the account. Tokens last an hour and script apps get no refresh token, so
+// shout logs in again from configured credentials when it expires.
+type RedditSession struct {
+	ClientID     string    `json:"client_id"`
+	ClientSecret string    `json:"client_secret"`
+	Username     string    `json:"username"`
+	AccessToken  string    `json:"access_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// redditUserAgent identifies shout and the account, as Reddit's API rules ask
+func redditUserAgent(username string) string {
+	return "shout/" + readBuildDetails().Version + " (by /u/" + username + ")"
+}
+
+// redditLogin gets an access token for a script app with the account's password
+func redditLogin(clientID, clientSecret, username, password string) (*RedditSession, error) {
+	form := url.Values{"grant_type": {"password"}, "username": {username}, "password": {password}}
+	req, err := http.NewRequest("POST", redditAuthURL+"/api/v1/access_token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(clientID, clientSecret)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", redditUserAgent(username))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return nil, withExitCode(exitAuth, &statusError{Action: "login", Status: resp.StatusCode, Body: string(body)})
+	}
+
+	// Wrong passwords are answered with 200 and an error field
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+		Error       string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &token); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if token.Error != "" || token.AccessToken == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("login failed: %s, check the username, password, and the app's client ID and secret", token.Error))
+	}
+
+	return &RedditSession{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Username:     username,
+		AccessToken:  token.AccessToken,
+		ExpiresAt:    time.Now().Add(time.Duration(token.ExpiresIn) * time.Second),
+	}, nil
+}
+
+// redditClient returns the client ID and secret from the environment, or asks for them
+func redditClient() (clientID, clientSecret string, err error) {
+	clientID, clientSecret = os.Getenv("REDDIT_CLIENT_ID"), os.Getenv("REDDIT_CLIENT_SECRET")
+	if clientID != "" && clientSecret != "" {
+		return clientID, clientSecret, nil
+	}
+	fmt.Println("Create a \"script\" app at https://www.reddit.com/prefs/apps. Its client ID is shown under its name.")
+	if clientID, err = promptLine("Enter the app's client ID: "); err != nil {
+		return "", "", fmt.Errorf("failed to read client ID: %w", err)
+	}
+	if clientSecret, err = promptLine("Enter the app's secret: "); err != nil {
+		return "", "", fmt.Errorf("failed to read secret: %w", err)
+	}
+	return clientID, clientSecret, nil
+}
+
+func authenticateReddit() error {
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	clientID, clientSecret := config.RedditSession.ClientID, config.RedditSession.ClientSecret
+	if os.Getenv("REDDIT_CLIENT_ID") != "" || clientID == "" {
+		if clientID, clientSecret, err = redditClient(); err != nil {
+			return err
+		}
+	}
+
+	// Use credentials from the config or environment when available, otherwise prompt
+	username, password, ok, err := configuredCredentials(config, "reddit", "REDDIT_USERNAME", "REDDIT_PASSWORD")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if username, err = promptLine("Enter your Reddit username: "); err != nil {
+			return fmt.Errorf("failed to read username: %w", err)
+		}
+		if password, err = promptLine("Enter your Reddit password: "); err != nil {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+	}
+
+	session, err := redditLogin(strings.TrimSpace(clientID), strings.TrimSpace(clientSecret), strings.TrimPrefix(strings.TrimSpace(username), "u/"), password)
+	if err != nil {
+		return err
+	}
+
+	config.RedditSession = *session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with Reddit as u/%s!\n", session.Username)
+	return nil
+}
+
+// loadRedditSession loads the config and returns it with a Reddit access
+// token that hasn't expired, logging in again from configured credentials
+// when it has
+func loadRedditSession() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	session := config.RedditSession
+	if session.ClientID == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with Reddit, please run 'shout auth reddit' first"))
+	}
+	// Leave a minute for the request itself
+	if session.AccessToken != "" && time.Until(session.ExpiresAt) > time.Minute {
+		return config, nil
+	}
+
+	// Log in once when several shout processes find the token expired, and
+	// let the others use the new one
+	if configOverride == nil {
+		unlock, err := lockConfigFile("reddit-refresh")
+		if err != nil {
+			return nil, err
+		}
+		defer unlock()
+		if config, err = loadConfig(); err != nil {
+			return nil, fmt.Errorf("failed to load config: %w", err)
+		}
+		session = config.RedditSession
+		if session.AccessToken != "" && time.Until(session.ExpiresAt) > time.Minute {
+			return config, nil
+		}
+	}
+
+	username, password, ok, err := configuredCredentials(config, "reddit", "REDDIT_USERNAME", "REDDIT_PASSWORD")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, withExitCode(exitAuth, fmt.Errorf("the Reddit session expired, run 'shout auth reddit' again or set up credentials so shout can log in by itself"))
+	}
+	logf(logDebug, "Reddit access token expired, logging in again")
+	renewed, err := redditLogin(session.ClientID, session.ClientSecret, username, password)
+	if err != nil {
+		return nil, err
+	}
+	config.RedditSession = *renewed
+	if err := saveConfig(config); err != nil {
+		return nil, fmt.Errorf("failed to save config: %w", err)
+	}
+	return config, nil
+}
+
+// redditRequest sends a form to the API and decodes the JSON response into out
+func redditRequest(session RedditSession, method, path string, form url.Values, out interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequest(method, redditAPIURL+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+session.AccessToken)
+	req.Header.Set("User-Agent", redditUserAgent(session.Username))
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// redditErrors is how the API reports errors with api_type=json: a list of
+// [code, message, field] triples
+type redditErrors [][]string
+
+func (e redditErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	var messages []string
+	for _, triple := range e {
+		messages = append(messages, strings.Join(triple[:min(len(triple), 2)], ": "))
+	}
+	return fmt.Errorf("%s", strings.Join(messages, "; "))
+}
+
+// redditSubmission maps a post to a Reddit submission. A body that is only a
+// link makes a link post, anything else a self post.
+func redditSubmission(post *Post) (title, kind, body string) {
+	title, body = splitTitle(post)
+	if isOnlyLink(body) {
+		return title, "link", body
+	}
+	return title, "self", body
+}
+
+// checkRedditPost checks a post that would start a new Reddit submission
+func checkRedditPost(post *Post) error {
+	if post.Subreddit == "" {
+		return withExitCode(exitValidation, fmt.Errorf("posting to Reddit needs a --subreddit, or a subreddit in the reddit defaults"))
+	}
+	title, _ := splitTitle(post)
+	if title == "" {
+		return withExitCode(exitValidation, fmt.Errorf("posting to Reddit needs a --title, or a first line to use as the title"))
+	}
+	if length := utf8.RuneCountInString(title); length > redditTitleLimit {
+		return withExitCode(exitValidation, fmt.Errorf("the Reddit title is %d characters, over the limit of %d. Pass a shorter --title", length, redditTitleLimit))
+	}
+	return nil
+}
+
+// PostToReddit submits a post to its subreddit, or replies to a post of a
+// thread with a comment
+func PostToReddit(post *Post) (*PostResult, error) {
+	config, err := loadRedditSession()
+	if err != nil {
+		return nil, err
+	}
+	session := config.RedditSession
+
+	var response struct {
+		JSON struct {
+			Errors redditErrors `json:"errors"`
+			Data   struct {
+				// Submissions
+				Name string `json:"name"`
+				URL  string `json:"url"`
+
+				// Comments
+				Things []struct {
+					Data struct {
+						Name      string `json:"name"`
+						Permalink string `json:"permalink"`
+					} `json:"data"`
+				} `json:"things"`
+			} `json:"data"`
+		} `json:"json"`
+	}
+
+	result := &PostResult{}
+	if post.ReplyTo != nil {
+		form := url.Values{"api_type": {"json"}, "thing_id": {post.ReplyTo.ID}, "text": {post.Text}}
+		if err := redditRequest(session, "POST", "/api/comment", form, &response); err != nil {
+			return nil, fmt.Errorf("commenting failed: %w", err)
+		}
+		if err := response.JSON.Errors.err(); err != nil {
+			return nil, fmt.Errorf("commenting failed: %w", err)
+		}
+		if len(response.JSON.Data.Things) == 0 {
+			return nil, fmt.Errorf("commenting failed: the response has no comment")
+		}
+		comment := response.JSON.Data.Things[0].Data
+		result.ID, result.URI, result.URL = comment.Name, comment.Name, "https://www.reddit.com"+comment.Permalink
+	} else {
+		if err := checkRedditPost(post); err != nil {
+			return nil, err
+		}
+		title, kind, body := redditSubmission(post)
+		form := url.Values{"api_type": {"json"}, "sr": {strings.TrimPrefix(post.Subreddit, "r/")}, "kind": {kind}, "title": {title}}
+		if kind == "link" {
+			form.Set("url", body)
+		} else {
+			form.Set("text", body)
+		}
+		if len(post.Labels) > 0 {
+			form.Set("nsfw", "true")
+		}
+		if post.ContentWarning != "" {
+			form.Set("spoiler", "true")
+		}
+		if err := redditRequest(session, "POST", "/api/submit", form, &response); err != nil {
+			return nil, fmt.Errorf("posting failed: %w", err)
+		}
+		if err := response.JSON.Errors.err(); err != nil {
+			return nil, fmt.Errorf("posting failed: %w", err)
+		}
+		result.ID, result.URI, result.URL = response.JSON.Data.Name, response.JSON.Data.Name, response.JSON.Data.URL
+	}
+
+	successf("Successfully posted to Reddit!\n  URL: %s\n", result.URL)
+
+	if err := recordHistory("reddit", post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// deleteRedditPost deletes a submission or comment by its fullname, like
+// t3_abc123, after checking that it's still there and ours
+func deleteRedditPost(name string) error {
+	config, err := loadRedditSession()
+	if err != nil {
+		return err
+	}
+
+	// Reddit answers 200 for things that are already gone, so look at the author
+	var info struct {
+		Data struct {
+			Children []struct {
+				Data struct {
+					Author string `json:"author"`
+				} `json:"data"`
+			} `json:"children"`
+		} `json:"data"`
+	}
+	if err := redditRequest(config.RedditSession, "GET", "/api/info?id="+url.QueryEscape(name), nil, &info); err != nil {
+		return err
+	}
+	if len(info.Data.Children) == 0 || info.Data.Children[0].Data.Author == "[deleted]" {
+		return errAlreadyDeleted
+	}
+	if !strings.EqualFold(info.Data.Children[0].Data.Author, config.RedditSession.Username) {
+		return errOtherAccount
+	}
+
+	if err := redditRequest(config.RedditSession, "POST", "/api/del", url.Values{"id": {name}}, nil); err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}
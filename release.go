@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const defaultReleaseTemplate = "{{.repo}} {{.tag}} is out! {{.changelog}} {{.url}}"
+
+// releaseInfo describes the latest release of the git repository in the current directory
+type releaseInfo struct {
+	Repo      string
+	Tag       string
+	Changelog string
+	URL       string
+}
+
+// git runs a git command and returns its trimmed output
+func git(args ...string) (string, error) {
+	out, err := exec.Command("git", args...).Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok && len(exitErr.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", strings.Join(args, " "), strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+var (
+	scpRemotePattern = regexp.MustCompile(`^[\w.-]+@([\w.-]+):(.+)$`)
+	repeatedSpaces   = regexp.MustCompile(` {2,}`)
+)
+
+// remoteWebURL converts a git remote URL (https or scp-style ssh) into a browsable https URL
+func remoteWebURL(remote string) string {
+	if m := scpRemotePattern.FindStringSubmatch(remote); m != nil {
+		remote = "https://" + m[1] + "/" + m[2]
+	}
+	remote = strings.TrimPrefix(remote, "ssh://git@")
+	if !strings.HasPrefix(remote, "http://") && !strings.HasPrefix(remote, "https://") {
+		remote = "https://" + remote
+	}
+	return strings.TrimSuffix(remote, ".git")
+}
+
+// changelogExcerpt returns the CHANGELOG.md section for tag, with its entries joined onto one line
+func changelogExcerpt(root, tag string) string {
+	f, err := os.Open(filepath.Join(root, "CHANGELOG.md"))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	version := strings.TrimPrefix(tag, "v")
+	var entries []string
+	inSection := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#") {
+			if inSection {
+				break
+			}
+			inSection = headingNamesVersion(line, version)
+			continue
+		}
+		if inSection && line != "" {
+			entries = append(entries, strings.TrimSpace(strings.TrimLeft(line, "-*")))
+		}
+	}
+
+	return strings.Join(entries, "; ")
+}
+
+// headingNamesVersion reports whether a changelog heading, like "## [1.2.1]
+// - 2024-05-01" or "## v1.2.1", is for version, and not 1.2.10 or 1.2.1-rc1
+func headingNamesVersion(heading, version string) bool {
+	words := strings.FieldsFunc(heading, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(".-+", r)
+	})
+	for _, word := range words {
+		if strings.TrimPrefix(word, "v") == version {
+			return true
+		}
+	}
+	return false
+}
+
+// commitSummary lists the commit subjects between the previous tag and tag
+func commitSummary(tag string) string {
+	rangeSpec := tag
+	if previous, err := git("describe", "--tags", "--abbrev=0", tag+"^"); err == nil {
+		rangeSpec = previous + ".." + tag
+	}
+
+	out, err := git("log", "--format=%s", rangeSpec)
+	if err != nil || out == "" {
+		return ""
+	}
+	return strings.Join(strings.Split(out, "\n"), "; ")
+}
+
+// latestRelease inspects the current git repository for its latest tag, changelog, and URL
+func latestRelease() (*releaseInfo, error) {
+	root, err := git("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not in a git repository: %w", err)
+	}
+
+	tag, err := git("describe", "--tags", "--abbrev=0")
+	if err != nil {
+		return nil, fmt.Errorf("no release tag found: %w", err)
+	}
+
+	info := &releaseInfo{Repo: filepath.Base(root), Tag: tag}
+
+	if remote, err := git("remote", "get-url", "origin"); err == nil {
+		info.URL = remoteWebURL(remote)
+		info.Repo = filepath.Base(info.URL)
+		if strings.Contains(info.URL, "github.com/") {
+			info.URL += "/releases/tag/" + tag
+		}
+	}
+
+	info.Changelog = changelogExcerpt(root, tag)
+	if info.Changelog == "" {
+		info.Changelog = commitSummary(tag)
+	}
+
+	return info, nil
+}
+
+// renderRelease fills in the release template, shortening the changelog
+// excerpt as needed for the post to fit within limit. length measures a
+// message as it will be posted, with the signature and links counted.
+func renderRelease(tmpl string, info *releaseInfo, limit int, length func(string) int) (string, error) {
+	data := map[string]string{
+		"repo": info.Repo,
+		"tag":  info.Tag,
+		"url":  info.URL,
+	}
+
+	changelog := []rune(info.Changelog)
+	for {
+		data["changelog"] = string(changelog)
+		message, err := renderTemplate(tmpl, data)
+		if err != nil {
+			return "", err
+		}
+		// An empty changelog leaves a double space behind in the default template
+		message = strings.TrimSpace(repeatedSpaces.ReplaceAllString(message, " "))
+
+		over := length(message) - limit
+		if over <= 0 || len(changelog) == 0 {
+			return message, nil
+		}
+		// Cutting may shorten a link in the changelog by less than its weight, so measure again
+		if keep := len(changelog) - over - 1; keep > 0 {
+			changelog = append(changelog[:keep:keep], '…')
+		} else {
+			changelog = nil
+		}
+	}
+}
+
+func announceRelease(args []string) error {
+	fs := flag.NewFlagSet("announce-release", flag.ExitOnError)
+	tmpl := fs.String("template", defaultReleaseTemplate, "announcement template: {{.repo}}, {{.tag}}, {{.changelog}}, and {{.url}} are available")
+	dryRun := fs.Bool("dry-run", false, "print the announcement without posting it")
+	fs.Parse(args)
+
+	info, err := latestRelease()
+	if err != nil {
+		return err
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	settings := config.Defaults["bluesky"]
+	message, err := renderRelease(*tmpl, info, characterLimits["bluesky"], func(message string) int {
+		return postLength("bluesky", postForService(Post{Text: message}, settings).Text)
+	})
+	if err != nil {
+		return err
+	}
+
+	if *dryRun {
+		fmt.Println(message)
+		return nil
+	}
+
+	post, err := applyConfigDefaults("bluesky", Post{Text: message})
+	if err != nil {
+		return err
+	}
+
+	if err := checkLength(post.Text); err != nil {
+		return err
+	}
+
+	_, err = publish("bluesky", post)
+	return err
+}
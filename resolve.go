@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// resolveHandle looks up the DID for a handle
+func resolveHandle(config *Config, handle string) (string, error) {
+	var result struct {
+		Did string `json:"did"`
+	}
+	params := url.Values{"handle": {strings.TrimPrefix(handle, "@")}}
+	if err := blueskyGet(config, "com.atproto.identity.resolveHandle", params, &result); err != nil {
+		return "", err
+	}
+	return result.Did, nil
+}
+
+// postURIFromReference converts a bsky.app post URL into an at:// URI. at:// URIs are returned unchanged.
+func postURIFromReference(config *Config, ref string) (string, error) {
+	if strings.HasPrefix(ref, "at://") {
+		return ref, nil
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid post URL: %w", err)
+	}
+
+	// https://bsky.app/profile/<handle or did>/post/<rkey>
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(parts) != 4 || parts[0] != "profile" || parts[2] != "post" {
+		return "", fmt.Errorf("not a Bluesky post URL: %s", ref)
+	}
+
+	actor := parts[1]
+	if !strings.HasPrefix(actor, "did:") {
+		if actor, err = resolveHandle(config, actor); err != nil {
+			return "", fmt.Errorf("failed to resolve handle %s: %w", parts[1], err)
+		}
+	}
+
+	return fmt.Sprintf("at://%s/app.bsky.feed.post/%s", actor, parts[3]), nil
+}
+
+// strongRef points at a specific version of a record, as replies, quotes,
+// likes, and reposts require
+type strongRef struct {
+	URI string `json:"uri"`
+	CID string `json:"cid"`
+}
+
+// resolvePostReference turns a bsky.app post URL or at:// URI into a strong
+// reference by looking up the post's current CID
+func resolvePostReference(config *Config, ref string) (*strongRef, error) {
+	uri, err := postURIFromReference(config, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	posts, err := getPosts(config, []string{uri})
+	if err != nil {
+		return nil, err
+	}
+	if len(posts) == 0 {
+		return nil, fmt.Errorf("post not found: %s", ref)
+	}
+
+	return &strongRef{URI: posts[0].URI, CID: posts[0].CID}, nil
+}
+
+func resolveCommand(args []string) error {
+	if len(args) == 0 {
+		fmt.Println("Usage: shout resolve <post-url>...")
+		os.Exit(1)
+	}
+
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+
+	for _, ref := range args {
+		resolved, err := resolvePostReference(config, ref)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", resolved.URI, resolved.CID)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// scheduledPosts returns the queued posts that are held until a time, soonest first
+func scheduledPosts() ([]QueuedPost, error) {
+	store, err := openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+
+	queue, err := store.Queue()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	var scheduled []QueuedPost
+	for _, queued := range queue {
+		if !queued.NotBefore.IsZero() {
+			scheduled = append(scheduled, queued)
+		}
+	}
+	sort.SliceStable(scheduled, func(i, j int) bool {
+		return scheduled[i].NotBefore.Before(scheduled[j].NotBefore)
+	})
+	return scheduled, nil
+}
+
+// findScheduled looks up a scheduled post by the ID that schedule list shows
+func findScheduled(store *Store, arg string) (*QueuedPost, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return nil, withExitCode(exitValidation, fmt.Errorf("invalid schedule ID: %s", arg))
+	}
+	queued, err := store.Queued(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	if queued == nil || queued.NotBefore.IsZero() {
+		return nil, withExitCode(exitValidation, fmt.Errorf("there is no scheduled post %d, see 'shout schedule list'", id))
+	}
+	return queued, nil
+}
+
+// showScheduled prints a scheduled post or thread with its settings
+func showScheduled(queued *QueuedPost) {
+	fmt.Printf("ID:        %d\n", queued.ID)
+	fmt.Printf("Service:   %s\n", serviceNames[queued.Service])
+	fmt.Printf("Scheduled: %s\n", queued.NotBefore.Local().Format("2006-01-02 15:04"))
+	fmt.Printf("Created:   %s\n", queued.CreatedAt.Local().Format("2006-01-02 15:04"))
+
+	// Posts queued by older versions only have their text
+	thread := queued.Posts
+	if len(thread) == 0 {
+		thread = []*Post{{Text: queued.Text}}
+	}
+	for i, post := range thread {
+		fmt.Println()
+		if len(thread) > 1 {
+			fmt.Printf("Post %d of %d:\n", i+1, len(thread))
+		}
+		if post.ContentWarning != "" {
+			fmt.Printf("  Content warning: %s\n", post.ContentWarning)
+		}
+		if len(post.Labels) > 0 {
+			fmt.Printf("  Labels: %s\n", strings.Join(post.Labels, ", "))
+		}
+		if post.Language != "" {
+			fmt.Printf("  Language: %s\n", post.Language)
+		}
+		if post.Visibility != "" {
+			fmt.Printf("  Visibility: %s\n", post.Visibility)
+		}
+		for j, image := range post.Images {
+			alt := image.Alt
+			if alt == "" {
+				alt = "(no alt text)"
+			}
+			fmt.Printf("  Image %d: %s, %s\n", j+1, formatBytes(int64(len(image.Data))), alt)
+		}
+		for _, line := range strings.Split(post.Text, "\n") {
+			fmt.Printf("  | %s\n", line)
+		}
+	}
+}
+
+func scheduleCommand(args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	switch args[0] {
+	case "list":
+		scheduled, err := scheduledPosts()
+		if err != nil {
+			return err
+		}
+		if len(scheduled) == 0 {
+			fmt.Println("There are no scheduled posts.")
+			return nil
+		}
+		for _, queued := range scheduled {
+			text := truncateText(queued.Text, 50)
+			if len(queued.Posts) > 1 {
+				text += fmt.Sprintf(" (thread of %d)", len(queued.Posts))
+			}
+			fmt.Printf("%d\t%s\t%s\t%s\n", queued.ID, queued.NotBefore.Local().Format("2006-01-02 15:04"), serviceNames[queued.Service], text)
+		}
+		return nil
+
+	case "show":
+		if len(args) < 2 {
+			return withExitCode(exitValidation, fmt.Errorf("usage: shout schedule show <id>"))
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		queued, err := findScheduled(store, args[1])
+		if err != nil {
+			return err
+		}
+		showScheduled(queued)
+		return nil
+
+	case "cancel":
+		if len(args) < 2 {
+			return withExitCode(exitValidation, fmt.Errorf("usage: shout schedule cancel <id>"))
+		}
+		store, err := openStore()
+		if err != nil {
+			return err
+		}
+		defer store.Close()
+
+		queued, err := findScheduled(store, args[1])
+		if err != nil {
+			return err
+		}
+		if err := store.Dequeue(queued.ID); err != nil {
+			return fmt.Errorf("failed to cancel the post: %w", err)
+		}
+		infof("Cancelled the %s post scheduled for %s\n", serviceNames[queued.Service], queued.NotBefore.Local().Format("2006-01-02 15:04"))
+		return nil
+
+	case "edit":
+		return editScheduled(args[1:])
+
+	default:
+		fmt.Println("Usage: shout schedule [list|show <id>|cancel <id>|edit <id> [--at <time> [--tz <zone>]] [--text <text>]]")
+		os.Exit(1)
+	}
+	return nil
+}
+
+// editScheduled moves a scheduled post to another time or replaces its text
+func editScheduled(args []string) error {
+	fs := flag.NewFlagSet("schedule edit", flag.ExitOnError)
+	when := newAtFlags(fs)
+	text := fs.String("text", "", "new text for the post, replacing all of it, including any signature")
+	positional := parseFlags(fs, args)
+	if len(positional) != 1 || (when.at == "" && *text == "") {
+		fmt.Println("Usage: shout schedule edit <id> [--at <time> [--tz <zone>]] [--text <text>]")
+		os.Exit(1)
+	}
+
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	queued, err := findScheduled(store, positional[0])
+	if err != nil {
+		return err
+	}
+
+	at, err := when.time()
+	if err != nil {
+		return err
+	}
+	if !at.IsZero() {
+		queued.NotBefore = at
+	}
+
+	if *text != "" {
+		if len(queued.Posts) > 1 {
+			return withExitCode(exitValidation, fmt.Errorf("--text can't replace the text of a thread, cancel it and schedule it again instead"))
+		}
+		if len(queued.Posts) == 0 {
+			queued.Posts = []*Post{{}}
+		}
+		queued.Posts[0].Text = *text
+		if err := checkThread(queued.Service, queued.Posts); err != nil {
+			return err
+		}
+		queued.Text = *text
+	}
+
+	if err := store.UpdateQueued(queued); err != nil {
+		return fmt.Errorf("failed to update the post: %w", err)
+	}
+	infof("The %s post is scheduled for %s\n", serviceNames[queued.Service], queued.NotBefore.Local().Format("2006-01-02 15:04"))
+	return nil
+}
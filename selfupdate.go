@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The GitHub API endpoint of shout's latest release
+var latestReleaseURL = "https://api.github.com/repos/punkscience/shout/releases/latest"
+
+// githubRelease is the subset of a GitHub release that self-update uses
+type githubRelease struct {
+	TagName string `json:"tag_name"`
+	HTMLURL string `json:"html_url"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// assetURL returns the download URL of the release's asset called name
+func (r *githubRelease) assetURL(name string) string {
+	for _, asset := range r.Assets {
+		if asset.Name == name {
+			return asset.URL
+		}
+	}
+	return ""
+}
+
+// releaseAssetName is the name of the binary for this platform, like shout_linux_amd64
+func releaseAssetName() string {
+	name := "shout_" + runtime.GOOS + "_" + runtime.GOARCH
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+// compareVersions compares two versions like 1.4.0 or v1.10.2-rc1 by their
+// numbers, returning -1, 0, or 1. A pre-release sorts before its release.
+func compareVersions(a, b string) int {
+	a, preA, _ := strings.Cut(strings.TrimPrefix(a, "v"), "-")
+	b, preB, _ := strings.Cut(strings.TrimPrefix(b, "v"), "-")
+	partsA, partsB := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var x, y int
+		if i < len(partsA) {
+			x, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			y, _ = strconv.Atoi(partsB[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	case preA < preB:
+		return -1
+	}
+	return 1
+}
+
+// download fetches a release asset, up to limit bytes
+func download(client *http.Client, assetURL string, limit int64) ([]byte, error) {
+	resp, err := client.Get(assetURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// releaseChecksum finds a file's SHA-256 in a checksums.txt, written by
+// sha256sum as "<hex>  <name>" lines
+func releaseChecksum(checksums []byte, name string) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return strings.ToLower(fields[0]), true
+		}
+	}
+	return "", false
+}
+
+// replaceExecutable swaps the running binary for data. The new file is
+// written next to it first, so a failure leaves the old one in place.
+func replaceExecutable(data []byte) (string, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the running binary: %w", err)
+	}
+	if executable, err = filepath.EvalSymlinks(executable); err != nil {
+		return "", fmt.Errorf("failed to find the running binary: %w", err)
+	}
+
+	info, err := os.Stat(executable)
+	if err != nil {
+		return "", err
+	}
+	next := executable + ".new"
+	if err := os.WriteFile(next, data, info.Mode().Perm()|0100); err != nil {
+		return "", fmt.Errorf("failed to write the new binary next to %s: %w", executable, err)
+	}
+
+	// Windows can't replace a running binary, but it can rename it out of the way
+	old := executable + ".old"
+	if runtime.GOOS == "windows" {
+		os.Remove(old)
+		if err := os.Rename(executable, old); err != nil {
+			os.Remove(next)
+			return "", fmt.Errorf("failed to move the running binary aside: %w", err)
+		}
+	}
+	if err := os.Rename(next, executable); err != nil {
+		os.Remove(next)
+		if runtime.GOOS == "windows" {
+			os.Rename(old, executable)
+		}
+		return "", fmt.Errorf("failed to replace %s: %w", executable, err)
+	}
+	return executable, nil
+}
+
+// selfUpdateCommand replaces the running binary with the latest release
+// when that's newer, after checking it against the release's checksums
+func selfUpdateCommand(args []string) error {
+	fs := flag.NewFlagSet("self-update", flag.ExitOnError)
+	check := fs.Bool("check", false, "only report whether a newer release is out")
+	force := fs.Bool("force", false, "install the latest release even if it isn't newer")
+	parseFlags(fs, args)
+
+	client := &http.Client{Timeout: 5 * time.Minute}
+	req, err := http.NewRequest("GET", latestReleaseURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to check for a new release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("failed to check for a new release: %w", &statusError{Action: "GET latest release", Status: resp.StatusCode, Body: string(body)})
+	}
+	var release githubRelease
+	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
+		return fmt.Errorf("failed to decode release: %w", err)
+	}
+
+	current, latest := readBuildDetails().Version, strings.TrimPrefix(release.TagName, "v")
+	if compareVersions(latest, current) <= 0 && !*force {
+		fmt.Printf("shout %s is up to date (the latest release is %s)\n", current, latest)
+		return nil
+	}
+	if *check {
+		fmt.Printf("shout %s is out, you have %s: %s\n", latest, current, release.HTMLURL)
+		return nil
+	}
+
+	name := releaseAssetName()
+	binaryURL, checksumsURL := release.assetURL(name), release.assetURL("checksums.txt")
+	if binaryURL == "" {
+		return fmt.Errorf("release %s has no binary for %s/%s (%s), see %s", latest, runtime.GOOS, runtime.GOARCH, name, release.HTMLURL)
+	}
+	if checksumsURL == "" {
+		return fmt.Errorf("release %s has no checksums.txt to check the binary against, so it isn't installed", latest)
+	}
+
+	checksums, err := download(client, checksumsURL, 1<<20)
+	if err != nil {
+		return fmt.Errorf("failed to download checksums.txt: %w", err)
+	}
+	want, ok := releaseChecksum(checksums, name)
+	if !ok {
+		return fmt.Errorf("checksums.txt of release %s has no checksum for %s, so it isn't installed", latest, name)
+	}
+
+	infof("Downloading shout %s...\n", latest)
+	binary, err := download(client, binaryURL, 200<<20)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	sum := sha256.Sum256(binary)
+	if got := hex.EncodeToString(sum[:]); got != want {
+		return fmt.Errorf("the downloaded %s doesn't match its checksum (got %s, expected %s), so it isn't installed", name, got, want)
+	}
+
+	path, err := replaceExecutable(binary)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated %s from %s to %s\n", path, current, latest)
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Largest request body the webhook endpoint will accept (images are base64-encoded)
+const maxWebhookBodySize = 16 << 20
+
+// webhookRequest is the JSON body accepted by the webhook endpoint
+type webhookRequest struct {
+	Text    string  `json:"text"`
+	Service string  `json:"service"`
+	Images  []Image `json:"images"`
+}
+
+// webhookHandler publishes posts submitted over HTTP using the stored sessions
+type webhookHandler struct {
+	token string
+	mu    sync.Mutex
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid or missing token"})
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxWebhookBodySize)).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	if strings.TrimSpace(req.Text) == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "text is required"})
+		return
+	}
+
+	if req.Service == "" {
+		req.Service = "bluesky"
+	}
+
+	// Plugins are registered on first use, and posting refreshes and saves
+	// tokens, so only handle one post at a time
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := serviceNames[req.Service]; !ok && !registerPlugin(req.Service) {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("unknown service: %s", req.Service)})
+		return
+	}
+
+	post, err := applyConfigDefaults(req.Service, Post{Text: req.Text, Images: req.Images})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := checkLengthFor(req.Service, post.Text); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	if err := checkImageCount(req.Service, len(req.Images)); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		return
+	}
+
+	result, err := publish(req.Service, post)
+	if err != nil {
+		errorf("failed to publish webhook post: %v\n", err)
+		writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "posted", "uri": result.URI, "url": result.URL})
+}
+
+// authorized checks the request's bearer token against the configured secret
+func (h *webhookHandler) authorized(r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(h.token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serve runs the webhook listener until the server fails
+func serve(args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", ":8080", "address to listen on")
+	token := fs.String("token", "", "shared secret callers must send as 'Authorization: Bearer <token>'")
+	withMetrics := fs.Bool("metrics", false, "also serve Prometheus metrics at GET /metrics, without a token")
+	fs.Parse(args)
+
+	if *token == "" {
+		return fmt.Errorf("a --token is required so that only trusted callers can post")
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /post", &webhookHandler{token: *token})
+	mux.HandleFunc("GET /healthz", healthHandler)
+	if *withMetrics {
+		enableMetrics()
+		mux.HandleFunc("GET /metrics", metricsHandler)
+	}
+
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		// Stop taking requests on Ctrl-C. Ctrl-C cancels the requests of posts
+		// being published too, so they're answered with an error before it closes.
+		<-rootCtx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), interruptGracePeriod)
+		defer cancel()
+		server.Shutdown(ctx)
+	}()
+
+	acknowledgeReloads()
+	infof("Listening for posts on %s\n", *listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/BurntSushi/toml"
+)
+
+// settingsFileName is the hand-edited settings file, kept apart from the
+// sessions and tokens that shout writes to config.json
+const settingsFileName = "config.toml"
+
+// settingsFile holds the user-authored parts of Config
+type settingsFile struct {
+	AI              AIConfig                    `toml:"ai"`
+	Defaults        map[string]ServiceDefaults  `toml:"defaults"`
+	Credentials     map[string]CredentialSource `toml:"credentials"`
+	Hooks           Hooks                       `toml:"hooks"`
+	DuplicateWindow string                      `toml:"duplicate_window"`
+	Notifications   bool                        `toml:"notifications"`
+	ConfirmPosts    bool                        `toml:"confirm_posts"`
+	Schedules       []Schedule                  `toml:"schedules"`
+	Feeds           []Feed                      `toml:"feeds"`
+	AutoReply       AutoReplyConfig             `toml:"auto_reply"`
+	PostsPerHour    int                         `toml:"posts_per_hour"`
+	Log             LogConfig                   `toml:"log"`
+	DefaultService  string                      `toml:"default_service"`
+	DefaultAccount  string                      `toml:"default_account"`
+	Aliases         map[string]string           `toml:"aliases"`
+}
+
+// loadSettingsFile reads config.toml from the config directory. It returns
+// nil if there is none, and the keys it didn't recognise.
+func loadSettingsFile(configDir string) (*settingsFile, *toml.MetaData, []string, error) {
+	path := filepath.Join(configDir, settingsFileName)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil, nil, nil
+	}
+
+	var settings settingsFile
+	md, err := toml.DecodeFile(path, &settings)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var unknown []string
+	for _, key := range md.Undecoded() {
+		unknown = append(unknown, key.String())
+	}
+	return &settings, &md, unknown, nil
+}
+
+// applyTo overrides config with every setting that config.toml defines
+func (s *settingsFile) applyTo(config *Config, md *toml.MetaData) {
+	if md.IsDefined("ai", "endpoint") {
+		config.AI.Endpoint = s.AI.Endpoint
+	}
+	if md.IsDefined("ai", "api_key") {
+		config.AI.APIKey = s.AI.APIKey
+	}
+	if md.IsDefined("ai", "model") {
+		config.AI.Model = s.AI.Model
+	}
+	if md.IsDefined("defaults") {
+		config.Defaults = s.Defaults
+	}
+	if md.IsDefined("credentials") {
+		config.Credentials = s.Credentials
+	}
+	if md.IsDefined("hooks", "pre_post") {
+		config.Hooks.PrePost = s.Hooks.PrePost
+	}
+	if md.IsDefined("hooks", "post_success") {
+		config.Hooks.PostSuccess = s.Hooks.PostSuccess
+	}
+	if md.IsDefined("hooks", "webhook") {
+		config.Hooks.Webhook = s.Hooks.Webhook
+	}
+	if md.IsDefined("hooks", "webhook_secret") {
+		config.Hooks.WebhookSecret = s.Hooks.WebhookSecret
+	}
+	if md.IsDefined("duplicate_window") {
+		config.DuplicateWindow = s.DuplicateWindow
+	}
+	if md.IsDefined("notifications") {
+		config.Notifications = s.Notifications
+	}
+	if md.IsDefined("confirm_posts") {
+		config.ConfirmPosts = s.ConfirmPosts
+	}
+	if md.IsDefined("schedules") {
+		config.Schedules = s.Schedules
+	}
+	if md.IsDefined("feeds") {
+		config.Feeds = s.Feeds
+	}
+	if md.IsDefined("auto_reply") {
+		config.AutoReply = s.AutoReply
+	}
+	if md.IsDefined("posts_per_hour") {
+		config.PostsPerHour = s.PostsPerHour
+	}
+	if md.IsDefined("log", "path") {
+		config.Log.Path = s.Log.Path
+	}
+	if md.IsDefined("log", "level") {
+		config.Log.Level = s.Log.Level
+	}
+	if md.IsDefined("log", "format") {
+		config.Log.Format = s.Log.Format
+	}
+	if md.IsDefined("log", "max_size_mb") {
+		config.Log.MaxSizeMB = s.Log.MaxSizeMB
+	}
+	if md.IsDefined("log", "max_files") {
+		config.Log.MaxFiles = s.Log.MaxFiles
+	}
+	if md.IsDefined("default_service") {
+		config.DefaultService = s.DefaultService
+	}
+	if md.IsDefined("default_account") {
+		config.DefaultAccount = s.DefaultAccount
+	}
+	if md.IsDefined("aliases") {
+		config.Aliases = s.Aliases
+	}
+}
+
+// withoutSettings returns a copy of config without the settings that
+// config.toml defines, so saving doesn't copy them into config.json
+func withoutSettings(config Config, md *toml.MetaData) Config {
+	if md.IsDefined("ai", "endpoint") {
+		config.AI.Endpoint = ""
+	}
+	if md.IsDefined("ai", "api_key") {
+		config.AI.APIKey = ""
+	}
+	if md.IsDefined("ai", "model") {
+		config.AI.Model = ""
+	}
+	if md.IsDefined("defaults") {
+		config.Defaults = nil
+	}
+	if md.IsDefined("credentials") {
+		config.Credentials = nil
+	}
+	if md.IsDefined("hooks", "pre_post") {
+		config.Hooks.PrePost = ""
+	}
+	if md.IsDefined("hooks", "post_success") {
+		config.Hooks.PostSuccess = ""
+	}
+	if md.IsDefined("hooks", "webhook") {
+		config.Hooks.Webhook = ""
+	}
+	if md.IsDefined("hooks", "webhook_secret") {
+		config.Hooks.WebhookSecret = ""
+	}
+	if md.IsDefined("duplicate_window") {
+		config.DuplicateWindow = ""
+	}
+	if md.IsDefined("notifications") {
+		config.Notifications = false
+	}
+	if md.IsDefined("confirm_posts") {
+		config.ConfirmPosts = false
+	}
+	if md.IsDefined("schedules") {
+		config.Schedules = nil
+	}
+	if md.IsDefined("feeds") {
+		config.Feeds = nil
+	}
+	if md.IsDefined("auto_reply") {
+		config.AutoReply = AutoReplyConfig{}
+	}
+	if md.IsDefined("posts_per_hour") {
+		config.PostsPerHour = 0
+	}
+	if md.IsDefined("log", "path") {
+		config.Log.Path = ""
+	}
+	if md.IsDefined("log", "level") {
+		config.Log.Level = ""
+	}
+	if md.IsDefined("log", "format") {
+		config.Log.Format = ""
+	}
+	if md.IsDefined("log", "max_size_mb") {
+		config.Log.MaxSizeMB = 0
+	}
+	if md.IsDefined("log", "max_files") {
+		config.Log.MaxFiles = 0
+	}
+	if md.IsDefined("default_service") {
+		config.DefaultService = ""
+	}
+	if md.IsDefined("default_account") {
+		config.DefaultAccount = ""
+	}
+	if md.IsDefined("aliases") {
+		config.Aliases = nil
+	}
+	return config
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// blueskyPostView is the subset of app.bsky.feed.defs#postView that shout uses
+type blueskyPostView struct {
+	URI    string `json:"uri"`
+	CID    string `json:"cid"`
+	Author struct {
+		Did    string `json:"did"`
+		Handle string `json:"handle"`
+	} `json:"author"`
+	Record struct {
+		Text      string    `json:"text"`
+		CreatedAt time.Time `json:"createdAt"`
+	} `json:"record"`
+	ReplyCount  int `json:"replyCount"`
+	RepostCount int `json:"repostCount"`
+	LikeCount   int `json:"likeCount"`
+	QuoteCount  int `json:"quoteCount"`
+}
+
+// getPosts fetches post views for the given at:// URIs
+func getPosts(config *Config, uris []string) ([]blueskyPostView, error) {
+	var result struct {
+		Posts []blueskyPostView `json:"posts"`
+	}
+	if err := blueskyGet(config, "app.bsky.feed.getPosts", url.Values{"uris": uris}, &result); err != nil {
+		return nil, err
+	}
+	return result.Posts, nil
+}
+
+// getAuthorPosts fetches up to limit of the most recent posts by actor,
+// leaving out replies unless withReplies is set
+func getAuthorPosts(config *Config, actor string, limit int, withReplies bool) ([]blueskyPostView, error) {
+	filter := "posts_no_replies"
+	if withReplies {
+		filter = "posts_with_replies"
+	}
+
+	var posts []blueskyPostView
+	cursor := ""
+	for len(posts) < limit {
+		var result struct {
+			Feed []struct {
+				Post blueskyPostView `json:"post"`
+			} `json:"feed"`
+			Cursor string `json:"cursor"`
+		}
+		params := url.Values{
+			"actor":  {actor},
+			"limit":  {strconv.Itoa(min(limit-len(posts), 100))},
+			"filter": {filter},
+		}
+		if cursor != "" {
+			params.Set("cursor", cursor)
+		}
+		if err := blueskyGet(config, "app.bsky.feed.getAuthorFeed", params, &result); err != nil {
+			return nil, err
+		}
+
+		for _, item := range result.Feed {
+			// Skip reposts of other people's posts
+			if item.Post.Author.Did == actor && len(posts) < limit {
+				posts = append(posts, item.Post)
+			}
+		}
+		if result.Cursor == "" || len(result.Feed) == 0 {
+			break
+		}
+		cursor = result.Cursor
+	}
+	return posts, nil
+}
+
+// truncateText shortens text to at most n characters on a single line
+func truncateText(text string, n int) string {
+	runes := []rune(strings.Join(strings.Fields(text), " "))
+	if len(runes) <= n {
+		return string(runes)
+	}
+	return string(runes[:n-1]) + "…"
+}
+
+func printPostStats(posts []blueskyPostView) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POSTED\tLIKES\tREPOSTS\tREPLIES\tQUOTES\tTEXT")
+
+	var likes, reposts, replies, quotes int
+	for _, post := range posts {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%s\n",
+			post.Record.CreatedAt.Local().Format("2006-01-02 15:04"),
+			post.LikeCount, post.RepostCount, post.ReplyCount, post.QuoteCount,
+			truncateText(post.Record.Text, 50))
+		likes += post.LikeCount
+		reposts += post.RepostCount
+		replies += post.ReplyCount
+		quotes += post.QuoteCount
+	}
+
+	if len(posts) > 1 {
+		fmt.Fprintf(w, "TOTAL\t%d\t%d\t%d\t%d\t%d posts\n", likes, reposts, replies, quotes, len(posts))
+	}
+	w.Flush()
+}
+
+func postsCommand(args []string) error {
+	fs := flag.NewFlagSet("posts", flag.ExitOnError)
+	limit := fs.Int("limit", 20, "number of recent posts to list")
+	withReplies := fs.Bool("replies", false, "include your replies")
+	parseFlags(fs, args)
+
+	if *limit < 1 {
+		return fmt.Errorf("--limit must be at least 1")
+	}
+
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+	posts, err := getAuthorPosts(config, config.BlueskySession.Did, *limit, *withReplies)
+	if err != nil {
+		return err
+	}
+
+	// In quiet mode only the URIs are printed, for scripts
+	if quiet {
+		for _, post := range posts {
+			fmt.Println(post.URI)
+		}
+		return nil
+	}
+
+	if len(posts) == 0 {
+		fmt.Println("No posts found.")
+		return nil
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "POSTED\tURI\tTEXT")
+	for _, post := range posts {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", post.Record.CreatedAt.Local().Format("2006-01-02 15:04"), post.URI, truncateText(post.Record.Text, 50))
+	}
+	w.Flush()
+	return nil
+}
+
+func statsCommand(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	recent := fs.Int("recent", 10, "number of recent posts to summarize when no post URL is given")
+	positional := parseFlags(fs, args)
+
+	config, err := loadBlueskySession()
+	if err != nil {
+		return err
+	}
+
+	var posts []blueskyPostView
+	if len(positional) > 0 {
+		var uris []string
+		for _, ref := range positional {
+			uri, err := postURIFromReference(config, ref)
+			if err != nil {
+				return err
+			}
+			uris = append(uris, uri)
+		}
+		if posts, err = getPosts(config, uris); err != nil {
+			return err
+		}
+	} else {
+		if *recent < 1 || *recent > 100 {
+			return fmt.Errorf("--recent must be between 1 and 100")
+		}
+		if posts, err = getAuthorPosts(config, config.BlueskySession.Did, *recent, false); err != nil {
+			return err
+		}
+	}
+
+	if len(posts) == 0 {
+		fmt.Println("No posts found.")
+		return nil
+	}
+
+	printPostStats(posts)
+	return nil
+}
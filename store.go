@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Name of the database file kept next to config.json
+const storeFileName = "shout.db"
+
+var (
+	metaBucket    = []byte("meta")
+	queueBucket   = []byte("queue")
+	draftsBucket  = []byte("drafts")
+	historyBucket = []byte("history")
+	rateBucket    = []byte("rate_limits")
+	uploadsBucket = []byte("uploads")
+	importsBucket = []byte("imports")
+	runsBucket    = []byte("schedule_runs")
+	repliesBucket = []byte("auto_replies")
+
+	schemaVersionKey = []byte("schema_version")
+)
+
+// migrations upgrade the database layout one step at a time. The schema
+// version stored in the meta bucket is the number of migrations applied, so
+// new migrations must only ever be appended to this list.
+var migrations = []func(tx *bolt.Tx) error{
+	// 1: initial layout
+	func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{queueBucket, draftsBucket, historyBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	},
+	// 2: local rate limit buckets
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(rateBucket)
+		return err
+	},
+	// 3: uploads reused when a post is retried, dropped again in 7
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(uploadsBucket)
+		return err
+	},
+	// 4: posts imported from other services
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(importsBucket)
+		return err
+	},
+	// 5: runs of the daemon's schedules
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(runsBucket)
+		return err
+	},
+	// 6: where auto-replies last read each service's notifications
+	func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(repliesBucket)
+		return err
+	},
+	// 7: uploads are no longer reused
+	func(tx *bolt.Tx) error {
+		err := tx.DeleteBucket(uploadsBucket)
+		if errors.Is(err, bolt.ErrBucketNotFound) {
+			return nil
+		}
+		return err
+	},
+}
+
+// Store is the local database holding the post queue, drafts, and history
+type Store struct {
+	db *bolt.DB
+}
+
+// QueuedPost is a post waiting to be delivered
+type QueuedPost struct {
+	ID        uint64    `json:"id"`
+	Service   string    `json:"service"`
+	Text      string    `json:"text"`
+	Posts     []*Post   `json:"posts,omitempty"` // the post, or the thread, with its settings and images
+	CreatedAt time.Time `json:"created_at"`
+
+	// NotBefore holds back a scheduled post until that time; zero means as soon as possible
+	NotBefore time.Time `json:"not_before"`
+
+	// Error is why the service rejected the post. Flushes skip it until it's retried.
+	Error string `json:"error,omitempty"`
+}
+
+// Draft is a saved, unpublished message
+type Draft struct {
+	ID        uint64    `json:"id"`
+	Text      string    `json:"text"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// HistoryEntry records a post that was successfully published
+type HistoryEntry struct {
+	ID       uint64    `json:"id"`
+	Service  string    `json:"service"`
+	Text     string    `json:"text"`
+	PostedAt time.Time `json:"posted_at"`
+
+	// Post identifies the published post; entries from older versions have none
+	Post *PostResult `json:"post,omitempty"`
+}
+
+// ScheduleRun records a time one of the daemon's schedules was due, and
+// whether it ran
+type ScheduleRun struct {
+	ID       uint64    `json:"id"`
+	Schedule string    `json:"schedule"`
+	Cron     string    `json:"cron"`
+	Due      time.Time `json:"due"`
+
+	// RanAt is zero for a run that was missed because the daemon wasn't running
+	RanAt time.Time `json:"ran_at,omitempty"`
+	Error string    `json:"error,omitempty"`
+}
+
+// ImportedPost records a post imported from another service, such as a tweet
+type ImportedPost struct {
+	Post *PostResult `json:"post"`
+	Root *PostResult `json:"root,omitempty"` // the first post of the thread, for replies
+}
+
+// openStore opens (creating if needed) the database and applies any pending migrations
+func openStore() (*Store, error) {
+	dir, err := storeDir()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(dir, storeFileName), 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store: %w", err)
+	}
+
+	store := &Store{db: db}
+	if err := store.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// Close releases the database file
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+func (s *Store) migrate() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return fmt.Errorf("failed to create meta bucket: %w", err)
+		}
+
+		version := 0
+		if v := meta.Get(schemaVersionKey); v != nil {
+			version = int(binary.BigEndian.Uint64(v))
+		}
+
+		if version > len(migrations) {
+			return fmt.Errorf("store schema version %d is newer than this version of shout supports (%d)", version, len(migrations))
+		}
+
+		for i := version; i < len(migrations); i++ {
+			if err := migrations[i](tx); err != nil {
+				return fmt.Errorf("store migration %d failed: %w", i+1, err)
+			}
+		}
+
+		return meta.Put(schemaVersionKey, itob(uint64(len(migrations))))
+	})
+}
+
+// itob encodes an ID as a big-endian key so that buckets iterate in insertion order
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+// put assigns the next sequence ID via setID and stores the JSON-encoded value
+func put(tx *bolt.Tx, bucket []byte, setID func(uint64), value interface{}) error {
+	b := tx.Bucket(bucket)
+	id, err := b.NextSequence()
+	if err != nil {
+		return err
+	}
+	setID(id)
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return b.Put(itob(id), data)
+}
+
+// Enqueue adds a post to the end of the queue
+func (s *Store) Enqueue(post *QueuedPost) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, queueBucket, func(id uint64) { post.ID = id }, post)
+	})
+}
+
+// Queue returns all queued posts, oldest first
+func (s *Store) Queue() ([]QueuedPost, error) {
+	var posts []QueuedPost
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).ForEach(func(_, v []byte) error {
+			var post QueuedPost
+			if err := json.Unmarshal(v, &post); err != nil {
+				return err
+			}
+			posts = append(posts, post)
+			return nil
+		})
+	})
+	return posts, err
+}
+
+// Queued returns the queued post with the given ID, or nil if there is none
+func (s *Store) Queued(id uint64) (*QueuedPost, error) {
+	var post *QueuedPost
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(queueBucket).Get(itob(id))
+		if data == nil {
+			return nil
+		}
+		post = &QueuedPost{}
+		return json.Unmarshal(data, post)
+	})
+	return post, err
+}
+
+// UpdateQueued replaces a queued post, keeping its place in the queue
+func (s *Store) UpdateQueued(post *QueuedPost) error {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Put(itob(post.ID), data)
+	})
+}
+
+// Dequeue removes a post from the queue
+func (s *Store) Dequeue(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(queueBucket).Delete(itob(id))
+	})
+}
+
+// SaveDraft stores a new draft
+func (s *Store) SaveDraft(draft *Draft) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, draftsBucket, func(id uint64) { draft.ID = id }, draft)
+	})
+}
+
+// Drafts returns all saved drafts, oldest first
+func (s *Store) Drafts() ([]Draft, error) {
+	var drafts []Draft
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(draftsBucket).ForEach(func(_, v []byte) error {
+			var draft Draft
+			if err := json.Unmarshal(v, &draft); err != nil {
+				return err
+			}
+			drafts = append(drafts, draft)
+			return nil
+		})
+	})
+	return drafts, err
+}
+
+// Draft returns the draft with the given ID, or nil if there is none
+func (s *Store) Draft(id uint64) (*Draft, error) {
+	var draft *Draft
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(draftsBucket).Get(itob(id))
+		if data == nil {
+			return nil
+		}
+		draft = &Draft{}
+		return json.Unmarshal(data, draft)
+	})
+	return draft, err
+}
+
+// DeleteDraft removes a draft
+func (s *Store) DeleteDraft(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(draftsBucket).Delete(itob(id))
+	})
+}
+
+// AddHistory records a published post
+func (s *Store) AddHistory(entry *HistoryEntry) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, historyBucket, func(id uint64) { entry.ID = id }, entry)
+	})
+}
+
+// RecentHistory returns up to limit of the most recent history entries, newest first
+func (s *Store) RecentHistory(limit int) ([]HistoryEntry, error) {
+	var entries []HistoryEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(entries) < limit; k, v = c.Prev() {
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			entries = append(entries, entry)
+		}
+		return nil
+	})
+	return entries, err
+}
+
+// DeleteHistory removes a history entry, such as for a post that was deleted
+func (s *Store) DeleteHistory(id uint64) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(historyBucket).Delete(itob(id))
+	})
+}
+
+// AddRun records a schedule's run, or a run it missed
+func (s *Store) AddRun(run *ScheduleRun) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return put(tx, runsBucket, func(id uint64) { run.ID = id }, run)
+	})
+}
+
+// RecentRuns returns up to limit of the most recent schedule runs that keep
+// accepts, newest first
+func (s *Store) RecentRuns(limit int, keep func(ScheduleRun) bool) ([]ScheduleRun, error) {
+	var runs []ScheduleRun
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil && len(runs) < limit; k, v = c.Prev() {
+			var run ScheduleRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if keep(run) {
+				runs = append(runs, run)
+			}
+		}
+		return nil
+	})
+	return runs, err
+}
+
+// LastRun returns the newest run recorded for a schedule, or nil if there is none
+func (s *Store) LastRun(schedule string) (*ScheduleRun, error) {
+	var found *ScheduleRun
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(runsBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var run ScheduleRun
+			if err := json.Unmarshal(v, &run); err != nil {
+				return err
+			}
+			if run.Schedule == schedule {
+				found = &run
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// FindRecent returns the newest history entry for service with the given text
+// that was posted after since, or nil if there is none
+func (s *Store) FindRecent(service, text string, since time.Time) (*HistoryEntry, error) {
+	var found *HistoryEntry
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(historyBucket).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var entry HistoryEntry
+			if err := json.Unmarshal(v, &entry); err != nil {
+				return err
+			}
+			if entry.PostedAt.Before(since) {
+				return nil
+			}
+			if entry.Service == service && entry.Text == text {
+				found = &entry
+				return nil
+			}
+		}
+		return nil
+	})
+	return found, err
+}
+
+// TakeToken takes one post from the service's token bucket, which holds up to
+// perHour tokens and refills at perHour tokens an hour. If the bucket is empty
+// it returns how long until the next token, and takes nothing.
+func (s *Store) TakeToken(service string, perHour int, now time.Time) (wait time.Duration, err error) {
+	err = s.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(rateBucket)
+
+		// A bucket seen for the first time starts full
+		state := rateLimitState{Tokens: float64(perHour), UpdatedAt: now}
+		if v := b.Get([]byte(service)); v != nil {
+			if err := json.Unmarshal(v, &state); err != nil {
+				return err
+			}
+		}
+
+		state.refill(perHour, now)
+		if state.Tokens < 1 {
+			wait = time.Duration((1 - state.Tokens) / float64(perHour) * float64(time.Hour))
+			return nil
+		}
+		state.Tokens--
+
+		data, err := json.Marshal(state)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(service), data)
+	})
+	return wait, err
+}
+
+// ImportedPosts returns the posts imported from source, keyed by their ID there
+func (s *Store) ImportedPosts(source string) (map[string]ImportedPost, error) {
+	posts := make(map[string]ImportedPost)
+	prefix := []byte(source + ":")
+	err := s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(importsBucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var post ImportedPost
+			if err := json.Unmarshal(v, &post); err != nil {
+				return err
+			}
+			posts[string(k[len(prefix):])] = post
+		}
+		return nil
+	})
+	return posts, err
+}
+
+// SaveImported records that the post with the given ID on source was imported
+func (s *Store) SaveImported(source, id string, post ImportedPost) error {
+	data, err := json.Marshal(post)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(importsBucket).Put([]byte(source+":"+id), data)
+	})
+}
+
+// AutoReplyCursor returns where auto-replies last read the service's
+// notifications, or "" if they never have
+func (s *Store) AutoReplyCursor(service string) (string, error) {
+	var cursor string
+	err := s.db.View(func(tx *bolt.Tx) error {
+		cursor = string(tx.Bucket(repliesBucket).Get([]byte(service)))
+		return nil
+	})
+	return cursor, err
+}
+
+// SetAutoReplyCursor records where auto-replies last read the service's notifications
+func (s *Store) SetAutoReplyCursor(service, cursor string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(repliesBucket).Put([]byte(service), []byte(cursor))
+	})
+}
+
+// recordHistory opens the store and appends a history entry for a published post
+func recordHistory(service, text string, result *PostResult) error {
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	return store.AddHistory(&HistoryEntry{
+		Service:  service,
+		Text:     text,
+		PostedAt: time.Now(),
+		Post:     result,
+	})
+}
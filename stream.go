@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// stream posts each nonempty line read from stdin, waiting at least the
+// configured interval between posts
+func stream(args []string) error {
+	fs := flag.NewFlagSet("stream", flag.ExitOnError)
+	service := fs.String("service", "bluesky", "service to post to")
+	interval := fs.Duration("interval", 30*time.Second, "minimum time between posts")
+	fs.Parse(args)
+
+	return streamLines(os.Stdin, *service, *interval)
+}
+
+func streamLines(r io.Reader, service string, interval time.Duration) error {
+	if _, ok := serviceNames[service]; !ok && !registerPlugin(service) {
+		return fmt.Errorf("unknown service: %s", service)
+	}
+
+	var lastPost time.Time
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		post, err := applyConfigDefaults(service, Post{Text: line})
+		if err != nil {
+			return err
+		}
+
+		if err := checkLengthFor(service, post.Text); err != nil {
+			fmt.Printf("Skipping line: %v\n", err)
+			continue
+		}
+
+		if wait := time.Until(lastPost.Add(interval)); wait > 0 {
+			time.Sleep(wait)
+		}
+
+		lastPost = time.Now()
+		if _, err := publish(service, post); err != nil {
+			fmt.Printf("Error posting line: %v\n", err)
+			notify("shout: streamed post failed", fmt.Sprintf("%s: %v", serviceNames[service], err))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	return nil
+}
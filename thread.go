@@ -0,0 +1,357 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// markdownImagePattern matches ![alt](path) image references in a post or thread file
+var markdownImagePattern = regexp.MustCompile(`!\[([^\]]*)\]\(([^)\s]+)\)`)
+
+// blankLinesPattern matches the extra blank lines left where images were removed
+var blankLinesPattern = regexp.MustCompile(`\n[ \t]*\n(?:[ \t]*\n)+`)
+
+// extractMarkdownImages reads the local images written as ![alt](path) in
+// text, with relative paths relative to dir, and returns the text without
+// them. Images on the web are left in the text as they are.
+func extractMarkdownImages(text, dir string) (string, []Image, error) {
+	var images []Image
+	var readErr error
+	stripped := markdownImagePattern.ReplaceAllStringFunc(text, func(ref string) string {
+		match := markdownImagePattern.FindStringSubmatch(ref)
+		imagePath := match[2]
+		if strings.Contains(imagePath, "://") || readErr != nil {
+			return ref
+		}
+		if unescaped, err := url.PathUnescape(imagePath); err == nil {
+			imagePath = unescaped
+		}
+		if !filepath.IsAbs(imagePath) {
+			imagePath = filepath.Join(dir, imagePath)
+		}
+
+		data, err := os.ReadFile(imagePath)
+		if err != nil {
+			readErr = fmt.Errorf("failed to read image: %w", err)
+			return ref
+		}
+		images = append(images, Image{Data: data, Alt: match[1]})
+		return ""
+	})
+	if readErr != nil {
+		return "", nil, readErr
+	}
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(stripped, "\n\n")), images, nil
+}
+
+// parseThreadFile splits a markdown file into posts at lines containing only
+// "---". Images written as ![alt](path) are attached to their post and removed
+// from its text; relative paths are relative to the file. Frontmatter at the
+// top applies to the whole thread, with its images going on the first post.
+func parseThreadFile(path string) (*postMetadata, []Post, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read thread file: %w", err)
+	}
+
+	meta := &postMetadata{}
+	text := string(data)
+	if frontmatter, body, ok := splitFrontmatter(text); ok {
+		// A thread file may also start with a --- separator, so a first post
+		// that isn't frontmatter stays a post
+		parsed, err := parsePostMetadata(frontmatter, filepath.Dir(path))
+		if err == nil && len(parsed.Texts) > 0 {
+			return nil, nil, withExitCode(exitValidation, fmt.Errorf("%s frontmatter: text_<service> variants only work in post files, not threads", path))
+		}
+		if err == nil {
+			meta, text = parsed, body
+		} else if _, yamlErr := parseFrontmatter(frontmatter); yamlErr == nil {
+			return nil, nil, withExitCode(exitValidation, fmt.Errorf("%s frontmatter: %w", path, err))
+		}
+	}
+
+	var segments []string
+	var current []string
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(line) == "---" {
+			segments = append(segments, strings.Join(current, "\n"))
+			current = nil
+			continue
+		}
+		current = append(current, line)
+	}
+	segments = append(segments, strings.Join(current, "\n"))
+
+	var posts []Post
+	for _, segment := range segments {
+		var post Post
+		var err error
+		if post.Text, post.Images, err = extractMarkdownImages(segment, filepath.Dir(path)); err != nil {
+			return nil, nil, fmt.Errorf("post %d: %w", len(posts)+1, err)
+		}
+		if post.Text == "" && len(post.Images) == 0 {
+			continue
+		}
+		posts = append(posts, post)
+	}
+
+	if len(posts) == 0 {
+		return nil, nil, fmt.Errorf("thread file %s has no posts", path)
+	}
+
+	images, err := meta.readImages()
+	if err != nil {
+		return nil, nil, err
+	}
+	posts[0].Images = append(images, posts[0].Images...)
+	return meta, posts, nil
+}
+
+// threadCounter returns the " (i/n)" counter appended to the i-th of n numbered posts
+func threadCounter(i, n int) string {
+	return fmt.Sprintf(" (%d/%d)", i, n)
+}
+
+// numberThread appends a counter to the text of each post. It runs before any
+// length check, so the counters count towards the limits.
+func numberThread(posts []Post) {
+	for i := range posts {
+		posts[i].Text += threadCounter(i+1, len(posts))
+	}
+}
+
+// threadForService applies a service's settings to each post of a thread. The
+// signature only goes on the last post, and reply controls only on the first,
+// since Bluesky applies them to the whole thread.
+func threadForService(posts []Post, settings ServiceDefaults) []*Post {
+	var thread []*Post
+	for i, post := range posts {
+		s := settings
+		if i < len(posts)-1 {
+			s.Signature = ""
+		}
+		if i > 0 {
+			s.ReplyControl = ""
+		}
+		thread = append(thread, postForService(post, s))
+	}
+	return thread
+}
+
+// checkThread checks every post of a thread against the service's limits
+func checkThread(service string, thread []*Post) error {
+	for i, post := range thread {
+		// Mastodon counts a content warning towards the post's length
+		text := post.Text
+		if service == "mastodon" || service == "pixelfed" {
+			text = post.ContentWarning + text
+		}
+		if i > 0 && (service == "ghost" || service == "devto") {
+			return withExitCode(exitValidation, fmt.Errorf("threads aren't supported"))
+		}
+		if err := checkVisibility(service, post); err != nil {
+			if len(thread) > 1 {
+				return fmt.Errorf("post %d: %w", i+1, err)
+			}
+			return err
+		}
+		// The first post of a thread is the Reddit, Lemmy, Pixelfed, Ghost, or dev.to post, the rest its comments
+		if i == 0 && post.ReplyTo == nil {
+			var err error
+			switch service {
+			case "reddit":
+				err = checkRedditPost(post)
+			case "lemmy":
+				err = checkLemmyPost(post)
+			case "pixelfed":
+				err = checkPixelfedPost(post)
+			case "ghost":
+				err = checkGhostPost(post)
+			case "devto":
+				err = checkDevToPost(post)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		err := checkLengthFor(service, text)
+		if err == nil {
+			err = checkImageCount(service, len(post.Images))
+		}
+		if err != nil && len(thread) > 1 {
+			return fmt.Errorf("post %d: %w", i+1, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitPostID splits a result ID like post:12 or comment:34 into its kind
+// and number, for services whose threads continue in comments
+func splitPostID(id string) (kind string, number int, err error) {
+	kind, value, _ := strings.Cut(id, ":")
+	number, err = strconv.Atoi(value)
+	if err != nil || (kind != "post" && kind != "comment") {
+		return "", 0, fmt.Errorf("invalid post ID %q", id)
+	}
+	return kind, number, nil
+}
+
+// publishThread posts each post as a reply to the one before it. If the first
+// post is itself a reply, the rest of the thread stays under the same root.
+func publishThread(service string, thread []*Post) ([]*PostResult, error) {
+	var results []*PostResult
+	for i, post := range thread {
+		if i > 0 {
+			root := thread[0].ThreadRoot
+			if root == nil {
+				root = thread[0].ReplyTo
+			}
+			if root == nil {
+				root = results[0]
+			}
+			post.ReplyTo = results[i-1]
+			post.ThreadRoot = root
+		}
+
+		result, err := publish(service, post)
+		if err != nil && len(thread) > 1 {
+			return results, fmt.Errorf("post %d of %d: %w", i+1, len(thread), err)
+		}
+		if err != nil {
+			return results, err
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func threadCommand(args []string) error {
+	fs := flag.NewFlagSet("thread", flag.ExitOnError)
+	file := fs.String("file", "", "markdown file with the thread's posts separated by --- lines")
+	to := fs.String("to", "", "comma-separated services to post to (bluesky, mastodon, matrix, reddit, lemmy, pixelfed, wordpress, ghost, devto); default_service in the config, or bluesky, if not given")
+	overrides := newPostFlags(fs)
+	warnings := newContentWarningFlags(fs)
+	when := newAtFlags(fs)
+	noResize := fs.Bool("no-resize", false, "upload images as-is instead of shrinking them to fit each service's limits")
+	keepExif := fs.Bool("keep-exif", false, "keep EXIF metadata, including GPS location, in uploaded images")
+	number := fs.Bool("number", false, "append a (1/n) counter to each post")
+	open := fs.Bool("open", false, "open the first post of the thread in the default browser")
+	copyURL := fs.Bool("copy-url", false, "copy the URL of the thread's first post to the clipboard")
+	force := fs.Bool("force", false, "post even if the thread's first post was recently posted to the service")
+	preview := fs.Bool("preview", false, "show how the posts will appear without posting them")
+	parseFlags(fs, args)
+
+	if *file == "" {
+		fmt.Println("Usage: shout thread --file <thread.md> [--number] [--force] [--preview] [--open] [--copy-url] [--to bluesky,mastodon] [--lang <code>] [--visibility <v>] [--signature <text>] [--no-card] [--reply-control <who>] [--cw <text>] [--label <label>]... [--at <time> [--tz <zone>]]")
+		os.Exit(1)
+	}
+
+	meta, posts, err := parseThreadFile(*file)
+	if err != nil {
+		return err
+	}
+	if err := warnings.applyTo(meta); err != nil {
+		return err
+	}
+	at, err := when.time()
+	if err != nil {
+		return err
+	}
+	if !at.IsZero() {
+		meta.At = at
+	}
+	for i := range posts {
+		posts[i].NoResize, posts[i].KeepExif = *noResize, *keepExif
+		posts[i].Labels, posts[i].ContentWarning = meta.Labels, meta.ContentWarning
+	}
+	if *number {
+		numberThread(posts)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	services, err := servicesFor(config, meta.services(*to))
+	if err != nil {
+		return err
+	}
+	meta.warnUnlabelled(services)
+
+	// Check every post for every service before posting anything
+	threads := make(map[string][]*Post)
+	for _, service := range services {
+		settings := overrides.apply(meta.applyTo(config.Defaults[service]))
+		if err := settings.validate(); err != nil {
+			return err
+		}
+
+		thread := threadForService(posts, settings)
+		if err := checkThread(service, thread); err != nil {
+			return fmt.Errorf("%s: %w", serviceNames[service], err)
+		}
+		if !*force && !*preview {
+			if err := checkDuplicate(config, service, thread[0].Text); err != nil {
+				return err
+			}
+		}
+		threads[service] = thread
+	}
+
+	if *preview {
+		previewThreads(services, threads)
+		return nil
+	}
+
+	if meta.At.After(time.Now()) {
+		return schedulePosts(services, threads, meta.At)
+	}
+
+	flushQueueBeforePosting()
+
+	// Post to every service at once; a failure on one doesn't stop the others
+	deliveries := deliverAll(services, threads)
+
+	var copied bool
+	for _, d := range deliveries {
+		if d.Err != nil {
+			continue
+		}
+		if d.Queued {
+			if quiet {
+				fmt.Println("queued")
+			}
+			continue
+		}
+		if *open {
+			openBrowser(d.Results[0].URL)
+		}
+		if *copyURL && !copied {
+			if err := copyToClipboard(d.Results[0].URL); err != nil {
+				warnf("%v\n", err)
+			}
+			copied = true
+		}
+		if quiet {
+			fmt.Println(d.Results[0].URL)
+			continue
+		}
+		fmt.Printf("Posted a thread of %d posts to %s: %s\n", len(d.Results), serviceNames[d.Service], d.Results[0].URL)
+	}
+
+	if len(deliveries) > 1 && !quiet {
+		printDeliverySummary(deliveries)
+	}
+	return deliveryErrors(deliveries)
+}
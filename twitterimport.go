@@ -0,0 +1,291 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"html"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// tweetFilePattern matches the files of a Twitter archive that hold tweets;
+// big archives split them into tweets.js, tweets-part1.js, and so on
+var tweetFilePattern = regexp.MustCompile(`^data/tweets?(-part\d+)?\.js$`)
+
+// archivedTweet is a tweet as stored in a Twitter archive
+type archivedTweet struct {
+	ID        string `json:"id_str"`
+	FullText  string `json:"full_text"`
+	CreatedAt string `json:"created_at"`
+	ReplyToID string `json:"in_reply_to_status_id_str"`
+	Entities  struct {
+		URLs []struct {
+			URL         string `json:"url"`
+			ExpandedURL string `json:"expanded_url"`
+		} `json:"urls"`
+	} `json:"entities"`
+	ExtendedEntities struct {
+		Media []struct {
+			URL      string `json:"url"`
+			MediaURL string `json:"media_url_https"`
+			Type     string `json:"type"`
+		} `json:"media"`
+	} `json:"extended_entities"`
+
+	created time.Time
+}
+
+// openTwitterArchive opens an archive's zip file, or the directory it was extracted to
+func openTwitterArchive(archivePath string) (fs.FS, func() error, error) {
+	info, err := os.Stat(archivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	if info.IsDir() {
+		return os.DirFS(archivePath), func() error { return nil }, nil
+	}
+
+	archive, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	return archive, archive.Close, nil
+}
+
+// readArchivedTweets reads every tweet in an archive, oldest first
+func readArchivedTweets(archive fs.FS) ([]archivedTweet, error) {
+	files, err := fs.Glob(archive, "data/*.js")
+	if err != nil {
+		return nil, err
+	}
+
+	var tweets []archivedTweet
+	for _, file := range files {
+		if !tweetFilePattern.MatchString(file) {
+			continue
+		}
+		data, err := fs.ReadFile(archive, file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+
+		// The files are JavaScript assigning a JSON array: window.YTD.tweets.part0 = [...]
+		start := bytes.IndexByte(data, '[')
+		if start < 0 {
+			return nil, fmt.Errorf("%s doesn't hold any tweets", file)
+		}
+		var entries []struct {
+			Tweet archivedTweet `json:"tweet"`
+		}
+		if err := json.Unmarshal(data[start:], &entries); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", file, err)
+		}
+
+		for _, entry := range entries {
+			tweet := entry.Tweet
+			if tweet.created, err = time.Parse(time.RubyDate, tweet.CreatedAt); err != nil {
+				return nil, fmt.Errorf("tweet %s: invalid date %q", tweet.ID, tweet.CreatedAt)
+			}
+			tweets = append(tweets, tweet)
+		}
+	}
+	if len(tweets) == 0 {
+		return nil, fmt.Errorf("no tweets found; expected data/tweets.js in a Twitter archive")
+	}
+
+	sort.SliceStable(tweets, func(i, j int) bool { return tweets[i].created.Before(tweets[j].created) })
+	return tweets, nil
+}
+
+// text returns the tweet's text with t.co links expanded and links to its media removed
+func (t archivedTweet) text() string {
+	text := t.FullText
+	for _, media := range t.ExtendedEntities.Media {
+		text = strings.ReplaceAll(text, media.URL, "")
+	}
+	for _, link := range t.Entities.URLs {
+		text = strings.ReplaceAll(text, link.URL, link.ExpandedURL)
+	}
+	return strings.TrimSpace(html.UnescapeString(text))
+}
+
+// images reads the tweet's photos from the archive. Videos and GIFs aren't
+// imported; skipped counts them.
+func (t archivedTweet) images(archive fs.FS) (images []Image, skipped int, err error) {
+	for _, media := range t.ExtendedEntities.Media {
+		if media.Type != "photo" {
+			skipped++
+			continue
+		}
+
+		// Media files are named after the tweet and the last part of the media URL
+		name := t.ID + "-" + path.Base(media.MediaURL)
+		var data []byte
+		for _, dir := range []string{"data/tweets_media", "data/tweet_media"} {
+			if data, err = fs.ReadFile(archive, path.Join(dir, name)); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to read %s from the archive: %w", name, err)
+		}
+		images = append(images, Image{Data: data})
+	}
+	return images, skipped, nil
+}
+
+// parseArchiveDate parses a --since or --until date: a year, a month (2023-06), or a day
+func parseArchiveDate(value string) (time.Time, error) {
+	for _, layout := range []string{"2006", "2006-01", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q, expected a year, YYYY-MM, or YYYY-MM-DD", value)
+}
+
+func importTwitterArchiveCommand(args []string) error {
+	fs := flag.NewFlagSet("import twitter-archive", flag.ExitOnError)
+	sinceFlag := fs.String("since", "", "import tweets from this year, month, or day on (2023, 2023-06, 2023-06-15)")
+	untilFlag := fs.String("until", "", "import tweets from before this year, month, or day")
+	limit := fs.Int("limit", 0, "import at most this many tweets")
+	dryRun := fs.Bool("dry-run", false, "list the tweets that would be imported without posting them")
+	positional := parseFlags(fs, args)
+
+	if len(positional) != 1 {
+		fmt.Println("Usage: shout import twitter-archive [--since <date>] [--until <date>] [--limit N] [--dry-run] <archive.zip>")
+		os.Exit(1)
+	}
+
+	var since, until time.Time
+	var err error
+	if *sinceFlag != "" {
+		if since, err = parseArchiveDate(*sinceFlag); err != nil {
+			return err
+		}
+	}
+	if *untilFlag != "" {
+		if until, err = parseArchiveDate(*untilFlag); err != nil {
+			return err
+		}
+	}
+
+	archive, closeArchive, err := openTwitterArchive(positional[0])
+	if err != nil {
+		return err
+	}
+	defer closeArchive()
+
+	tweets, err := readArchivedTweets(archive)
+	if err != nil {
+		return err
+	}
+
+	// Tweets imported by an earlier run are skipped, so an interrupted import can be rerun
+	store, err := openStore()
+	if err != nil {
+		return err
+	}
+	done, err := store.ImportedPosts("twitter")
+	store.Close()
+	if err != nil {
+		return fmt.Errorf("failed to read imported tweets: %w", err)
+	}
+
+	var imported, skipped int
+	for _, tweet := range tweets {
+		if *limit > 0 && imported >= *limit {
+			break
+		}
+		if tweet.created.Before(since) || (!until.IsZero() && !tweet.created.Before(until)) {
+			continue
+		}
+		if strings.HasPrefix(tweet.FullText, "RT @") {
+			continue
+		}
+
+		if _, ok := done[tweet.ID]; ok {
+			continue
+		}
+
+		// Replies to your own imported tweets become threads; other replies are left out
+		post := Post{Text: tweet.text(), CreatedAt: tweet.created}
+		if tweet.ReplyToID != "" {
+			parent, ok := done[tweet.ReplyToID]
+			if !ok {
+				continue
+			}
+			post.ReplyTo = parent.Post
+			post.ThreadRoot = parent.Root
+			if post.ThreadRoot == nil {
+				post.ThreadRoot = parent.Post
+			}
+		}
+
+		images, skippedMedia, err := tweet.images(archive)
+		if err != nil {
+			return fmt.Errorf("tweet %s: %w", tweet.ID, err)
+		}
+		post.Images = images
+		if post.Text == "" && len(post.Images) == 0 {
+			continue
+		}
+		if skippedMedia > 0 {
+			warnf("tweet %s: %d video(s) or GIF(s) left out, only photos are imported\n", tweet.ID, skippedMedia)
+		}
+		if err := checkThread("bluesky", []*Post{&post}); err != nil {
+			warnf("tweet %s skipped: %v\n", tweet.ID, err)
+			skipped++
+			continue
+		}
+
+		if *dryRun {
+			fmt.Printf("%s\t%s\t%d image(s)\t%s\n", tweet.ID, tweet.created.Local().Format("2006-01-02 15:04"), len(post.Images), truncateText(post.Text, 50))
+			done[tweet.ID] = ImportedPost{Post: &PostResult{}}
+			imported++
+			continue
+		}
+
+		result, err := publish("bluesky", &post)
+		if err != nil {
+			return fmt.Errorf("importing tweet %s failed after %d imported; run the same command again to continue: %w", tweet.ID, imported, err)
+		}
+		record := ImportedPost{Post: result, Root: post.ThreadRoot}
+		if store, err = openStore(); err == nil {
+			err = store.SaveImported("twitter", tweet.ID, record)
+			store.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("failed to record imported tweet %s: %w", tweet.ID, err)
+		}
+		done[tweet.ID] = record
+		imported++
+	}
+
+	if *dryRun {
+		fmt.Printf("%d tweet(s) would be imported", imported)
+	} else {
+		fmt.Printf("Imported %d tweet(s)", imported)
+	}
+	if skipped > 0 {
+		fmt.Printf(", %d skipped", skipped)
+	}
+	fmt.Println()
+	return nil
+}
+
+func importCommand(args []string) error {
+	if len(args) == 0 || args[0] != "twitter-archive" {
+		fmt.Println("Usage: shout import twitter-archive [--since <date>] [--until <date>] [--limit N] [--dry-run] <archive.zip>")
+		os.Exit(1)
+	}
+	return importTwitterArchiveCommand(args[1:])
+}
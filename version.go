@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"strings"
+)
+
+// Release builds set these with
+// -ldflags "-X main.buildVersion=1.2.3 -X main.buildCommit=abc1234 -X main.buildDate=2025-06-03T09:00:00Z".
+// Otherwise they come from the build info Go embeds, where it can.
+var (
+	buildVersion string
+	buildCommit  string
+	buildDate    string
+)
+
+// buildDetails is what shout knows about its own build
+type buildDetails struct {
+	Version   string
+	Commit    string
+	Date      string
+	Modified  bool // built from a checkout with uncommitted changes
+	GoVersion string
+}
+
+// readBuildDetails returns the ldflags values, filling in what they leave
+// out from the module version and VCS stamps of the build
+func readBuildDetails() buildDetails {
+	details := buildDetails{Version: buildVersion, Commit: buildCommit, Date: buildDate, GoVersion: runtime.Version()}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		// go install module@version records the version; local builds say (devel)
+		if details.Version == "" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			details.Version = info.Main.Version
+		}
+		for _, setting := range info.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if details.Commit == "" {
+					details.Commit = setting.Value
+				}
+			case "vcs.time":
+				if details.Date == "" {
+					details.Date = setting.Value
+				}
+			case "vcs.modified":
+				details.Modified = setting.Value == "true" && buildCommit == ""
+			}
+		}
+	}
+	details.Version = strings.TrimPrefix(details.Version, "v")
+	if details.Version == "" {
+		details.Version = "dev"
+	}
+	if len(details.Commit) > 12 {
+		details.Commit = details.Commit[:12]
+	}
+	return details
+}
+
+// userAgent identifies shout and its version to the services
+func userAgent() string {
+	return "shout/" + readBuildDetails().Version + " (+https://github.com/punkscience/shout)"
+}
+
+// userAgentTransport sends shout's User-Agent with requests that don't set their own
+type userAgentTransport struct {
+	base http.RoundTripper
+}
+
+func (t *userAgentTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("User-Agent", userAgent())
+	}
+	return t.base.RoundTrip(req)
+}
+
+// versionCommand prints the version shout was built as
+func versionCommand() {
+	details := readBuildDetails()
+	fmt.Printf("shout %s\n", details.Version)
+	if details.Commit != "" {
+		commit := details.Commit
+		if details.Modified {
+			commit += " (modified)"
+		}
+		fmt.Printf("  commit: %s\n", commit)
+	}
+	if details.Date != "" {
+		fmt.Printf("  built:  %s\n", details.Date)
+	}
+	fmt.Printf("  go:     %s %s/%s\n", details.GoVersion, runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	// Time zones for --tz on systems without a zoneinfo database, like Windows
+	_ "time/tzdata"
+)
+
+// scheduleTimeLayouts are the exact formats accepted for a time to post at
+var scheduleTimeLayouts = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"}
+
+var (
+	// relativeTimePattern matches "in 2 hours", "in 90 minutes", or "in 3d"
+	relativeTimePattern = regexp.MustCompile(`^in (\d+) ?(m|mins?|minutes?|h|hrs?|hours?|d|days?|w|weeks?)$`)
+
+	// clockPattern matches a time of day: "9am", "9:30 pm", or "18:00"
+	clockPattern = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))? ?(am|pm)?$`)
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "sun": time.Sunday,
+	"monday": time.Monday, "mon": time.Monday,
+	"tuesday": time.Tuesday, "tue": time.Tuesday, "tues": time.Tuesday,
+	"wednesday": time.Wednesday, "wed": time.Wednesday,
+	"thursday": time.Thursday, "thu": time.Thursday, "thurs": time.Thursday,
+	"friday": time.Friday, "fri": time.Friday,
+	"saturday": time.Saturday, "sat": time.Saturday,
+}
+
+// parseBatchTime parses the time a batch entry or post file is scheduled for,
+// in the local time zone
+func parseBatchTime(value string) (time.Time, error) {
+	return parseScheduleTime(value, time.Local, time.Now())
+}
+
+// parseScheduleTime parses a time to post at in loc: RFC 3339,
+// "2006-01-02 15:04", or a human-friendly time relative to now such as
+// "in 2 hours", "tomorrow 9am", "friday 18:00", or just "9pm"
+func parseScheduleTime(value string, loc *time.Location, now time.Time) (time.Time, error) {
+	for _, layout := range scheduleTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+
+	t, ok := parseNaturalTime(strings.ToLower(strings.Join(strings.Fields(value), " ")), now.In(loc))
+	if !ok {
+		return time.Time{}, fmt.Errorf("invalid time %q, expected something like \"tomorrow 9am\", \"in 2 hours\", \"friday 18:00\", or \"2006-01-02 15:04\"", value)
+	}
+	return t, nil
+}
+
+// parseNaturalTime parses a lowercased human-friendly time, relative to now
+func parseNaturalTime(value string, now time.Time) (time.Time, bool) {
+	if match := relativeTimePattern.FindStringSubmatch(value); match != nil {
+		n, err := strconv.Atoi(match[1])
+		if err != nil {
+			return time.Time{}, false
+		}
+		switch match[2][0] {
+		case 'm':
+			return now.Add(time.Duration(n) * time.Minute), true
+		case 'h':
+			return now.Add(time.Duration(n) * time.Hour), true
+		case 'd':
+			return now.AddDate(0, 0, n), true
+		case 'w':
+			return now.AddDate(0, 0, 7*n), true
+		}
+	}
+
+	// A day, then a time of day, optionally with "at" between them
+	day, clock, _ := strings.Cut(value, " ")
+	clock = strings.TrimPrefix(clock, "at ")
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch {
+	case day == "today":
+		return atClock(today, clock)
+	case day == "tomorrow":
+		return atClock(today.AddDate(0, 0, 1), clock)
+	case day == "next":
+		// "next friday" is never today
+		name, clock, _ := strings.Cut(clock, " ")
+		weekday, ok := weekdays[name]
+		if !ok {
+			return time.Time{}, false
+		}
+		days := (int(weekday)-int(now.Weekday())+6)%7 + 1
+		return atClock(today.AddDate(0, 0, days), strings.TrimPrefix(clock, "at "))
+	}
+	if weekday, ok := weekdays[day]; ok {
+		// The coming one, which is today if that time hasn't passed yet
+		days := (int(weekday) - int(now.Weekday()) + 7) % 7
+		t, ok := atClock(today.AddDate(0, 0, days), clock)
+		if ok && !t.After(now) {
+			t, ok = atClock(today.AddDate(0, 0, days+7), clock)
+		}
+		return t, ok
+	}
+
+	// Only a time of day: the next time the clock shows it
+	t, ok := atClock(today, value)
+	if ok && !t.After(now) {
+		t, ok = atClock(today.AddDate(0, 0, 1), value)
+	}
+	return t, ok
+}
+
+// atClock returns day at a time of day like "9am", "9:30pm", "18:00",
+// "noon", or "midnight"
+func atClock(day time.Time, clock string) (time.Time, bool) {
+	switch clock {
+	case "noon":
+		clock = "12:00"
+	case "midnight":
+		clock = "0:00"
+	}
+	match := clockPattern.FindStringSubmatch(clock)
+	if match == nil {
+		return time.Time{}, false
+	}
+	hour, _ := strconv.Atoi(match[1])
+	minute := 0
+	if match[2] != "" {
+		minute, _ = strconv.Atoi(match[2])
+	}
+	switch match[3] {
+	case "":
+		// A bare number like "9" is too ambiguous to guess at
+		if match[2] == "" {
+			return time.Time{}, false
+		}
+	case "am", "pm":
+		if hour < 1 || hour > 12 {
+			return time.Time{}, false
+		}
+		hour %= 12
+		if match[3] == "pm" {
+			hour += 12
+		}
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, false
+	}
+	return time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, day.Location()), true
+}
+
+// atFlags are the --at and --tz flags of commands that schedule posts
+type atFlags struct {
+	at string
+	tz string
+}
+
+func newAtFlags(fs *flag.FlagSet) *atFlags {
+	f := &atFlags{}
+	fs.StringVar(&f.at, "at", "", "schedule the post for a time, like \"tomorrow 9am\", \"in 2 hours\", \"friday 18:00\", or \"2006-01-02 15:04\"")
+	fs.StringVar(&f.tz, "tz", "", "time zone for --at, like Europe/Berlin, instead of the local one")
+	return f
+}
+
+// time returns the time --at names, or zero if it wasn't given. It has to be
+// in the future.
+func (f *atFlags) time() (time.Time, error) {
+	if f.at == "" {
+		if f.tz != "" {
+			return time.Time{}, withExitCode(exitValidation, fmt.Errorf("--tz only applies to --at"))
+		}
+		return time.Time{}, nil
+	}
+
+	loc := time.Local
+	if f.tz != "" {
+		var err error
+		if loc, err = time.LoadLocation(f.tz); err != nil {
+			return time.Time{}, withExitCode(exitValidation, fmt.Errorf("--tz: unknown time zone %q", f.tz))
+		}
+	}
+	now := time.Now()
+	at, err := parseScheduleTime(f.at, loc, now)
+	if err != nil {
+		return time.Time{}, withExitCode(exitValidation, fmt.Errorf("--at: %w", err))
+	}
+	if !at.After(now) {
+		return time.Time{}, withExitCode(exitValidation, fmt.Errorf("--at: %s is not in the future", at.Local().Format("2006-01-02 15:04")))
+	}
+	return at, nil
+}
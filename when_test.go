@@ -0,0 +1,153 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseScheduleTime(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2026, month, day, hour, minute, 0, 0, berlin)
+	}
+	friday := at(10, 16, 10, 0) // Friday, 10:00
+
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"2026-10-20 15:04", at(10, 20, 15, 4)},
+		{"2026-10-20T15:04", at(10, 20, 15, 4)},
+		{"2026-10-20T15:04:00Z", time.Date(2026, 10, 20, 15, 4, 0, 0, time.UTC)},
+		{"in 2 hours", at(10, 16, 12, 0)},
+		{"in 90m", at(10, 16, 11, 30)},
+		{"in 1 min", at(10, 16, 10, 1)},
+		{"in 3d", at(10, 19, 10, 0)},
+		{"in 1 week", at(10, 23, 10, 0)},
+		{"In  2   Hours", at(10, 16, 12, 0)},
+		{"today 18:00", at(10, 16, 18, 0)},
+		{"today at 6pm", at(10, 16, 18, 0)},
+		{"tomorrow 9am", at(10, 17, 9, 0)},
+		{"tomorrow 9:30 pm", at(10, 17, 21, 30)},
+		{"tomorrow noon", at(10, 17, 12, 0)},
+		{"tomorrow 12am", at(10, 17, 0, 0)},
+		{"tomorrow 12pm", at(10, 17, 12, 0)},
+		{"monday 9am", at(10, 19, 9, 0)},
+		{"mon 9am", at(10, 19, 9, 0)},
+
+		// A weekday is the coming one, today included while that time is ahead
+		{"friday 18:00", at(10, 16, 18, 0)},
+		{"friday 9am", at(10, 23, 9, 0)},
+		{"friday 10:00", at(10, 23, 10, 0)},
+
+		// "next" is never today, even when the time is still ahead
+		{"next friday 18:00", at(10, 23, 18, 0)},
+		{"next friday at 9am", at(10, 23, 9, 0)},
+		{"next saturday 9am", at(10, 17, 9, 0)},
+		{"next thursday 9am", at(10, 22, 9, 0)},
+
+		// A time on its own is the next time the clock shows it
+		{"9pm", at(10, 16, 21, 0)},
+		{"9am", at(10, 17, 9, 0)},
+		{"10:00", at(10, 17, 10, 0)},
+		{"midnight", at(10, 17, 0, 0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseScheduleTime(tt.value, berlin, friday)
+			if err != nil {
+				t.Fatalf("parseScheduleTime(%q): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseScheduleTime(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseScheduleTimeErrors(t *testing.T) {
+	now := time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC)
+	tests := []string{
+		"",
+		"someday",
+		"9",
+		"13pm",
+		"0am",
+		"25:00",
+		"9:60",
+		"in two hours",
+		"in 2 fortnights",
+		"tomorrow",
+		"friday",
+		"next 9am",
+		"next week",
+		"2026-13-01 10:00",
+	}
+	for _, value := range tests {
+		if got, err := parseScheduleTime(value, time.UTC, now); err == nil {
+			t.Errorf("parseScheduleTime(%q) = %s, want an error", value, got)
+		}
+	}
+}
+
+func TestParseScheduleTimeZones(t *testing.T) {
+	berlin := mustLoadLocation(t, "Europe/Berlin")
+	newYork := mustLoadLocation(t, "America/New_York")
+
+	tests := []struct {
+		name  string
+		value string
+		loc   *time.Location
+		now   time.Time
+		want  time.Time
+	}{
+		{
+			// --tz reads the time in that zone, where it's still Thursday
+			name:  "day in another zone",
+			value: "tomorrow 9am",
+			loc:   newYork,
+			now:   time.Date(2026, 10, 16, 2, 0, 0, 0, berlin),
+			want:  time.Date(2026, 10, 16, 9, 0, 0, 0, newYork),
+		},
+		{
+			// Berlin's clocks go back on 2026-10-25, so that day has 25 hours
+			name:  "a day later keeps the clock time over the change",
+			value: "in 1 day",
+			loc:   berlin,
+			now:   time.Date(2026, 10, 24, 12, 0, 0, 0, berlin),
+			want:  time.Date(2026, 10, 25, 12, 0, 0, 0, berlin),
+		},
+		{
+			name:  "hours count real time over the change",
+			value: "in 24 hours",
+			loc:   berlin,
+			now:   time.Date(2026, 10, 24, 12, 0, 0, 0, berlin),
+			want:  time.Date(2026, 10, 25, 11, 0, 0, 0, berlin),
+		},
+		{
+			name:  "tomorrow over the change",
+			value: "tomorrow 9am",
+			loc:   berlin,
+			now:   time.Date(2026, 10, 24, 12, 0, 0, 0, berlin),
+			want:  time.Date(2026, 10, 25, 9, 0, 0, 0, berlin),
+		},
+		{
+			name:  "a weekday over the spring change",
+			value: "next monday 9am",
+			loc:   berlin,
+			now:   time.Date(2026, 3, 27, 12, 0, 0, 0, berlin),
+			want:  time.Date(2026, 3, 30, 9, 0, 0, 0, berlin),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseScheduleTime(tt.value, tt.loc, tt.now)
+			if err != nil {
+				t.Fatalf("parseScheduleTime(%q): %v", tt.value, err)
+			}
+			if !got.Equal(tt.want) {
+				t.Errorf("parseScheduleTime(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
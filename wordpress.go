@@ -0,0 +1,334 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Maximum character count shout sends to WordPress. WordPress itself has no
+// limit, but status posts are meant to be short.
+const WordPressCharacterLimit = 10000
+
+// WordPressSession holds the site and the application password that logs in to it
+type WordPressSession struct {
+	SiteURL     string `json:"site_url"`
+	Username    string `json:"username"`
+	AppPassword string `json:"app_password"`
+}
+
+// wordpressRequest sends a request to the site's REST API and decodes the
+// JSON response into out
+func wordpressRequest(session WordPressSession, method, path, contentType string, body io.Reader, out interface{}) error {
+	req, err := http.NewRequest(method, session.SiteURL+"/wp-json/wp/v2"+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.SetBasicAuth(session.Username, session.AppPassword)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return &statusError{Action: method + " " + path, Status: resp.StatusCode, Body: string(bodyBytes)}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// wordpressJSON sends a JSON body to the site's REST API
+func wordpressJSON(session WordPressSession, method, path string, body interface{}, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return wordpressRequest(session, method, path, "application/json", bytes.NewReader(data), out)
+}
+
+// loadWordPressSession loads the config and checks that a WordPress session is stored
+func loadWordPressSession() (*Config, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+
+	if config.WordPressSession.AppPassword == "" {
+		return nil, withExitCode(exitAuth, fmt.Errorf("not authenticated with WordPress, please run 'shout auth wordpress' first"))
+	}
+
+	return config, nil
+}
+
+func authenticateWordPress(args []string) error {
+	fs := flag.NewFlagSet("auth wordpress", flag.ExitOnError)
+	username := fs.String("user", os.Getenv("WORDPRESS_USERNAME"), "WordPress username the application password belongs to")
+	parseFlags(fs, args)
+
+	config, err := loadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	// Use credentials from the config or environment when available, otherwise prompt
+	site, password, ok, err := configuredCredentials(config, "wordpress", "WORDPRESS_SITE", "WORDPRESS_APP_PASSWORD")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if site, err = promptLine("Enter your WordPress site (e.g. blog.example.com): "); err != nil {
+			return fmt.Errorf("failed to read site: %w", err)
+		}
+	}
+	if *username == "" {
+		if ok {
+			return withExitCode(exitValidation, fmt.Errorf("a username is required, pass --user or set WORDPRESS_USERNAME"))
+		}
+		if *username, err = promptLine("Enter your WordPress username: "); err != nil {
+			return fmt.Errorf("failed to read username: %w", err)
+		}
+	}
+	if !ok {
+		fmt.Println("Create an application password under Users > Profile > Application Passwords.")
+		if password, err = promptLine("Enter the application password: "); err != nil {
+			return fmt.Errorf("failed to read application password: %w", err)
+		}
+	}
+
+	site = strings.TrimSuffix(strings.TrimSpace(site), "/")
+	if !strings.HasPrefix(site, "https://") && !strings.HasPrefix(site, "http://") {
+		site = "https://" + site
+	}
+	session := WordPressSession{SiteURL: site, Username: strings.TrimSpace(*username), AppPassword: strings.TrimSpace(password)}
+
+	// Check the password works, and may publish, before saving it
+	var me struct {
+		Name         string          `json:"name"`
+		Capabilities map[string]bool `json:"capabilities"`
+	}
+	if err := wordpressRequest(session, "GET", "/users/me?context=edit", "", nil, &me); err != nil {
+		return fmt.Errorf("failed to verify application password: %w", err)
+	}
+	if !me.Capabilities["publish_posts"] {
+		return withExitCode(exitAuth, fmt.Errorf("%s can't publish posts on %s", session.Username, site))
+	}
+
+	config.WordPressSession = session
+	if err := saveConfig(config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	successf("successfully authenticated with WordPress as %s on %s!\n", me.Name, site)
+	return nil
+}
+
+// postHTML turns a post's plain text into HTML paragraphs with links,
+// followed by its images, for blogs like WordPress and Ghost. A content
+// warning folds the text away behind it.
+func postHTML(text, warning string, images []string) string {
+	var content strings.Builder
+	for _, paragraph := range strings.Split(strings.TrimSpace(text), "\n\n") {
+		if paragraph == "" {
+			continue
+		}
+		var linked strings.Builder
+		last := 0
+		for _, loc := range urlPattern.FindAllStringIndex(paragraph, -1) {
+			link := strings.TrimRight(paragraph[loc[0]:loc[1]], ".,;:!?)'\"")
+			linked.WriteString(html.EscapeString(paragraph[last:loc[0]]))
+			fmt.Fprintf(&linked, "<a href=\"%s\">%s</a>", html.EscapeString(link), html.EscapeString(link))
+			last = loc[0] + len(link)
+		}
+		linked.WriteString(html.EscapeString(paragraph[last:]))
+		fmt.Fprintf(&content, "<p>%s</p>\n", strings.ReplaceAll(linked.String(), "\n", "<br>\n"))
+	}
+	for _, image := range images {
+		content.WriteString(image + "\n")
+	}
+	if warning != "" {
+		return fmt.Sprintf("<details><summary>%s</summary>\n%s</details>", html.EscapeString(warning), content.String())
+	}
+	return content.String()
+}
+
+// uploadWordPressMedia uploads an image to the media library and returns its
+// ID and an <img> tag showing it
+func uploadWordPressMedia(session WordPressSession, image Image) (int, string, error) {
+	contentType := http.DetectContentType(image.Data)
+	extension := strings.TrimPrefix(contentType, "image/")
+	query := url.Values{"alt_text": {image.Alt}}
+
+	// WordPress names the file from the Content-Disposition header, so this is
+	// a request of its own rather than one through wordpressRequest
+	upload := newProgressReader("WordPress", image.Data)
+	req, err := http.NewRequest("POST", session.SiteURL+"/wp-json/wp/v2/media?"+query.Encode(), upload)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.ContentLength = int64(len(image.Data))
+	req.SetBasicAuth(session.Username, session.AppPassword)
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"image.%s\"", extension))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, "", fmt.Errorf("image upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return 0, "", fmt.Errorf("image upload failed: %w", &statusError{Action: "POST /media", Status: resp.StatusCode, Body: string(body)})
+	}
+	var media struct {
+		ID        int    `json:"id"`
+		SourceURL string `json:"source_url"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&media); err != nil {
+		return 0, "", fmt.Errorf("failed to decode response: %w", err)
+	}
+	return media.ID, fmt.Sprintf("<img src=\"%s\" alt=\"%s\">", html.EscapeString(media.SourceURL), html.EscapeString(image.Alt)), nil
+}
+
+// PostToWordPress publishes the post as a status-format post, or replies to a
+// post of a thread with a comment
+func PostToWordPress(post *Post) (*PostResult, error) {
+	config, err := loadWordPressSession()
+	if err != nil {
+		return nil, err
+	}
+	session := config.WordPressSession
+
+	var created struct {
+		ID   int    `json:"id"`
+		Link string `json:"link"`
+	}
+	var result *PostResult
+	if post.ReplyTo != nil {
+		// Comments belong to the thread's post, in reply to the comment before them
+		root := post.ThreadRoot
+		if root == nil {
+			root = post.ReplyTo
+		}
+		_, postID, err := splitPostID(root.ID)
+		if err != nil {
+			return nil, err
+		}
+		comment := map[string]interface{}{"post": postID, "content": postHTML(post.Text, post.ContentWarning, nil)}
+		if kind, parentID, err := splitPostID(post.ReplyTo.ID); err == nil && kind == "comment" {
+			comment["parent"] = parentID
+		}
+		if err := wordpressJSON(session, "POST", "/comments", comment, &created); err != nil {
+			return nil, fmt.Errorf("commenting failed: %w", err)
+		}
+		result = &PostResult{ID: "comment:" + strconv.Itoa(created.ID), URI: created.Link, URL: created.Link}
+	} else {
+		var tags []string
+		var featured int
+		for i, image := range post.Images {
+			if image, err = prepareImage("wordpress", post, image); err != nil {
+				return nil, fmt.Errorf("image %d: %w", i+1, err)
+			}
+			id, tag, err := uploadWordPressMedia(session, image)
+			if err != nil {
+				return nil, fmt.Errorf("failed to upload image %d: %w", i+1, err)
+			}
+			if featured == 0 {
+				featured = id
+			}
+			tags = append(tags, tag)
+		}
+
+		body := map[string]interface{}{
+			"status":  "publish",
+			"format":  "status",
+			"content": postHTML(post.Text, post.ContentWarning, tags),
+		}
+		if post.Title != "" {
+			body["title"] = post.Title
+		}
+		if featured != 0 {
+			body["featured_media"] = featured
+		}
+		if err := wordpressJSON(session, "POST", "/posts", body, &created); err != nil {
+			return nil, fmt.Errorf("posting failed: %w", err)
+		}
+		result = &PostResult{ID: "post:" + strconv.Itoa(created.ID), URI: created.Link, URL: created.Link}
+	}
+
+	successf("Successfully posted to WordPress!\n  URL: %s\n", result.URL)
+
+	if err := recordHistory("wordpress", post.Text, result); err != nil {
+		warnf("failed to record post history: %v\n", err)
+	}
+
+	return result, nil
+}
+
+// deleteWordPressPost moves a post or comment to the trash, after checking
+// that it's still there and ours
+func deleteWordPressPost(id string) error {
+	config, err := loadWordPressSession()
+	if err != nil {
+		return err
+	}
+	kind, number, err := splitPostID(id)
+	if err != nil {
+		return err
+	}
+	session := config.WordPressSession
+	path := "/" + kind + "s/" + strconv.Itoa(number)
+
+	var current struct {
+		Author int    `json:"author"`
+		Status string `json:"status"`
+	}
+	err = wordpressRequest(session, "GET", path+"?context=edit", "", nil, &current)
+	var statusErr *statusError
+	if errors.As(err, &statusErr) && (statusErr.Status == http.StatusNotFound || statusErr.Status == http.StatusGone) {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return err
+	}
+	if current.Status == "trash" {
+		return errAlreadyDeleted
+	}
+	var me struct {
+		ID int `json:"id"`
+	}
+	if err := wordpressRequest(session, "GET", "/users/me", "", nil, &me); err != nil {
+		return err
+	}
+	if current.Author != me.ID {
+		return errOtherAccount
+	}
+
+	err = wordpressRequest(session, "DELETE", path, "", nil, nil)
+	if errors.As(err, &statusErr) && (statusErr.Status == http.StatusNotFound || statusErr.Status == http.StatusGone) {
+		return errAlreadyDeleted
+	}
+	if err != nil {
+		return fmt.Errorf("deleting failed: %w", err)
+	}
+	return nil
+}